@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
+	"go.uber.org/zap"
+)
+
+const apiKeyUsage = "usage: url-shortener apikey create <owner> [name]|revoke <id>"
+
+// runAPIKey implements the "apikey" subcommand.
+func runAPIKey(ctx context.Context, cfg *Config, logger *zap.Logger, args []string) error {
+	if len(args) < 2 {
+		return errors.New(apiKeyUsage)
+	}
+	if cfg.Database.Driver == postgres.DriverMemory {
+		return errors.New("API keys cannot be managed offline with the memory driver")
+	}
+
+	db, err := postgres.PrepareConnection(ctx, cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer func() {
+		if err = db.Close(); err != nil {
+			logger.Warn("Error closing db", zap.Error(err))
+		}
+	}()
+	keys := auth.NewService(repository.NewAPIKeyRepository(db), logger)
+
+	switch args[0] {
+	case "create":
+		var name string
+		if len(args) > 2 {
+			name = args[2]
+		}
+		key, plain, err := keys.CreateKey(ctx, args[1], name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id:    %s\nowner: %s\nkey:   %s\n", key.ID, key.OwnerID, plain)
+		fmt.Println("Store the key now, it cannot be shown again.")
+	case "revoke":
+		if err = keys.RevokeKey(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("revoked %s\n", args[1])
+	default:
+		return errors.New(apiKeyUsage)
+	}
+	return nil
+}
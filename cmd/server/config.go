@@ -6,14 +6,34 @@ import (
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/clicklog"
+	"github.com/vladislavprovich/url-shortener/internal/geoip"
 	"github.com/vladislavprovich/url-shortener/internal/handler"
+	"github.com/vladislavprovich/url-shortener/internal/health"
+	"github.com/vladislavprovich/url-shortener/internal/metrics"
+	"github.com/vladislavprovich/url-shortener/internal/policy"
+	"github.com/vladislavprovich/url-shortener/internal/repository/cache"
 	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
+	"github.com/vladislavprovich/url-shortener/internal/service"
+	"github.com/vladislavprovich/url-shortener/pkg/normalizer"
+	"github.com/vladislavprovich/url-shortener/pkg/shortener"
 )
 
 type Config struct {
-	Server   handler.Config
-	Database postgres.Config
-	Logger   LoggerConfig
+	Server     handler.Config
+	Auth       auth.Config
+	Database   postgres.Config
+	Cache      cache.Config
+	Service    service.Config
+	Shortener  shortener.Config
+	Normalizer normalizer.Config
+	Policy     policy.Config
+	GeoIP      geoip.Config
+	ClickLog   clicklog.Config
+	Metrics    metrics.Config
+	Health     health.Config
+	Logger     LoggerConfig
 }
 
 type LoggerConfig struct {
@@ -34,7 +54,17 @@ func LoadConfig(ctx context.Context) (*Config, error) {
 func (c *Config) ValidateWithContext(ctx context.Context) error {
 	return validation.ValidateStructWithContext(ctx, c,
 		validation.Field(&c.Server),
+		validation.Field(&c.Auth),
 		validation.Field(&c.Database),
+		validation.Field(&c.Cache),
+		validation.Field(&c.Service),
+		validation.Field(&c.Shortener),
+		validation.Field(&c.Normalizer),
+		validation.Field(&c.Policy),
+		validation.Field(&c.GeoIP),
+		validation.Field(&c.ClickLog),
+		validation.Field(&c.Metrics),
+		validation.Field(&c.Health),
 		validation.Field(&c.Logger),
 	)
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
+	"github.com/vladislavprovich/url-shortener/internal/service"
+	"go.uber.org/zap"
+)
+
+const linkUsage = "usage: url-shortener link block|unblock <short code>"
+
+// runLink implements the "link" subcommand for operator actions on links.
+func runLink(ctx context.Context, cfg *Config, logger *zap.Logger, args []string) error {
+	if len(args) != 2 {
+		return errors.New(linkUsage)
+	}
+	var blocked bool
+	switch args[0] {
+	case "block":
+		blocked = true
+	case "unblock":
+	default:
+		return errors.New(linkUsage)
+	}
+	if cfg.Database.Driver == postgres.DriverMemory {
+		return errors.New("links cannot be managed offline with the memory driver")
+	}
+
+	db, err := postgres.PrepareConnection(ctx, cfg.Database, logger)
+	if err != nil {
+		return fmt.Errorf("connect to database: %w", err)
+	}
+	defer func() {
+		if err = db.Close(); err != nil {
+			logger.Warn("Error closing db", zap.Error(err))
+		}
+	}()
+	links := service.NewURLService(repository.NewURLRepository(db), logger)
+
+	url, err := links.SetBlocked(ctx, args[1], blocked)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s -> %s\n", args[0]+"ed", url.ShortURL, url.OriginalURL)
+	return nil
+}
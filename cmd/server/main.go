@@ -10,15 +10,28 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/clicklog"
+	"github.com/vladislavprovich/url-shortener/internal/geoip"
+	"github.com/vladislavprovich/url-shortener/internal/health"
+	"github.com/vladislavprovich/url-shortener/internal/metrics"
+	"github.com/vladislavprovich/url-shortener/internal/middleware"
+	"github.com/vladislavprovich/url-shortener/internal/policy"
 	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/internal/repository/cache"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
 	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
 	"github.com/vladislavprovich/url-shortener/internal/service"
 
 	"github.com/vladislavprovich/url-shortener/internal/handler"
 	"github.com/vladislavprovich/url-shortener/pkg/logger"
+	"github.com/vladislavprovich/url-shortener/pkg/normalizer"
+	"github.com/vladislavprovich/url-shortener/pkg/shortener"
 	"go.uber.org/zap"
 )
 
+const idempotencySweepInterval = time.Hour
+
 func main() {
 	ctx := context.Background()
 
@@ -29,19 +42,124 @@ func main() {
 	}
 
 	logger := initLogger(cfg.Logger.Level)
-	db, err := postgres.PrepareConnection(ctx, cfg.Database, logger)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = runMigrate(ctx, cfg, logger, os.Args[2:]); err != nil {
+			logger.Fatal("Migration failed", zap.Error(err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err = runAPIKey(ctx, cfg, logger, os.Args[2:]); err != nil {
+			logger.Fatal("API key command failed", zap.Error(err))
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "link" {
+		if err = runLink(ctx, cfg, logger, os.Args[2:]); err != nil {
+			logger.Fatal("Link command failed", zap.Error(err))
+		}
+		return
+	}
+
+	var appMetrics *metrics.Metrics
+	if cfg.Metrics.Enabled {
+		appMetrics = metrics.New()
+	}
+
+	var (
+		repo       repository.URLRepository
+		keyRepo    repository.APIKeyRepository
+		idemRepo   repository.IdempotencyRepository
+		sequence   shortener.Sequence
+		healthOpts []health.Option
+	)
+	if cfg.Database.Driver == postgres.DriverMemory {
+		logger.Warn("Using in-memory storage, data will be lost on restart")
+		repo = memory.NewURLRepository()
+		keyRepo = memory.NewAPIKeyRepository()
+		idemRepo = memory.NewIdempotencyRepository()
+		sequence = shortener.NewCounter(0)
+	} else {
+		db, err := postgres.PrepareConnection(ctx, cfg.Database, logger)
+		if err != nil {
+			logger.Fatal("Failed to connect to database", zap.Error(err))
+		}
+		defer func() {
+			if err = db.Close(); err != nil {
+				logger.Warn("Error closing db", zap.Error(err))
+			}
+		}()
+		if appMetrics != nil {
+			appMetrics.RegisterDB(db, "urlshortener")
+		}
+		migrator, err := postgres.NewMigrator(db, logger)
+		if err != nil {
+			logger.Fatal("Failed to load migrations", zap.Error(err))
+		}
+		healthOpts = append(healthOpts, health.WithDatabase(db), health.WithMigrations(migrator))
+		repo = initRepo(db)
+		keyRepo = repository.NewAPIKeyRepository(db)
+		idemRepo = repository.NewIdempotencyRepository(db)
+		sequence = repository.NewShortURLSequence(db)
+	}
+	generator, err := shortener.New(cfg.Shortener, sequence)
+	if err != nil {
+		logger.Fatal("Failed to create short code generator", zap.Error(err))
+	}
+	destinations, err := policy.New(cfg.Policy, logger, policy.WithSelfURLs(cfg.Server.BaseURL))
+	if err != nil {
+		logger.Fatal("Failed to load destination policy", zap.Error(err))
+	}
+	locator, err := geoip.New(cfg.GeoIP, logger)
 	if err != nil {
-		logger.Fatal("Failed to connect to database", zap.Error(err))
+		logger.Fatal("Failed to load GeoIP database", zap.Error(err))
 	}
-	defer func() {
-		if err = db.Close(); err != nil {
-			logger.Warn("Error closing db", zap.Error(err))
+	clicks := clicklog.NewPipeline(repo, cfg.ClickLog, logger)
+	if appMetrics != nil {
+		appMetrics.RegisterClickLog(clicks.Stats)
+	}
+	var cached *cache.URLRepository
+	if cfg.Cache.Enabled {
+		cached = cache.NewURLRepository(repo, cfg.Cache, logger)
+		if appMetrics != nil {
+			appMetrics.RegisterCache(cached.Stats)
 		}
-	}()
-	repo := initRepo(db)
-	service := initService(&repo, logger)
+		repo = cached
+	}
+	clicks.Start()
+	service := initService(&repo, logger, cfg.Service, clicks, generator, appMetrics,
+		service.WithNormalizer(normalizer.New(cfg.Normalizer)),
+		service.WithPolicy(destinations),
+		service.WithGeoLocator(locator),
+	)
 	urlHandler := initHandler(service, logger, cfg.Server)
-	r := handler.InitRouter(urlHandler, logger, cfg.Server)
+	checker := health.NewChecker(cfg.Health, logger, append(healthOpts, health.WithPipeline(clicks))...)
+	routerOpts := []handler.RouterOption{
+		handler.WithHealth(checker),
+		handler.WithIdempotency(middleware.Idempotency(idemRepo, cfg.Server.IdempotencyWindow,
+			cfg.Server.IdempotencyLease, logger)),
+	}
+	sweepCtx, stopSweeping := context.WithCancel(ctx)
+	defer stopSweeping()
+	go sweepIdempotencyKeys(sweepCtx, idemRepo, logger)
+	go destinations.Watch(sweepCtx)
+	go locator.Watch(sweepCtx)
+	if cached != nil {
+		go cached.Watch(sweepCtx)
+	}
+	if appMetrics != nil {
+		routerOpts = append(routerOpts, handler.WithMetrics(appMetrics))
+	}
+	if cfg.Auth.Enabled {
+		keys := auth.NewService(keyRepo, logger)
+		if cfg.Database.Driver == postgres.DriverMemory {
+			issueDevelopmentKey(ctx, keys, logger)
+		}
+		routerOpts = append(routerOpts, handler.WithAuth(middleware.APIKeyAuth(keys, logger)))
+	} else {
+		logger.Warn("API key authentication is disabled, anyone can create and manage links")
+	}
+	r := handler.InitRouter(urlHandler, logger, cfg.Server, routerOpts...)
 
 	srv := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
@@ -63,17 +181,62 @@ func main() {
 
 	<-quit
 	logger.Info("Server is shutting down...")
+	checker.SetShuttingDown()
+	if delay := checker.ShutdownDelay(); delay > 0 {
+		logger.Info("Waiting for load balancers to notice readiness change", zap.Duration("delay", delay))
+		time.Sleep(delay)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err = srv.Shutdown(ctx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+		logger.Error("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Flush buffered redirect logs once no more requests can enqueue them.
+	if err = clicks.Close(ctx); err != nil {
+		logger.Error("Failed to flush redirect logs", zap.Error(err))
+	}
+	stats := clicks.Stats()
+	logger.Info("Redirect log pipeline stopped",
+		zap.Uint64("written", stats.Written),
+		zap.Uint64("dropped", stats.Dropped),
+		zap.Uint64("failed", stats.Failed),
+		zap.Int("backlog", stats.Backlog))
+
 	logger.Info("Server exited gracefully")
 }
 
+// sweepIdempotencyKeys deletes expired idempotency records until ctx is done.
+func sweepIdempotencyKeys(ctx context.Context, repo repository.IdempotencyRepository, logger *zap.Logger) {
+	ticker := time.NewTicker(idempotencySweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			deleted, err := repo.DeleteExpiredIdempotencyKeys(ctx, now)
+			if err != nil {
+				logger.Warn("Failed to delete expired idempotency keys", zap.Error(err))
+				continue
+			}
+			logger.Debug("Deleted expired idempotency keys", zap.Int64("deleted", deleted))
+		}
+	}
+}
+
+// issueDevelopmentKey creates an API key at startup for the memory driver,
+// where keys cannot be created with the apikey subcommand.
+func issueDevelopmentKey(ctx context.Context, keys *auth.Service, logger *zap.Logger) {
+	_, plain, err := keys.CreateKey(ctx, "dev", "in-memory development key")
+	if err != nil {
+		logger.Fatal("Failed to create development API key", zap.Error(err))
+	}
+	logger.Warn("Issued development API key for owner \"dev\"", zap.String("api_key", plain))
+}
+
 func initLogger(logLevel string) *zap.Logger {
 	return logger.NewLogger(logLevel)
 }
@@ -82,8 +245,25 @@ func initRepo(db *sql.DB) repository.URLRepository {
 	return repository.NewURLRepository(db)
 }
 
-func initService(repo *repository.URLRepository, logger *zap.Logger) service.URLService {
-	return service.NewURLService(*repo, logger)
+func initService(
+	repo *repository.URLRepository,
+	logger *zap.Logger,
+	cfg service.Config,
+	clicks service.ClickRecorder,
+	generator shortener.Generator,
+	appMetrics *metrics.Metrics,
+	extra ...service.Option,
+) service.URLService {
+	opts := []service.Option{
+		service.WithConfig(cfg),
+		service.WithClickRecorder(clicks),
+		service.WithGenerator(generator),
+	}
+	opts = append(opts, extra...)
+	if appMetrics != nil {
+		opts = append(opts, service.WithMetrics(appMetrics))
+	}
+	return service.NewURLService(*repo, logger, opts...)
 }
 
 func initHandler(srv service.URLService, logger *zap.Logger, cfg handler.Config) *handler.URLHandler {
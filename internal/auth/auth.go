@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/pkg/shortener"
+)
+
+const (
+	// keyPrefix makes keys recognizable, e.g. by secret scanners.
+	keyPrefix = "usk_"
+	// keyLength is the number of random base62 characters, about 190 bits.
+	keyLength = 32
+)
+
+type ownerKey struct{}
+
+// WithOwner returns a context carrying the authenticated owner.
+func WithOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, ownerKey{}, owner)
+}
+
+// OwnerFromContext returns the authenticated owner, if the request carried a valid API key.
+func OwnerFromContext(ctx context.Context) (string, bool) {
+	owner, ok := ctx.Value(ownerKey{}).(string)
+	return owner, ok
+}
+
+// GenerateKey returns a new random API key.
+func GenerateKey() (string, error) {
+	var key strings.Builder
+	key.WriteString(keyPrefix)
+	limit := big.NewInt(int64(len(shortener.Alphabet)))
+	for range keyLength {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		key.WriteByte(shortener.Alphabet[n.Int64()])
+	}
+	return key.String(), nil
+}
+
+// HashKey returns the hex encoded SHA-256 of key. Keys are long random
+// strings, so a fast hash is enough to make a leaked table useless.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Service issues, revokes and verifies API keys.
+type Service struct {
+	repo   repository.APIKeyRepository
+	logger *zap.Logger
+}
+
+func NewService(repo repository.APIKeyRepository, logger *zap.Logger) *Service {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Service{repo: repo, logger: logger}
+}
+
+// CreateKey issues a key for owner. The plain key is only returned here and
+// cannot be recovered later.
+func (s *Service) CreateKey(ctx context.Context, owner, name string) (models.APIKey, string, error) {
+	if owner == "" {
+		return models.APIKey{}, "", errors.New("owner is required")
+	}
+	plain, err := GenerateKey()
+	if err != nil {
+		return models.APIKey{}, "", fmt.Errorf("generate api key: %w", err)
+	}
+	key := models.APIKey{
+		ID:        uuid.New().String(),
+		OwnerID:   owner,
+		Name:      name,
+		KeyHash:   HashKey(plain),
+		CreatedAt: time.Now(),
+	}
+	if err = s.repo.SaveAPIKey(ctx, key); err != nil {
+		return models.APIKey{}, "", fmt.Errorf("save api key: %w", err)
+	}
+	s.logger.Info("auth, API key created", zap.String("key_id", key.ID), zap.String("owner_id", owner))
+	return key, plain, nil
+}
+
+func (s *Service) RevokeKey(ctx context.Context, id string) error {
+	if err := s.repo.RevokeAPIKey(ctx, id, time.Now()); err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	s.logger.Info("auth, API key revoked", zap.String("key_id", id))
+	return nil
+}
+
+// Authenticate resolves key to its owner. Unknown and revoked keys yield
+// models.ErrUnauthorized.
+func (s *Service) Authenticate(ctx context.Context, key string) (string, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return "", models.ErrUnauthorized
+	}
+	stored, err := s.repo.GetAPIKeyByHash(ctx, HashKey(key))
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return "", models.ErrUnauthorized
+	case err != nil:
+		return "", fmt.Errorf("get api key: %w", err)
+	case stored.RevokedAt != nil:
+		s.logger.Info("auth, revoked API key used", zap.String("key_id", stored.ID))
+		return "", models.ErrUnauthorized
+	}
+	return stored.OwnerID, nil
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+)
+
+func TestGenerateKey(t *testing.T) {
+	first, err := GenerateKey()
+	require.NoError(t, err)
+	second, err := GenerateKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(first, keyPrefix))
+	assert.Len(t, first, len(keyPrefix)+keyLength)
+	assert.NotEqual(t, first, second)
+	assert.Len(t, HashKey(first), 64)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := NewService(memory.NewAPIKeyRepository(), nil)
+
+	key, plain, err := s.CreateKey(ctx, "alice", "ci")
+	require.NoError(t, err)
+	assert.Equal(t, HashKey(plain), key.KeyHash)
+
+	owner, err := s.Authenticate(ctx, plain)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", owner)
+
+	_, err = s.Authenticate(ctx, plain+"x")
+	require.ErrorIs(t, err, models.ErrUnauthorized)
+	_, err = s.Authenticate(ctx, "not-a-key")
+	require.ErrorIs(t, err, models.ErrUnauthorized)
+
+	require.NoError(t, s.RevokeKey(ctx, key.ID))
+	_, err = s.Authenticate(ctx, plain)
+	require.ErrorIs(t, err, models.ErrUnauthorized)
+}
+
+func TestCreateKey_RequiresOwner(t *testing.T) {
+	_, _, err := NewService(memory.NewAPIKeyRepository(), nil).CreateKey(context.Background(), "", "")
+	require.Error(t, err)
+}
@@ -0,0 +1,13 @@
+package auth
+
+import "context"
+
+type Config struct {
+	// Enabled requires an API key for creating links, reading stats and
+	// managing links. Redirects are always public.
+	Enabled bool `envconfig:"AUTH_ENABLED" default:"true"`
+}
+
+func (c Config) ValidateWithContext(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,41 @@
+package clicklog
+
+import (
+	"context"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+)
+
+const (
+	// PolicyDrop discards events immediately when the buffer is full.
+	PolicyDrop = "drop"
+	// PolicyBlock waits up to EnqueueTimeout for buffer space before discarding.
+	PolicyBlock = "block"
+
+	// maxBatchSize keeps multi-row inserts within the Postgres limit of bind parameters.
+	maxBatchSize = repository.MaxBindParameters / repository.RedirectLogColumnCount
+)
+
+type Config struct {
+	BufferSize     int           `envconfig:"CLICKLOG_BUFFER_SIZE" default:"10000"`
+	BatchSize      int           `envconfig:"CLICKLOG_BATCH_SIZE" default:"500"`
+	FlushInterval  time.Duration `envconfig:"CLICKLOG_FLUSH_INTERVAL" default:"1s"`
+	FlushTimeout   time.Duration `envconfig:"CLICKLOG_FLUSH_TIMEOUT" default:"5s"`
+	Workers        int           `envconfig:"CLICKLOG_WORKERS" default:"2"`
+	Policy         string        `envconfig:"CLICKLOG_POLICY" default:"drop"`
+	EnqueueTimeout time.Duration `envconfig:"CLICKLOG_ENQUEUE_TIMEOUT" default:"50ms"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.BufferSize, validation.Required, validation.Min(1)),
+		validation.Field(&c.BatchSize, validation.Required, validation.Min(1), validation.Max(maxBatchSize)),
+		validation.Field(&c.FlushInterval, validation.Required),
+		validation.Field(&c.FlushTimeout, validation.Required),
+		validation.Field(&c.Workers, validation.Required, validation.Min(1)),
+		validation.Field(&c.Policy, validation.Required, validation.In(PolicyDrop, PolicyBlock)),
+	)
+}
@@ -0,0 +1,24 @@
+package clicklog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+)
+
+func TestConfig_BatchSizeFitsBindParameters(t *testing.T) {
+	assert.LessOrEqual(t, maxBatchSize*repository.RedirectLogColumnCount, repository.MaxBindParameters)
+	assert.Greater(t, (maxBatchSize+1)*repository.RedirectLogColumnCount, repository.MaxBindParameters)
+
+	cfg := Config{
+		BufferSize: 10000, BatchSize: maxBatchSize, FlushInterval: time.Second, FlushTimeout: time.Second,
+		Workers: 1, Policy: PolicyDrop,
+	}
+	assert.NoError(t, cfg.ValidateWithContext(context.Background()))
+	cfg.BatchSize = maxBatchSize + 1
+	assert.Error(t, cfg.ValidateWithContext(context.Background()))
+}
@@ -0,0 +1,198 @@
+package clicklog
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrBufferFull = errors.New("click log buffer is full")
+	ErrClosed     = errors.New("click log pipeline is closed")
+)
+
+// Writer persists a batch of redirect logs, usually repository.URLRepository.
+type Writer interface {
+	SaveRedirectLogs(ctx context.Context, logs []models.RedirectLog) error
+	SaveRedirectLog(ctx context.Context, log models.RedirectLog) error
+}
+
+// Stats is a snapshot of the pipeline counters.
+type Stats struct {
+	Enqueued      uint64
+	Dropped       uint64
+	Written       uint64
+	Failed        uint64
+	Batches       uint64
+	FailedBatches uint64
+	Backlog       int
+}
+
+// Pipeline buffers redirect logs in memory and writes them in batches from a
+// pool of workers, so redirects never wait for the database.
+type Pipeline struct {
+	writer Writer
+	logger *zap.Logger
+	config Config
+	events chan models.RedirectLog
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	enqueued      atomic.Uint64
+	dropped       atomic.Uint64
+	written       atomic.Uint64
+	failed        atomic.Uint64
+	batches       atomic.Uint64
+	failedBatches atomic.Uint64
+}
+
+func NewPipeline(writer Writer, cfg Config, logger *zap.Logger) *Pipeline {
+	return &Pipeline{
+		writer: writer,
+		logger: logger,
+		config: cfg,
+		events: make(chan models.RedirectLog, cfg.BufferSize),
+	}
+}
+
+// Start launches the workers. It must be called once before Record.
+func (p *Pipeline) Start() {
+	for range p.config.Workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+// Record enqueues log for asynchronous writing. When the buffer is full the
+// event is dropped according to the configured policy and ErrBufferFull is returned.
+func (p *Pipeline) Record(ctx context.Context, log models.RedirectLog) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		p.dropped.Add(1)
+		return ErrClosed
+	}
+
+	select {
+	case p.events <- log:
+		p.enqueued.Add(1)
+		return nil
+	default:
+	}
+
+	if p.config.Policy == PolicyBlock {
+		timer := time.NewTimer(p.config.EnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case p.events <- log:
+			p.enqueued.Add(1)
+			return nil
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+
+	p.dropped.Add(1)
+	return ErrBufferFull
+}
+
+// Close stops accepting events and waits until the workers have flushed the
+// backlog or ctx is done.
+func (p *Pipeline) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pipeline) Stats() Stats {
+	return Stats{
+		Enqueued:      p.enqueued.Load(),
+		Dropped:       p.dropped.Load(),
+		Written:       p.written.Load(),
+		Failed:        p.failed.Load(),
+		Batches:       p.batches.Load(),
+		FailedBatches: p.failedBatches.Load(),
+		Backlog:       len(p.events),
+	}
+}
+
+func (p *Pipeline) work() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.RedirectLog, 0, p.config.BatchSize)
+	for {
+		select {
+		case log, ok := <-p.events:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			batch = append(batch, log)
+			if len(batch) >= p.config.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes batch in a single statement. If that fails the events are
+// retried one by one so a single bad row does not lose the whole batch.
+func (p *Pipeline) flush(batch []models.RedirectLog) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.FlushTimeout)
+	defer cancel()
+
+	p.batches.Add(1)
+	err := p.writer.SaveRedirectLogs(ctx, batch)
+	if err == nil {
+		p.written.Add(uint64(len(batch)))
+		return
+	}
+
+	p.failedBatches.Add(1)
+	p.logger.Warn("clicklog, batch write failed, retrying individually",
+		zap.Int("batch_size", len(batch)), zap.Error(err))
+	for _, log := range batch {
+		if err = p.writer.SaveRedirectLog(ctx, log); err != nil {
+			p.failed.Add(1)
+			p.logger.Error("clicklog, failed to write redirect log",
+				zap.String("log_id", log.ID), zap.Error(err))
+			continue
+		}
+		p.written.Add(1)
+	}
+}
@@ -0,0 +1,158 @@
+package clicklog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+type fakeWriter struct {
+	mu         sync.Mutex
+	batches    [][]models.RedirectLog
+	single     []models.RedirectLog
+	batchErr   error
+	rejectedID string
+	block      chan struct{}
+}
+
+func (w *fakeWriter) SaveRedirectLogs(_ context.Context, logs []models.RedirectLog) error {
+	if w.block != nil {
+		<-w.block
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.batchErr != nil {
+		return w.batchErr
+	}
+	w.batches = append(w.batches, append([]models.RedirectLog(nil), logs...))
+	return nil
+}
+
+func (w *fakeWriter) SaveRedirectLog(_ context.Context, log models.RedirectLog) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if log.ID == w.rejectedID {
+		return errors.New("foreign key violation")
+	}
+	w.single = append(w.single, log)
+	return nil
+}
+
+func (w *fakeWriter) written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(w.single)
+	for _, batch := range w.batches {
+		n += len(batch)
+	}
+	return n
+}
+
+func testConfig() Config {
+	return Config{
+		BufferSize:     100,
+		BatchSize:      10,
+		FlushInterval:  time.Hour,
+		FlushTimeout:   time.Second,
+		Workers:        1,
+		Policy:         PolicyDrop,
+		EnqueueTimeout: 10 * time.Millisecond,
+	}
+}
+
+func TestPipeline_FlushesOnBatchSize(t *testing.T) {
+	writer := &fakeWriter{}
+	p := NewPipeline(writer, testConfig(), zap.NewNop())
+	p.Start()
+
+	for i := range 10 {
+		require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: fmt.Sprint(i)}))
+	}
+
+	assert.Eventually(t, func() bool { return writer.written() == 10 }, time.Second, 5*time.Millisecond)
+	require.NoError(t, p.Close(context.TODO()))
+	assert.Len(t, writer.batches, 1)
+}
+
+func TestPipeline_FlushesOnInterval(t *testing.T) {
+	writer := &fakeWriter{}
+	cfg := testConfig()
+	cfg.FlushInterval = 10 * time.Millisecond
+	p := NewPipeline(writer, cfg, zap.NewNop())
+	p.Start()
+	defer func() {
+		require.NoError(t, p.Close(context.TODO()))
+	}()
+
+	require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: "1"}))
+
+	assert.Eventually(t, func() bool { return writer.written() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestPipeline_CloseFlushesBacklog(t *testing.T) {
+	writer := &fakeWriter{}
+	cfg := testConfig()
+	cfg.Workers = 3
+	p := NewPipeline(writer, cfg, zap.NewNop())
+	p.Start()
+
+	for i := range 25 {
+		require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: fmt.Sprint(i)}))
+	}
+	require.NoError(t, p.Close(context.TODO()))
+
+	assert.Equal(t, 25, writer.written())
+	stats := p.Stats()
+	assert.Equal(t, uint64(25), stats.Enqueued)
+	assert.Equal(t, uint64(25), stats.Written)
+	assert.Equal(t, 0, stats.Backlog)
+
+	require.ErrorIs(t, p.Record(context.TODO(), models.RedirectLog{ID: "late"}), ErrClosed)
+}
+
+func TestPipeline_DropsWhenFull(t *testing.T) {
+	writer := &fakeWriter{block: make(chan struct{})}
+	cfg := testConfig()
+	cfg.BufferSize = 2
+	cfg.BatchSize = 1
+	p := NewPipeline(writer, cfg, zap.NewNop())
+	p.Start()
+
+	// The worker takes the first event and blocks in the writer, the next two fill the buffer.
+	require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: "1"}))
+	assert.Eventually(t, func() bool { return p.Stats().Backlog == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: "2"}))
+	require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: "3"}))
+
+	require.ErrorIs(t, p.Record(context.TODO(), models.RedirectLog{ID: "4"}), ErrBufferFull)
+	assert.Equal(t, uint64(1), p.Stats().Dropped)
+
+	close(writer.block)
+	require.NoError(t, p.Close(context.TODO()))
+	assert.Equal(t, 3, writer.written())
+}
+
+func TestPipeline_FallsBackToSingleWrites(t *testing.T) {
+	writer := &fakeWriter{batchErr: errors.New("batch failed"), rejectedID: "bad"}
+	p := NewPipeline(writer, testConfig(), zap.NewNop())
+	p.Start()
+
+	for _, id := range []string{"1", "bad", "2"} {
+		require.NoError(t, p.Record(context.TODO(), models.RedirectLog{ID: id}))
+	}
+	require.NoError(t, p.Close(context.TODO()))
+
+	assert.Len(t, writer.single, 2)
+	stats := p.Stats()
+	assert.Equal(t, uint64(1), stats.FailedBatches)
+	assert.Equal(t, uint64(1), stats.Failed)
+	assert.Equal(t, uint64(2), stats.Written)
+}
@@ -0,0 +1,22 @@
+package geoip
+
+import (
+	"context"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	// File is a MaxMind DB of the GeoIP2/GeoLite2 City or Country type, without
+	// it visits are not located.
+	File string `envconfig:"GEOIP_DATABASE"`
+	// ReloadInterval is how often File is checked for changes, zero disables reloading.
+	ReloadInterval time.Duration `envconfig:"GEOIP_RELOAD_INTERVAL" default:"1m"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.ReloadInterval, validation.Min(time.Duration(0))),
+	)
+}
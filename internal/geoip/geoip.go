@@ -0,0 +1,136 @@
+// Package geoip locates client addresses in a local MaxMind DB file.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"go.uber.org/zap"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// record holds the fields read from City and Country databases.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Locator looks up addresses in the database file of its Config. It is safe
+// for concurrent use, the database is swapped atomically on reload.
+type Locator struct {
+	cfg    Config
+	logger *zap.Logger
+	reader atomic.Pointer[maxminddb.Reader]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// New loads the database file of cfg, if any.
+func New(cfg Config, logger *zap.Logger) (*Locator, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	l := &Locator{cfg: cfg, logger: logger}
+	if cfg.File != "" {
+		if err := l.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Reload reads the database file again. On error the current database stays
+// in effect.
+func (l *Locator) Reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.cfg.File)
+	if err != nil {
+		return fmt.Errorf("stat GeoIP database: %w", err)
+	}
+	// The file is read into memory rather than mapped, so a lookup still using
+	// the previous database is not affected when the file is replaced.
+	data, err := os.ReadFile(l.cfg.File)
+	if err != nil {
+		return fmt.Errorf("read GeoIP database: %w", err)
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("GeoIP database %s: %w", l.cfg.File, err)
+	}
+	l.reader.Store(reader)
+	l.modTime = info.ModTime()
+	l.logger.Info("Loaded GeoIP database",
+		zap.String("type", reader.Metadata.DatabaseType),
+		zap.Time("built", time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC()))
+	return nil
+}
+
+// Watch reloads the database file whenever it changes until ctx is done.
+func (l *Locator) Watch(ctx context.Context) {
+	if l.cfg.File == "" || l.cfg.ReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(l.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !l.changed() {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				l.logger.Error("Failed to reload GeoIP database", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (l *Locator) changed() bool {
+	info, err := os.Stat(l.cfg.File)
+	if err != nil {
+		l.logger.Warn("Failed to stat GeoIP database", zap.Error(err))
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !info.ModTime().Equal(l.modTime)
+}
+
+// Locate returns the location of ip. Addresses that are invalid or not in the
+// database, and every address without a database, have an empty location.
+func (l *Locator) Locate(ip string) models.GeoLocation {
+	reader := l.reader.Load()
+	parsed := net.ParseIP(ip)
+	if reader == nil || parsed == nil {
+		return models.GeoLocation{}
+	}
+	var rec record
+	if err := reader.Lookup(parsed, &rec); err != nil {
+		l.logger.Warn("GeoIP lookup failed", zap.Error(err))
+		return models.GeoLocation{}
+	}
+	location := models.GeoLocation{Country: rec.Country.ISOCode, City: rec.City.Names["en"]}
+	if len(rec.Subdivisions) > 0 {
+		location.Region = rec.Subdivisions[0].Names["en"]
+	}
+	return location
+}
@@ -0,0 +1,93 @@
+package geoip
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// writeDatabase writes a City database to path that locates network in city.
+func writeDatabase(t *testing.T, path, network, country, region, city string) {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{
+		DatabaseType:            "GeoLite2-City",
+		IncludeReservedNetworks: true,
+	})
+	require.NoError(t, err)
+	_, ipNet, err := net.ParseCIDR(network)
+	require.NoError(t, err)
+	require.NoError(t, tree.Insert(ipNet, mmdbtype.Map{
+		"country": mmdbtype.Map{"iso_code": mmdbtype.String(country)},
+		"subdivisions": mmdbtype.Slice{
+			mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(region)}},
+		},
+		"city": mmdbtype.Map{"names": mmdbtype.Map{"en": mmdbtype.String(city)}},
+	}))
+
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = tree.WriteTo(file)
+	require.NoError(t, err)
+}
+
+func TestLocate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, "203.0.113.0/24", "DE", "Bavaria", "Munich")
+
+	locator, err := New(Config{File: path}, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.GeoLocation{Country: "DE", Region: "Bavaria", City: "Munich"}, locator.Locate("203.0.113.7"))
+	assert.Equal(t, models.GeoLocation{}, locator.Locate("198.51.100.1"))
+	assert.Equal(t, models.GeoLocation{}, locator.Locate("not an address"))
+}
+
+func TestLocate_NoDatabase(t *testing.T) {
+	locator, err := New(Config{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.GeoLocation{}, locator.Locate("203.0.113.7"))
+}
+
+func TestNew_InvalidDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o600))
+
+	_, err := New(Config{File: path}, nil)
+	require.Error(t, err)
+	_, err = New(Config{File: filepath.Join(t.TempDir(), "missing.mmdb")}, nil)
+	require.Error(t, err)
+}
+
+func TestWatch_ReloadsChangedDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	writeDatabase(t, path, "203.0.113.0/24", "DE", "Bavaria", "Munich")
+	locator, err := New(Config{File: path, ReloadInterval: 10 * time.Millisecond}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go locator.Watch(ctx)
+
+	// A broken database is reported and the current one stays in effect.
+	require.NoError(t, os.WriteFile(path, []byte("truncated"), 0o600))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "DE", locator.Locate("203.0.113.7").Country)
+
+	writeDatabase(t, path, "203.0.113.0/24", "FR", "Île-de-France", "Paris")
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)))
+	assert.Eventually(t, func() bool {
+		return locator.Locate("203.0.113.7").Country == "FR"
+	}, time.Second, 10*time.Millisecond)
+}
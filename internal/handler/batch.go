@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/service"
+	"github.com/vladislavprovich/url-shortener/internal/validator"
+	"go.uber.org/zap"
+)
+
+// ShortenURLs creates a batch of links. The response lists the outcome of
+// every item in request order. It is 200 unless an atomic batch failed, which
+// is answered with 422 and no link created.
+func (h *URLHandler) ShortenURLs(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("handler.ShortenURLs called")
+	var req models.BatchShortenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error("handler, failed to decode request body", zap.Error(err))
+		h.writeError(w, fmt.Errorf("%w: invalid request payload", models.ErrInvalidRequest))
+		return
+	}
+	maxItems := h.config.BatchMaxItems
+	if maxItems == 0 {
+		maxItems = maxBatchItems
+	}
+	if len(req.Items) == 0 || len(req.Items) > maxItems {
+		h.writeError(w, fmt.Errorf("%w: batch must contain between 1 and %d items", models.ErrInvalidRequest, maxItems))
+		return
+	}
+
+	// Invalid items are answered without reaching the service, valid ones
+	// keep track of their position in the request.
+	results := make([]service.BatchResult, len(req.Items))
+	valid := make([]models.ShortenRequest, 0, len(req.Items))
+	positions := make([]int, 0, len(req.Items))
+	for i, item := range req.Items {
+		if err := validator.Validate(item); err != nil {
+			results[i].Err = validationError(err)
+			continue
+		}
+		valid = append(valid, item)
+		positions = append(positions, i)
+	}
+
+	if req.Atomic && len(valid) < len(req.Items) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = models.ErrBatchAborted
+			}
+		}
+	} else if len(valid) > 0 {
+		created, err := h.service.CreateShortURLs(r.Context(), valid, req.Atomic)
+		if err != nil {
+			h.logger.Error("handler, failed to create short URL batch", zap.Error(err))
+			h.writeError(w, err)
+			return
+		}
+		for i, result := range created {
+			results[positions[i]] = result
+		}
+	}
+
+	response := h.batchResponse(results)
+	status := http.StatusOK
+	if req.Atomic && response.Failed > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	h.logger.Info("handler, short URL batch processed",
+		zap.Int("created", response.Created), zap.Int("failed", response.Failed))
+	writeJSON(w, status, response, h.logger)
+}
+
+func (h *URLHandler) batchResponse(results []service.BatchResult) models.BatchShortenResponse {
+	response := models.BatchShortenResponse{Results: make([]models.BatchItemResult, len(results))}
+	for i, result := range results {
+		item := models.BatchItemResult{Index: i}
+		if result.Err != nil {
+			status, body := errorResponse(result.Err)
+			if status >= http.StatusInternalServerError {
+				h.logger.Error("handler, batch item failed", zap.Int("index", i), zap.Error(result.Err))
+			}
+			item.Error = &body
+			response.Failed++
+		} else {
+			item.ShortURL = fmt.Sprintf("%s/%s", h.config.BaseURL, result.URL.ShortURL)
+			item.ExpiresAt = result.URL.ExpiredAt
+			response.Created++
+		}
+		response.Results[i] = item
+	}
+	return response
+}
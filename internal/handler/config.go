@@ -2,15 +2,47 @@ package handler
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
 )
 
+// maxBatchItems keeps the multi-row insert of a batch below the Postgres limit
+// of 65535 bind parameters.
+const maxBatchItems = 5000
+
 type Config struct {
 	Port        string `envconfig:"SERVER_PORT" default:"8080"`
 	BaseURL     string `envconfig:"BASE_URL" default:"http://localhost:8080"`
 	ReadTimeout int    `envconfig:"SERVER_READ_TIMEOUT" default:"15"`
 	RateLimit   int    `envconfig:"RATE_LIMIT" default:"100"`
+	// RedirectType is used for links that do not set their own redirect status.
+	RedirectType int `envconfig:"REDIRECT_TYPE" default:"302"`
+	// PermanentRedirectMaxAge is how long clients may cache 301 and 308
+	// redirects. Cached redirects bypass the server, so they are not counted
+	// and do not follow later edits of the link.
+	PermanentRedirectMaxAge time.Duration `envconfig:"REDIRECT_PERMANENT_MAX_AGE" default:"24h"`
+	// BatchMaxItems limits the number of links created by one batch request.
+	BatchMaxItems int `envconfig:"BATCH_MAX_ITEMS" default:"1000"`
+	// IdempotencyWindow is how long responses to requests with an
+	// Idempotency-Key header are kept for replay.
+	IdempotencyWindow time.Duration `envconfig:"IDEMPOTENCY_WINDOW" default:"24h"`
+	// IdempotencyLease is how long a request still running holds its key. A
+	// retry after the lease of an attempt that never finished runs again.
+	IdempotencyLease time.Duration `envconfig:"IDEMPOTENCY_LEASE" default:"1m"`
+	// PasswordMaxAttempts limits the password attempts per client and link
+	// within PasswordAttemptWindow.
+	PasswordMaxAttempts   int           `envconfig:"PASSWORD_MAX_ATTEMPTS" default:"5"`
+	PasswordAttemptWindow time.Duration `envconfig:"PASSWORD_ATTEMPT_WINDOW" default:"15m"`
+	// ExpiredFallbackURL and InactiveFallbackURL, if set, receive visitors of
+	// expired links and of links that are not active yet instead of an error.
+	ExpiredFallbackURL  string `envconfig:"FALLBACK_EXPIRED_URL"`
+	InactiveFallbackURL string `envconfig:"FALLBACK_INACTIVE_URL"`
+	// FallbackURL is the default for links without a fallback of their own,
+	// used for every reason without a more specific fallback above.
+	FallbackURL string `envconfig:"FALLBACK_URL"`
 }
 
 func (c Config) ValidateWithContext(ctx context.Context) error {
@@ -18,5 +50,16 @@ func (c Config) ValidateWithContext(ctx context.Context) error {
 		validation.Field(&c.Port, validation.Required),
 		validation.Field(&c.BaseURL, validation.Required),
 		validation.Field(&c.RateLimit, validation.Required, validation.Min(1)),
+		validation.Field(&c.RedirectType, validation.Required, validation.In(
+			http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect)),
+		validation.Field(&c.PermanentRedirectMaxAge, validation.Min(time.Duration(0))),
+		validation.Field(&c.IdempotencyWindow, validation.Required, validation.Min(time.Second)),
+		validation.Field(&c.IdempotencyLease, validation.Required, validation.Min(time.Second)),
+		validation.Field(&c.BatchMaxItems, validation.Required, validation.Min(1), validation.Max(maxBatchItems)),
+		validation.Field(&c.PasswordMaxAttempts, validation.Required, validation.Min(1)),
+		validation.Field(&c.PasswordAttemptWindow, validation.Required, validation.Min(time.Second)),
+		validation.Field(&c.ExpiredFallbackURL, is.URL),
+		validation.Field(&c.InactiveFallbackURL, is.URL),
+		validation.Field(&c.FallbackURL, is.URL),
 	)
 }
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// Stable error codes returned in models.ErrorResponse.
+const (
+	codeNotFound          = "not_found"
+	codeExpired           = "expired"
+	codeNotYetActive      = "not_yet_active"
+	codeDisabled          = "disabled"
+	codeExhausted         = "exhausted"
+	codeAliasTaken        = "alias_taken"
+	codeInvalidURL        = "invalid_url"
+	codeInvalidExpiration = "invalid_expiration"
+	codeInvalidRequest    = "invalid_request"
+	codeUnauthorized      = "unauthorized"
+	codeForbidden         = "forbidden"
+	codePasswordRequired  = "password_required"
+	codeInvalidPassword   = "invalid_password"
+	codeTooManyAttempts   = "too_many_attempts"
+	codeBlocked           = "blocked"
+	codeBatchAborted      = "aborted"
+	codeUnavailable       = "unavailable"
+	codeInternal          = "internal_error"
+)
+
+type errorMapping struct {
+	err    error
+	status int
+	code   string
+	// exposeDetail reports whether the wrapped error text may be shown to the
+	// client. Only input validation errors qualify, everything else could leak
+	// internals and is answered with the sentinel message alone.
+	exposeDetail bool
+}
+
+func errorMappings() []errorMapping {
+	return []errorMapping{
+		{err: models.ErrNotFound, status: http.StatusNotFound, code: codeNotFound},
+		{err: models.ErrExpired, status: http.StatusGone, code: codeExpired},
+		{err: models.ErrNotYetActive, status: http.StatusForbidden, code: codeNotYetActive},
+		{err: models.ErrDisabled, status: http.StatusGone, code: codeDisabled},
+		{err: models.ErrClickLimitReached, status: http.StatusGone, code: codeExhausted},
+		{err: models.ErrAliasTaken, status: http.StatusConflict, code: codeAliasTaken},
+		{err: models.ErrInvalidURL, status: http.StatusBadRequest, code: codeInvalidURL, exposeDetail: true},
+		{err: models.ErrInvalidExpiration, status: http.StatusBadRequest, code: codeInvalidExpiration, exposeDetail: true},
+		{err: models.ErrInvalidRequest, status: http.StatusBadRequest, code: codeInvalidRequest, exposeDetail: true},
+		{err: models.ErrUnauthorized, status: http.StatusUnauthorized, code: codeUnauthorized},
+		{err: models.ErrPasswordRequired, status: http.StatusUnauthorized, code: codePasswordRequired},
+		{err: models.ErrInvalidPassword, status: http.StatusUnauthorized, code: codeInvalidPassword},
+		{err: models.ErrTooManyAttempts, status: http.StatusTooManyRequests, code: codeTooManyAttempts},
+		{err: models.ErrForbidden, status: http.StatusForbidden, code: codeForbidden},
+		{err: models.ErrBlocked, status: http.StatusUnprocessableEntity, code: codeBlocked, exposeDetail: true},
+		{err: models.ErrBatchAborted, status: http.StatusUnprocessableEntity, code: codeBatchAborted},
+		{err: models.ErrCodeGenerationFailed, status: http.StatusServiceUnavailable, code: codeUnavailable},
+	}
+}
+
+// errorResponse maps err to an HTTP status and response body.
+func errorResponse(err error) (int, models.ErrorResponse) {
+	for _, m := range errorMappings() {
+		if !errors.Is(err, m.err) {
+			continue
+		}
+		message := m.err.Error()
+		if m.exposeDetail {
+			message = err.Error()
+		}
+		return m.status, models.ErrorResponse{Code: m.code, Message: message}
+	}
+	return http.StatusInternalServerError, models.ErrorResponse{
+		Code:    codeInternal,
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+}
+
+// writeError is the single place where handler errors are turned into responses.
+func (h *URLHandler) writeError(w http.ResponseWriter, err error) {
+	status, body := errorResponse(err)
+	if status >= http.StatusInternalServerError {
+		h.logger.Error("handler, request failed", zap.Error(err))
+	}
+	writeJSON(w, status, body, h.logger)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logger.Error("handler, failed to write response", zap.Error(err))
+	}
+}
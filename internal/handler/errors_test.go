@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		status   int
+		expected models.ErrorResponse
+	}{
+		{
+			name:     "not found hides wrapping context",
+			err:      fmt.Errorf("get short url, get url err:, %w", models.ErrNotFound),
+			status:   http.StatusNotFound,
+			expected: models.ErrorResponse{Code: codeNotFound, Message: "URL not found"},
+		},
+		{
+			name:     "expired",
+			err:      models.ErrExpired,
+			status:   http.StatusGone,
+			expected: models.ErrorResponse{Code: codeExpired, Message: "URL has expired"},
+		},
+		{
+			name:     "alias taken",
+			err:      models.ErrAliasTaken,
+			status:   http.StatusConflict,
+			expected: models.ErrorResponse{Code: codeAliasTaken, Message: "custom alias already in use"},
+		},
+		{
+			name:     "forbidden",
+			err:      fmt.Errorf("get url: %w", models.ErrForbidden),
+			status:   http.StatusForbidden,
+			expected: models.ErrorResponse{Code: codeForbidden, Message: "link belongs to another owner"},
+		},
+		{
+			name:     "too many password attempts",
+			err:      fmt.Errorf("get short url: %w", models.ErrTooManyAttempts),
+			status:   http.StatusTooManyRequests,
+			expected: models.ErrorResponse{Code: codeTooManyAttempts, Message: "too many wrong passwords, try again later"},
+		},
+		{
+			name:     "blocked destination keeps detail",
+			err:      fmt.Errorf("%w: host \"evil.example\" is blocked", models.ErrBlocked),
+			status:   http.StatusUnprocessableEntity,
+			expected: models.ErrorResponse{Code: codeBlocked, Message: `destination is blocked: host "evil.example" is blocked`},
+		},
+		{
+			name:     "validation errors keep detail",
+			err:      fmt.Errorf("%w: ttl must be positive", models.ErrInvalidExpiration),
+			status:   http.StatusBadRequest,
+			expected: models.ErrorResponse{Code: codeInvalidExpiration, Message: "invalid expiration: ttl must be positive"},
+		},
+		{
+			name:     "unknown errors are not leaked",
+			err:      errors.New("pq: connection refused"),
+			status:   http.StatusInternalServerError,
+			expected: models.ErrorResponse{Code: codeInternal, Message: "Internal Server Error"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := errorResponse(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.expected, body)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// maxPasswordFormBytes bounds the body of a password form submission.
+const maxPasswordFormBytes = 4 << 10
+
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<h1>This link is password protected</h1>
+{{if .Invalid}}<p role="alert">The password is not correct.</p>
+{{end}}<form method="post" action="{{.Action}}">
+<label for="password">Password</label>
+<input type="password" id="password" name="password" autocomplete="off" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// writePasswordPage asks for the password of a protected link, the form posts
+// back to UnlockLink.
+func (h *URLHandler) writePasswordPage(w http.ResponseWriter, shortURL string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(status)
+	data := struct {
+		Action  string
+		Invalid bool
+	}{
+		Action:  "/" + shortURL,
+		Invalid: status == http.StatusUnauthorized,
+	}
+	if err := passwordPage.Execute(w, data); err != nil {
+		h.logger.Error("handler, failed to write password page", zap.Error(err))
+	}
+}
+
+// UnlockLink follows a password protected link with the password submitted
+// by the form of writePasswordPage.
+func (h *URLHandler) UnlockLink(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("handler.UnlockLink called")
+	shortURL := chi.URLParam(r, "shortURL")
+	r.Body = http.MaxBytesReader(w, r.Body, maxPasswordFormBytes)
+	if err := r.ParseForm(); err != nil {
+		h.writeError(w, fmt.Errorf("%w: invalid form", models.ErrInvalidRequest))
+		return
+	}
+
+	url, err := h.service.UnlockURL(r.Context(), shortURL, r.PostForm.Get("password"))
+	switch {
+	case errors.Is(err, models.ErrInvalidPassword):
+		h.writePasswordPage(w, shortURL, http.StatusUnauthorized)
+		return
+	case errors.Is(err, models.ErrBlocked):
+		h.writeBlockedPage(w, shortURL)
+		return
+	case errors.Is(err, models.ErrTooManyAttempts):
+		h.logger.Warn("handler, too many wrong passwords", zap.String("short_url", shortURL))
+		h.writeError(w, err)
+		return
+	case h.redirectFallback(w, r, url, err):
+		return
+	case err != nil:
+		h.logger.Error("handler, failed to unlock URL", zap.Error(err))
+		h.writeError(w, err)
+		return
+	}
+
+	if err = h.service.LogRedirect(r.Context(), url.ShortURL, visit(r)); err != nil {
+		h.logger.Warn("handler, failed to log redirect", zap.Error(err))
+	}
+	// 303 turns the POST of the form into a GET of the destination.
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.Redirect(w, r, url.OriginalURL, http.StatusSeeOther)
+}
@@ -1,23 +1,103 @@
 package handler
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/vladislavprovich/url-shortener/internal/health"
+	"github.com/vladislavprovich/url-shortener/internal/metrics"
 	"github.com/vladislavprovich/url-shortener/internal/middleware"
 	"go.uber.org/zap"
 )
 
-func InitRouter(urlHandler *URLHandler, logger *zap.Logger, cfg Config) *chi.Mux {
+type routerOptions struct {
+	auth    func(http.Handler) http.Handler
+	metrics *metrics.Metrics
+	health  *health.Checker
+	// idempotency wraps the link creation routes.
+	idempotency []func(http.Handler) http.Handler
+}
+
+// RouterOption customizes the router created by InitRouter.
+type RouterOption func(*routerOptions)
+
+// WithAuth protects link creation, stats and link management with mw,
+// usually middleware.APIKeyAuth. Redirects stay public.
+func WithAuth(mw func(http.Handler) http.Handler) RouterOption {
+	return func(o *routerOptions) {
+		o.auth = mw
+	}
+}
+
+// WithMetrics instruments every request and serves m on /metrics.
+func WithMetrics(m *metrics.Metrics) RouterOption {
+	return func(o *routerOptions) {
+		o.metrics = m
+	}
+}
+
+// WithHealth serves the liveness and readiness probes of c on /healthz and /readyz.
+func WithHealth(c *health.Checker) RouterOption {
+	return func(o *routerOptions) {
+		o.health = c
+	}
+}
+
+// WithIdempotency replays retried link creations with mw, usually middleware.Idempotency.
+func WithIdempotency(mw func(http.Handler) http.Handler) RouterOption {
+	return func(o *routerOptions) {
+		o.idempotency = append(o.idempotency, mw)
+	}
+}
+
+func InitRouter(urlHandler *URLHandler, logger *zap.Logger, cfg Config, opts ...RouterOption) *chi.Mux {
+	var options routerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	r := chi.NewRouter()
+	var onRateLimited func(*http.Request)
+	if options.metrics != nil {
+		r.Use(options.metrics.Middleware)
+		onRateLimited = options.metrics.RateLimited
+	}
 	r.Use(chiMiddleware.Logger)
 	r.Use(middleware.Recoverer(logger))
 	r.Use(middleware.RequestLogger(logger))
 	r.Use(middleware.CORS)
-	r.Use(middleware.RateLimiter(cfg.RateLimit))
+	r.Use(middleware.RateLimiter(cfg.RateLimit, onRateLimited))
 
-	r.Post("/shorten", urlHandler.ShortenURL)
+	if options.metrics != nil {
+		r.Method(http.MethodGet, "/metrics", options.metrics.Handler())
+	}
+	if options.health != nil {
+		r.Get("/healthz", options.health.Live)
+		r.Get("/readyz", options.health.Ready)
+	}
 	r.Get("/{shortURL}", urlHandler.Redirect)
-	r.Get("/{shortURL}/stats", urlHandler.GetStats)
+	r.With(middleware.PasswordAttemptLimiter(cfg.PasswordMaxAttempts, cfg.PasswordAttemptWindow, onRateLimited)).
+		Post("/{shortURL}", urlHandler.UnlockLink)
+
+	r.Group(func(r chi.Router) {
+		if options.auth != nil {
+			r.Use(options.auth)
+		}
+
+		r.With(options.idempotency...).Post("/shorten", urlHandler.ShortenURL)
+		r.With(options.idempotency...).Post("/shorten/batch", urlHandler.ShortenURLs)
+		r.Get("/{shortURL}/stats", urlHandler.GetStats)
+		r.Get("/{shortURL}/stats/referrers", urlHandler.GetReferrers)
+
+		r.Route("/links/{shortURL}", func(r chi.Router) {
+			r.Get("/", urlHandler.GetLink)
+			r.Patch("/", urlHandler.UpdateLink)
+			r.Delete("/", urlHandler.DeleteLink)
+			r.Post("/disable", urlHandler.DisableLink)
+			r.Post("/enable", urlHandler.EnableLink)
+		})
+	})
 
 	return r
 }
@@ -0,0 +1,571 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/health"
+	"github.com/vladislavprovich/url-shortener/internal/middleware"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/policy"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+	"github.com/vladislavprovich/url-shortener/internal/service"
+	"go.uber.org/zap"
+)
+
+func newTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	return InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+}
+
+func doRequest(t *testing.T, router http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&v))
+	return v
+}
+
+func TestRouter_ShortenAndRedirect(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "http://sho.rt/abc", decode[models.ShortenResponse](t, rec).ShortURL)
+
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com/", rec.Header().Get("Location"))
+
+	rec = doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.org","custom_alias":"abc"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, codeAliasTaken, decode[models.ErrorResponse](t, rec).Code)
+
+	rec = doRequest(t, router, http.MethodPost, "/shorten", `{"url":"not a url"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, codeInvalidURL, decode[models.ErrorResponse](t, rec).Code)
+
+	rec = doRequest(t, router, http.MethodPost, "/shorten", `{"url":"javascript:alert(1)"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, codeInvalidURL, decode[models.ErrorResponse](t, rec).Code)
+
+	rec = doRequest(t, router, http.MethodGet, "/missing", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRouter_LinkManagement(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, router, http.MethodGet, "/links/abc", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://example.com/", decode[models.URL](t, rec).OriginalURL)
+
+	rec = doRequest(t, router, http.MethodPatch, "/links/abc", `{"url":"https://example.org"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	long := strings.Repeat("a", 31)
+	rec = doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"`+long+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(t, router, http.MethodPatch, "/links/abc", `{"custom_alias":"`+long+`"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// Short passwords are rejected as on creation, an empty one removes the password.
+	rec = doRequest(t, router, http.MethodPatch, "/links/abc", `{"password":"abc"}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(t, router, http.MethodPatch, "/links/abc", `{"password":"abcd"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodPatch, "/links/abc", `{"password":""}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	assert.Equal(t, "https://example.org/", rec.Header().Get("Location"))
+
+	rec = doRequest(t, router, http.MethodPost, "/links/abc/disable", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, decode[models.URL](t, rec).Disabled)
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	rec = doRequest(t, router, http.MethodPost, "/links/abc/enable", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	rec = doRequest(t, router, http.MethodDelete, "/links/abc", "")
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/links/abc", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestRouter_APIKeyAuth(t *testing.T) {
+	ctx := context.Background()
+	keys := auth.NewService(memory.NewAPIKeyRepository(), zap.NewNop())
+	_, aliceKey, err := keys.CreateKey(ctx, "alice", "")
+	require.NoError(t, err)
+	_, bobKey, err := keys.CreateKey(ctx, "bob", "")
+	require.NoError(t, err)
+
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg,
+		WithAuth(middleware.APIKeyAuth(keys, zap.NewNop())))
+
+	doAuthRequest := func(method, target, body, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := doAuthRequest(http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`, "")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, codeUnauthorized, decode[models.ErrorResponse](t, rec).Code)
+	rec = doAuthRequest(http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`, "usk_wrong")
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = doAuthRequest(http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`, aliceKey)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doAuthRequest(http.MethodGet, "/abc", "", "")
+	assert.Equal(t, http.StatusFound, rec.Code, "redirects stay public")
+
+	rec = doAuthRequest(http.MethodGet, "/abc/stats", "", aliceKey)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doAuthRequest(http.MethodGet, "/links/abc", "", aliceKey)
+	require.Equal(t, http.StatusOK, rec.Code)
+	owner := decode[models.URL](t, rec).OwnerID
+	require.NotNil(t, owner)
+	assert.Equal(t, "alice", *owner)
+
+	rec = doAuthRequest(http.MethodGet, "/abc/stats", "", bobKey)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doAuthRequest(http.MethodDelete, "/links/abc", "", bobKey)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = doAuthRequest(http.MethodDelete, "/links/abc", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestRouter_HealthProbes(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	checker := health.NewChecker(health.Config{ReadinessTimeout: time.Second}, zap.NewNop())
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg, WithHealth(checker))
+
+	rec := doRequest(t, router, http.MethodGet, "/healthz", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/readyz", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// The probe paths must never be handed out as short codes.
+	rec = doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"healthz"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	checker.SetShuttingDown()
+	rec = doRequest(t, router, http.MethodGet, "/readyz", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestRouter_RedirectTypes(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000, RedirectType: http.StatusMovedPermanently,
+		PermanentRedirectMaxAge: time.Hour}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"perm"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodPost, "/shorten",
+		`{"url":"https://example.com","custom_alias":"temp","redirect_type":307}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodPost, "/shorten",
+		`{"url":"https://example.com","custom_alias":"bad","redirect_type":303}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = doRequest(t, router, http.MethodGet, "/perm", "")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "public, max-age=3600", rec.Header().Get("Cache-Control"))
+
+	rec = doRequest(t, router, http.MethodGet, "/temp", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, rec.Code)
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+
+	rec = doRequest(t, router, http.MethodPatch, "/links/temp", `{"redirect_type":0}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/temp", "")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code, "reset to the server default")
+}
+
+func TestRouter_DestinationPolicy(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	destinations, err := policy.New(policy.Config{}, zap.NewNop(), policy.WithSelfURLs(cfg.BaseURL))
+	require.NoError(t, err)
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop(), service.WithPolicy(destinations))
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+
+	for _, destination := range []string{"http://sho.rt/abc", "http://127.0.0.1:8080/admin"} {
+		rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"`+destination+`"}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, destination)
+		assert.Equal(t, codeBlocked, decode[models.ErrorResponse](t, rec).Code)
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	_, err = srv.SetBlocked(context.Background(), "abc", true)
+	require.NoError(t, err)
+
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "This link has been blocked")
+}
+
+func TestRouter_ClickLimit(t *testing.T) {
+	router := newTestRouter(t)
+
+	for _, limit := range []string{"0", "-1"} {
+		rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","max_clicks":`+limit+`}`)
+		require.Equal(t, http.StatusBadRequest, rec.Code, limit)
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten",
+		`{"url":"https://example.com","custom_alias":"once","max_clicks":1}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, router, http.MethodGet, "/once/stats", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	stats := decode[models.StatsResponse](t, rec)
+	require.NotNil(t, stats.RemainingClicks)
+	assert.Equal(t, 1, *stats.RemainingClicks)
+
+	rec = doRequest(t, router, http.MethodGet, "/once", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/once", "")
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.Equal(t, codeExhausted, decode[models.ErrorResponse](t, rec).Code)
+}
+
+func TestRouter_PasswordProtected(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000, PasswordMaxAttempts: 2, PasswordAttemptWindow: time.Hour}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+	unlock := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/locked", strings.NewReader("password="+password))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten",
+		`{"url":"https://example.com","custom_alias":"locked","password":"ab"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = doRequest(t, router, http.MethodPost, "/shorten",
+		`{"url":"https://example.com","custom_alias":"locked","password":"secret"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doRequest(t, router, http.MethodGet, "/locked", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+	assert.Contains(t, rec.Body.String(), `action="/locked"`)
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+
+	rec = unlock("wrong")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "not correct")
+
+	rec = unlock("secret")
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "https://example.com/", rec.Header().Get("Location"))
+
+	// Two attempts used up the limit, even the right password is throttled now.
+	rec = unlock("secret")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func TestRouter_ActivationWindow(t *testing.T) {
+	repo := memory.NewURLRepository()
+	srv := service.NewURLService(repo, zap.NewNop())
+	launch := time.Now().Add(time.Hour)
+	expired := time.Now().Add(-time.Hour)
+	require.NoError(t, repo.SaveURL(context.Background(),
+		models.URL{ID: "1", ShortURL: "soon", OriginalURL: "https://example.com/", ActivatesAt: &launch}))
+	require.NoError(t, repo.SaveURL(context.Background(),
+		models.URL{ID: "2", ShortURL: "gone", OriginalURL: "https://example.com/", ExpiredAt: &expired}))
+
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+	rec := doRequest(t, router, http.MethodGet, "/soon", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, codeNotYetActive, decode[models.ErrorResponse](t, rec).Code)
+	rec = doRequest(t, router, http.MethodGet, "/gone", "")
+	assert.Equal(t, http.StatusGone, rec.Code)
+
+	cfg.InactiveFallbackURL = "https://example.com/coming-soon"
+	cfg.ExpiredFallbackURL = "https://example.com/over"
+	router = InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+	rec = doRequest(t, router, http.MethodGet, "/soon", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, cfg.InactiveFallbackURL, rec.Header().Get("Location"))
+	assert.Equal(t, "private, no-store", rec.Header().Get("Cache-Control"))
+	rec = doRequest(t, router, http.MethodGet, "/gone", "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, cfg.ExpiredFallbackURL, rec.Header().Get("Location"))
+}
+
+func TestRouter_Fallback(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000, FallbackURL: "https://example.com/default"}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg)
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten",
+		`{"url":"https://example.com","custom_alias":"once","max_clicks":1,"fallback_url":"https://example.com/sold-out"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/once", "")
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com/", rec.Header().Get("Location"))
+	rec = doRequest(t, router, http.MethodGet, "/once", "")
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://example.com/sold-out", rec.Header().Get("Location"))
+
+	// Visits sent to the fallback are not counted as redirects.
+	rec = doRequest(t, router, http.MethodGet, "/once/stats", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, decode[models.StatsResponse](t, rec).RedirectCount)
+
+	// Without a fallback of its own the server default is used.
+	rec = doRequest(t, router, http.MethodPatch, "/links/once", `{"fallback_url":""}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, decode[models.URL](t, rec).FallbackURL)
+	rec = doRequest(t, router, http.MethodPost, "/links/once/disable", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/once", "")
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, cfg.FallbackURL, rec.Header().Get("Location"))
+}
+
+func TestRouter_StatsSeries(t *testing.T) {
+	router := newTestRouter(t)
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	rec = doRequest(t, router, http.MethodGet, "/abc", "")
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	now := time.Now().In(time.UTC)
+	from := now.Add(-48 * time.Hour).Format(time.RFC3339)
+	rec = doRequest(t, router, http.MethodGet, "/abc/stats?granularity=hour&tz=Asia/Kolkata&from="+from, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	stats := decode[models.StatsResponse](t, rec)
+	assert.Equal(t, "Asia/Kolkata", stats.TimeZone)
+	require.Len(t, stats.Series, 49)
+	last := stats.Series[len(stats.Series)-1]
+	assert.Equal(t, 1, last.Clicks)
+	// Kolkata is offset by half an hour, so are its hour buckets.
+	assert.Equal(t, 30, last.Start.UTC().Minute())
+
+	rec = doRequest(t, router, http.MethodGet, "/abc/stats", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, decode[models.StatsResponse](t, rec).Series)
+
+	for _, query := range []string{"granularity=minute", "tz=Mars/Olympus", "from=yesterday"} {
+		rec = doRequest(t, router, http.MethodGet, "/abc/stats?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestRouter_Referrers(t *testing.T) {
+	router := newTestRouter(t)
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	for _, referrer := range []string{"https://News.example/a", "https://news.example/b", "", "https://blog.example/"} {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.Header.Set("Referer", referrer)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/abc/stats", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	stats := decode[models.StatsResponse](t, rec)
+	assert.Equal(t, []models.ReferrerCount{
+		{Referrer: "news.example", Clicks: 2},
+		{Referrer: "blog.example", Clicks: 1},
+		{Referrer: "direct", Clicks: 1},
+	}, stats.ReferrerHosts)
+	assert.Len(t, stats.ReferrerURLs, 4)
+
+	rec = doRequest(t, router, http.MethodGet, "/abc/stats/referrers?group=url&limit=1&offset=1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	page := decode[models.ReferrerPage](t, rec)
+	assert.Equal(t, 4, page.Total)
+	assert.Equal(t, []models.ReferrerCount{{Referrer: "https://News.example/a", Clicks: 1}}, page.Items)
+
+	for _, query := range []string{"group=path", "limit=1000", "offset=-1", "limit=ten"} {
+		rec = doRequest(t, router, http.MethodGet, "/abc/stats/referrers?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestRouter_UserAgents(t *testing.T) {
+	router := newTestRouter(t)
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com","custom_alias":"abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	for _, userAgent := range []string{
+		"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+		"Mozilla/5.0 (Android 14; Mobile; rv:125.0) Gecko/125.0 Firefox/125.0",
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		"curl/8.5.0",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+		req.Header.Set("User-Agent", userAgent)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/abc/stats", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	stats := decode[models.StatsResponse](t, rec)
+	assert.Equal(t, 2, stats.RedirectCount)
+	assert.Equal(t, 2, stats.BotCount)
+	assert.Equal(t, []models.DimensionCount{{Value: "Firefox", Clicks: 2}}, stats.Browsers)
+	assert.Equal(t, []models.DimensionCount{{Value: "Android", Clicks: 1}, {Value: "Linux", Clicks: 1}},
+		stats.OperatingSystems)
+	assert.Equal(t, []models.DimensionCount{{Value: "desktop", Clicks: 1}, {Value: "mobile", Clicks: 1}}, stats.Devices)
+	assert.Len(t, stats.ReferrerHosts, 1)
+}
+
+func TestRedirectCacheControl_CappedByExpiration(t *testing.T) {
+	h := NewURLHandler(nil, zap.NewNop(), Config{PermanentRedirectMaxAge: 24 * time.Hour})
+	now := time.Now()
+	soon := now.Add(10 * time.Minute)
+	expired := now.Add(-time.Minute)
+
+	assert.Equal(t, "public, max-age=600",
+		h.redirectCacheControl(models.URL{ExpiredAt: &soon}, http.StatusPermanentRedirect, now))
+	assert.Equal(t, "private, no-store",
+		h.redirectCacheControl(models.URL{ExpiredAt: &expired}, http.StatusPermanentRedirect, now))
+	assert.Equal(t, "public, max-age=86400",
+		h.redirectCacheControl(models.URL{}, http.StatusMovedPermanently, now))
+	limit := 5
+	assert.Equal(t, "private, no-store",
+		h.redirectCacheControl(models.URL{MaxClicks: &limit}, http.StatusMovedPermanently, now))
+}
+
+func TestRouter_ShortenBatch(t *testing.T) {
+	router := newTestRouter(t)
+
+	rec := doRequest(t, router, http.MethodPost, "/shorten/batch", `{"items":[
+		{"url":"https://example.com","custom_alias":"one"},
+		{"url":"not a url"},
+		{"url":"https://example.org","custom_alias":"one"}
+	]}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	response := decode[models.BatchShortenResponse](t, rec)
+	assert.Equal(t, 1, response.Created)
+	assert.Equal(t, 2, response.Failed)
+	require.Len(t, response.Results, 3)
+	assert.Equal(t, "http://sho.rt/one", response.Results[0].ShortURL)
+	assert.Equal(t, codeInvalidURL, response.Results[1].Error.Code)
+	assert.Equal(t, codeAliasTaken, response.Results[2].Error.Code)
+
+	rec = doRequest(t, router, http.MethodPost, "/shorten/batch", `{"atomic":true,"items":[
+		{"url":"https://example.com","custom_alias":"two"},
+		{"url":"https://example.org","custom_alias":"one"}
+	]}`)
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	response = decode[models.BatchShortenResponse](t, rec)
+	assert.Equal(t, 0, response.Created)
+	assert.Equal(t, codeBatchAborted, response.Results[0].Error.Code)
+	assert.Equal(t, codeAliasTaken, response.Results[1].Error.Code)
+	rec = doRequest(t, router, http.MethodGet, "/two", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(t, router, http.MethodPost, "/shorten/batch", `{"items":[]}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRouter_IdempotentShorten(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg,
+		WithIdempotency(middleware.Idempotency(memory.NewIdempotencyRepository(), time.Hour, time.Minute, zap.NewNop())))
+
+	shorten := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := shorten("key-1", `{"url":"https://example.com"}`)
+	require.Equal(t, http.StatusOK, first.Code)
+	firstURL := decode[models.ShortenResponse](t, first).ShortURL
+
+	retry := shorten("key-1", `{"url":"https://example.com"}`)
+	require.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(middleware.IdempotentReplayedHeader))
+	assert.Equal(t, firstURL, decode[models.ShortenResponse](t, retry).ShortURL)
+
+	reused := shorten("key-1", `{"url":"https://example.org"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, "idempotency_key_reused", decode[models.ErrorResponse](t, reused).Code)
+
+	other := shorten("key-2", `{"url":"https://example.com"}`)
+	require.Equal(t, http.StatusOK, other.Code)
+	assert.NotEqual(t, firstURL, decode[models.ShortenResponse](t, other).ShortURL)
+
+	// Without a key every request creates a new link.
+	rec := doRequest(t, router, http.MethodPost, "/shorten", `{"url":"https://example.com"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(middleware.IdempotentReplayedHeader))
+}
+
+func TestRouter_IdempotencyStaleClaim(t *testing.T) {
+	cfg := Config{BaseURL: "http://sho.rt", RateLimit: 1000}
+	srv := service.NewURLService(memory.NewURLRepository(), zap.NewNop())
+	keys := memory.NewIdempotencyRepository()
+	router := InitRouter(NewURLHandler(srv, zap.NewNop(), cfg), zap.NewNop(), cfg,
+		WithIdempotency(middleware.Idempotency(keys, time.Hour, time.Minute, zap.NewNop())))
+
+	shorten := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set(middleware.IdempotencyKeyHeader, key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A claim left behind by an attempt that died is reclaimed once its lease
+	// has run out instead of blocking the key for the whole window.
+	createdAt := time.Now().Add(-2 * time.Minute)
+	_, claimed, err := keys.ClaimIdempotencyKey(context.Background(), models.IdempotencyRecord{
+		Scope: " /shorten", Key: "key", Fingerprint: "stale", CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Minute),
+	})
+	require.NoError(t, err)
+	require.True(t, claimed)
+	assert.Equal(t, http.StatusOK, shorten("key", `{"url":"https://example.com"}`).Code)
+
+	tooLarge := shorten("key-large", `{"url":"https://example.com/`+strings.Repeat("a", 9<<20)+`"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, tooLarge.Code)
+}
@@ -2,14 +2,20 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	playground "github.com/go-playground/validator/v10"
 	_ "github.com/lib/pq"
 	"github.com/vladislavprovich/url-shortener/internal/models"
 	"github.com/vladislavprovich/url-shortener/internal/service"
 	"github.com/vladislavprovich/url-shortener/internal/validator"
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
 	"go.uber.org/zap"
 )
 
@@ -32,69 +38,296 @@ func (h *URLHandler) ShortenURL(w http.ResponseWriter, r *http.Request) {
 	var req models.ShortenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Error("handler, failed to decode request body", zap.Error(err))
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		h.writeError(w, fmt.Errorf("%w: invalid request payload", models.ErrInvalidRequest))
 		return
 	}
 
 	if err := validator.Validate(req); err != nil {
 		h.logger.Warn("handler, validation failed", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeError(w, validationError(err))
 		return
 	}
 
-	shortURL, err := h.service.CreateShortURL(r.Context(), req)
+	url, err := h.service.CreateShortURL(r.Context(), req)
 	if err != nil {
 		h.logger.Error("handler, failed to create short URL", zap.Error(err))
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, err)
 		return
 	}
 
 	response := models.ShortenResponse{
-		ShortURL: fmt.Sprintf("%s/%s", h.config.BaseURL, shortURL),
+		ShortURL:  fmt.Sprintf("%s/%s", h.config.BaseURL, url.ShortURL),
+		ExpiresAt: url.ExpiredAt,
 	}
 
 	h.logger.Info("handler, short URL created", zap.String("short_url", response.ShortURL))
 
-	w.Header().Set("Content-Type", "application/json")
-	if err = json.NewEncoder(w).Encode(response); err != nil {
-		h.logger.Error("handler, failed to write response", zap.Error(err))
-	}
+	writeJSON(w, http.StatusOK, response, h.logger)
 }
 
 func (h *URLHandler) Redirect(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("handler.Redirect called")
 	shortURL := chi.URLParam(r, "shortURL")
-	originalURL, err := h.service.GetOriginalURL(r.Context(), shortURL)
+	url, err := h.service.ResolveURL(r.Context(), shortURL)
+	if errors.Is(err, models.ErrBlocked) {
+		h.writeBlockedPage(w, shortURL)
+		return
+	}
+	if errors.Is(err, models.ErrPasswordRequired) {
+		h.writePasswordPage(w, shortURL, http.StatusOK)
+		return
+	}
+	if h.redirectFallback(w, r, url, err) {
+		return
+	}
 	if err != nil {
 		h.logger.Error("handler, failed to get original URL", zap.Error(err))
-		http.Error(w, "URL not found", http.StatusNotFound)
+		h.writeError(w, err)
 		return
 	}
 
-	referrer := r.Referer()
-	h.logger.Info("handler, referrer ", zap.String("referrer", referrer))
-	err = h.service.LogRedirect(r.Context(), shortURL, referrer)
-	if err != nil {
-		h.logger.Error("handler, failed to redirect", zap.Error(err))
-		http.Error(w, "LogRedirect error", http.StatusNotFound)
-		return
+	h.logger.Info("handler, referrer ", zap.String("referrer", r.Referer()))
+	// Log under the short URL, shortURL may be an alias. A lost click must
+	// never turn a valid redirect into an error.
+	if err = h.service.LogRedirect(r.Context(), url.ShortURL, visit(r)); err != nil {
+		h.logger.Warn("handler, failed to log redirect", zap.Error(err))
 	}
 	h.logger.Info("handler, redirect successfully")
-	http.Redirect(w, r, originalURL, http.StatusFound)
+	status := h.redirectStatus(url)
+	w.Header().Set("Cache-Control", h.redirectCacheControl(url, status, time.Now()))
+	http.Redirect(w, r, url.OriginalURL, status)
+}
+
+// visit describes the client of r for the redirect log.
+func visit(r *http.Request) service.Visit {
+	return service.Visit{Referrer: r.Referer(), UserAgent: r.UserAgent(), ClientIP: clientIP(r)}
+}
+
+// clientIP returns the address of the peer of r. Behind a proxy that is the
+// proxy, unless a middleware such as chi's RealIP rewrote RemoteAddr.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// redirectFallback sends the visitor of a link that cannot be followed because
+// of err to a fallback URL and records the visit with the error code as
+// reason. It reports whether a fallback was used.
+func (h *URLHandler) redirectFallback(w http.ResponseWriter, r *http.Request, url models.URL, err error) bool {
+	reason, fallback := h.fallbackURL(url, err)
+	if fallback == "" {
+		return false
+	}
+	h.logger.Info("handler, redirecting to fallback", zap.String("short_url", url.ShortURL), zap.String("reason", reason))
+	if err = h.service.LogFallback(r.Context(), url.ShortURL, visit(r), reason); err != nil {
+		h.logger.Warn("handler, failed to log fallback", zap.Error(err))
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.Redirect(w, r, fallback, http.StatusFound)
+	return true
+}
+
+// fallbackURL returns the reason and destination of a fallback for err. The
+// fallback of the link comes first, then the server default for the reason.
+func (h *URLHandler) fallbackURL(url models.URL, err error) (string, string) {
+	var reason, fallback string
+	switch {
+	case errors.Is(err, models.ErrExpired):
+		reason, fallback = codeExpired, h.config.ExpiredFallbackURL
+	case errors.Is(err, models.ErrNotYetActive):
+		reason, fallback = codeNotYetActive, h.config.InactiveFallbackURL
+	case errors.Is(err, models.ErrDisabled):
+		reason = codeDisabled
+	case errors.Is(err, models.ErrClickLimitReached):
+		reason = codeExhausted
+	default:
+		return "", ""
+	}
+	switch {
+	case url.FallbackURL != "":
+		return reason, url.FallbackURL
+	case fallback != "":
+		return reason, fallback
+	default:
+		return reason, h.config.FallbackURL
+	}
+}
+
+func (h *URLHandler) redirectStatus(url models.URL) int {
+	if url.RedirectType != 0 {
+		return url.RedirectType
+	}
+	if h.config.RedirectType != 0 {
+		return h.config.RedirectType
+	}
+	return http.StatusFound
+}
+
+// redirectCacheControl lets clients cache permanent redirects for at most
+// PermanentRedirectMaxAge and never beyond the expiration of the link.
+// Temporary redirects and links with a click limit must not be cached so
+// every click reaches the server.
+func (h *URLHandler) redirectCacheControl(url models.URL, status int, now time.Time) string {
+	const noCache = "private, no-store"
+	if status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect || url.MaxClicks != nil {
+		return noCache
+	}
+	maxAge := h.config.PermanentRedirectMaxAge
+	if url.ExpiredAt != nil && url.ExpiredAt.Sub(now) < maxAge {
+		maxAge = url.ExpiredAt.Sub(now)
+	}
+	if maxAge < time.Second {
+		return noCache
+	}
+	return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
 }
 
 func (h *URLHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("handler.GetStats called")
 	shortURL := chi.URLParam(r, "shortURL")
-	stats, err := h.service.GetStats(r.Context(), shortURL)
+	query, err := parseStatsQuery(r)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	stats, err := h.service.GetStats(r.Context(), shortURL, query)
 	if err != nil {
 		h.logger.Error("handler, failed to get stats", zap.Error(err))
-		http.Error(w, "URL not found", http.StatusNotFound)
+		h.writeError(w, err)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err = json.NewEncoder(w).Encode(stats); err != nil {
-		h.logger.Error("handler, failed to write response", zap.Error(err))
+	writeJSON(w, http.StatusOK, stats, h.logger)
+}
+
+// GetReferrers pages through the referrers of a link: group (host or url),
+// limit and offset.
+func (h *URLHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("handler.GetReferrers called")
+	params := r.URL.Query()
+	query := models.ReferrerQuery{Group: params.Get("group")}
+	for name, target := range map[string]*int{"limit": &query.Limit, "offset": &query.Offset} {
+		if value := params.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				h.writeError(w, fmt.Errorf("%w: %s must be a number", models.ErrInvalidRequest, name))
+				return
+			}
+			*target = n
+		}
+	}
+
+	page, err := h.service.GetReferrers(r.Context(), chi.URLParam(r, "shortURL"), query)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page, h.logger)
+}
+
+func (h *URLHandler) GetLink(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("handler.GetLink called")
+	url, err := h.service.GetURL(r.Context(), chi.URLParam(r, "shortURL"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, url, h.logger)
+}
+
+func (h *URLHandler) UpdateLink(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("handler.UpdateLink called")
+	var req models.UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error("handler, failed to decode request body", zap.Error(err))
+		h.writeError(w, fmt.Errorf("%w: invalid request payload", models.ErrInvalidRequest))
+		return
+	}
+	if err := validator.Validate(req); err != nil {
+		h.logger.Warn("handler, validation failed", zap.Error(err))
+		h.writeError(w, validationError(err))
+		return
+	}
+
+	url, err := h.service.UpdateURL(r.Context(), chi.URLParam(r, "shortURL"), req)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, url, h.logger)
+}
+
+func (h *URLHandler) DisableLink(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+func (h *URLHandler) EnableLink(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *URLHandler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	h.logger.Info("handler.setDisabled called", zap.Bool("disabled", disabled))
+	url, err := h.service.SetDisabled(r.Context(), chi.URLParam(r, "shortURL"), disabled)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, url, h.logger)
+}
+
+func (h *URLHandler) DeleteLink(w http.ResponseWriter, r *http.Request) {
+	h.logger.Info("handler.DeleteLink called")
+	if err := h.service.DeleteURL(r.Context(), chi.URLParam(r, "shortURL")); err != nil {
+		h.writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseStatsQuery reads the click time series parameters of GetStats: from
+// and to as RFC 3339 timestamps, granularity and tz, an IANA time zone name.
+func parseStatsQuery(r *http.Request) (models.StatsQuery, error) {
+	var query models.StatsQuery
+	params := r.URL.Query()
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		if value := params.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return query, fmt.Errorf("%w: %s must be an RFC 3339 timestamp", models.ErrInvalidRequest, name)
+			}
+			*target = t
+		}
+	}
+	if value := params.Get("granularity"); value != "" {
+		granularity, err := timebucket.Parse(value)
+		if err != nil {
+			return query, fmt.Errorf("%w: %w", models.ErrInvalidRequest, err)
+		}
+		query.Granularity = granularity
+	}
+	if value := params.Get("tz"); value != "" {
+		loc, err := time.LoadLocation(value)
+		if err != nil || value == "Local" {
+			return query, fmt.Errorf("%w: unknown time zone %q", models.ErrInvalidRequest, value)
+		}
+		query.Location = loc
+	}
+	return query, nil
+}
+
+// validationError wraps validator errors into domain errors, singling out a
+// malformed destination URL.
+func validationError(err error) error {
+	var validationErrs playground.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, fieldErr := range validationErrs {
+			if fieldErr.StructField() == "URL" {
+				return fmt.Errorf("%w: %q", models.ErrInvalidURL, fieldErr.Value())
+			}
+		}
 	}
+	return fmt.Errorf("%w: %w", models.ErrInvalidRequest, err)
 }
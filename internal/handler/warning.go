@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+var blockedPage = template.Must(template.New("blocked").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>Link blocked</title>
+</head>
+<body>
+<h1>This link has been blocked</h1>
+<p>The destination of {{.}} was reported as unsafe, for example as phishing or malware, and is not opened.</p>
+</body>
+</html>
+`))
+
+// writeBlockedPage answers a redirect to a blocked link with a warning page
+// instead of the destination.
+func (h *URLHandler) writeBlockedPage(w http.ResponseWriter, shortURL string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusForbidden)
+	if err := blockedPage.Execute(w, h.config.BaseURL+"/"+shortURL); err != nil {
+		h.logger.Error("handler, failed to write blocked page", zap.Error(err))
+	}
+}
@@ -0,0 +1,23 @@
+package health
+
+import (
+	"context"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	// ReadinessTimeout bounds all dependency checks of a single readiness probe.
+	ReadinessTimeout time.Duration `envconfig:"HEALTH_READINESS_TIMEOUT" default:"2s"`
+	// ShutdownDelay keeps serving requests after readiness turned negative so
+	// load balancers can stop routing traffic before the listener closes.
+	ShutdownDelay time.Duration `envconfig:"HEALTH_SHUTDOWN_DELAY" default:"0s"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.ReadinessTimeout, validation.Required, validation.Min(time.Millisecond)),
+		validation.Field(&c.ShutdownDelay, validation.Min(time.Duration(0))),
+	)
+}
@@ -0,0 +1,194 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vladislavprovich/url-shortener/internal/clicklog"
+	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
+)
+
+const (
+	StatusOK       = "ok"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+	StatusFailing  = "failing"
+)
+
+// Pinger is satisfied by *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// MigrationReporter is satisfied by *postgres.Migrator.
+type MigrationReporter interface {
+	Status(ctx context.Context) ([]postgres.MigrationStatus, error)
+}
+
+// PipelineReporter is satisfied by *clicklog.Pipeline.
+type PipelineReporter interface {
+	Stats() clicklog.Stats
+}
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Applied *int   `json:"applied,omitempty"`
+	Pending *int   `json:"pending,omitempty"`
+	Backlog *int   `json:"backlog,omitempty"`
+}
+
+// Report is the body of the readiness response.
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker serves the liveness and readiness probes.
+type Checker struct {
+	config     Config
+	logger     *zap.Logger
+	db         Pinger
+	migrations MigrationReporter
+	pipeline   PipelineReporter
+
+	shuttingDown atomic.Bool
+}
+
+// Option customizes the Checker created by NewChecker.
+type Option func(*Checker)
+
+// WithDatabase makes readiness depend on db answering a ping.
+func WithDatabase(db Pinger) Option {
+	return func(c *Checker) {
+		c.db = db
+	}
+}
+
+// WithMigrations makes readiness depend on all migrations being applied.
+func WithMigrations(migrations MigrationReporter) Option {
+	return func(c *Checker) {
+		c.migrations = migrations
+	}
+}
+
+// WithPipeline reports the redirect log backlog. It never fails readiness.
+func WithPipeline(pipeline PipelineReporter) Option {
+	return func(c *Checker) {
+		c.pipeline = pipeline
+	}
+}
+
+func NewChecker(cfg Config, logger *zap.Logger, opts ...Option) *Checker {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	c := &Checker{config: cfg, logger: logger}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// SetShuttingDown makes every following readiness probe fail.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Live reports that the process is up. It deliberately checks no
+// dependencies, a failing database must not get the process restarted.
+func (c *Checker) Live(w http.ResponseWriter, _ *http.Request) {
+	c.write(w, http.StatusOK, Report{Status: StatusOK})
+}
+
+// Ready reports whether the instance should receive traffic.
+func (c *Checker) Ready(w http.ResponseWriter, r *http.Request) {
+	report := c.Check(r.Context())
+	status := http.StatusOK
+	if report.Status != StatusReady {
+		status = http.StatusServiceUnavailable
+	}
+	c.write(w, status, report)
+}
+
+// Check runs all readiness checks within the configured timeout.
+func (c *Checker) Check(ctx context.Context) Report {
+	if c.shuttingDown.Load() {
+		return Report{Status: StatusNotReady, Checks: map[string]CheckResult{
+			"shutdown": {Status: StatusFailing, Error: "server is shutting down"},
+		}}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.ReadinessTimeout)
+	defer cancel()
+
+	report := Report{Status: StatusReady, Checks: make(map[string]CheckResult)}
+	if c.db != nil {
+		report.add("database", c.checkDatabase(ctx))
+	}
+	if c.migrations != nil {
+		report.add("migrations", c.checkMigrations(ctx))
+	}
+	if c.pipeline != nil {
+		backlog := c.pipeline.Stats().Backlog
+		report.add("clicklog", CheckResult{Status: StatusOK, Backlog: &backlog})
+	}
+	return report
+}
+
+func (r *Report) add(name string, result CheckResult) {
+	r.Checks[name] = result
+	if result.Status != StatusOK {
+		r.Status = StatusNotReady
+	}
+}
+
+func (c *Checker) checkDatabase(ctx context.Context) CheckResult {
+	if err := c.db.PingContext(ctx); err != nil {
+		c.logger.Warn("health, database ping failed", zap.Error(err))
+		return CheckResult{Status: StatusFailing, Error: err.Error()}
+	}
+	return CheckResult{Status: StatusOK}
+}
+
+func (c *Checker) checkMigrations(ctx context.Context) CheckResult {
+	statuses, err := c.migrations.Status(ctx)
+	if err != nil {
+		c.logger.Warn("health, reading migration status failed", zap.Error(err))
+		return CheckResult{Status: StatusFailing, Error: err.Error()}
+	}
+	var applied, pending int
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			applied++
+		} else {
+			pending++
+		}
+	}
+	result := CheckResult{Status: StatusOK, Applied: &applied, Pending: &pending}
+	if pending > 0 {
+		result.Status = StatusFailing
+		result.Error = "pending migrations"
+	}
+	return result
+}
+
+func (c *Checker) write(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		c.logger.Error("health, failed to write response", zap.Error(err))
+	}
+}
+
+// ShutdownDelay is how long to keep serving after SetShuttingDown.
+func (c *Checker) ShutdownDelay() time.Duration {
+	return c.config.ShutdownDelay
+}
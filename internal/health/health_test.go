@@ -0,0 +1,123 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vladislavprovich/url-shortener/internal/clicklog"
+	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
+)
+
+type pingerFunc func(ctx context.Context) error
+
+func (f pingerFunc) PingContext(ctx context.Context) error { return f(ctx) }
+
+type fixedMigrations []postgres.MigrationStatus
+
+func (m fixedMigrations) Status(_ context.Context) ([]postgres.MigrationStatus, error) { return m, nil }
+
+type fixedPipeline clicklog.Stats
+
+func (p fixedPipeline) Stats() clicklog.Stats { return clicklog.Stats(p) }
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var report Report
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+	return rec.Code, report
+}
+
+func TestReady(t *testing.T) {
+	appliedAt := time.Now()
+	healthyDB := pingerFunc(func(context.Context) error { return nil })
+	migrated := fixedMigrations{{Version: 1, Name: "init", AppliedAt: &appliedAt}}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		status   int
+		failing  string
+		expected string
+	}{
+		{
+			name:     "all checks pass",
+			opts:     []Option{WithDatabase(healthyDB), WithMigrations(migrated), WithPipeline(fixedPipeline{Backlog: 3})},
+			status:   http.StatusOK,
+			expected: StatusReady,
+		},
+		{
+			name: "database down",
+			opts: []Option{WithDatabase(pingerFunc(func(context.Context) error {
+				return errors.New("connection refused")
+			}))},
+			status:   http.StatusServiceUnavailable,
+			failing:  "database",
+			expected: StatusNotReady,
+		},
+		{
+			name: "pending migrations",
+			opts: []Option{WithMigrations(fixedMigrations{
+				{Version: 1, Name: "init", AppliedAt: &appliedAt},
+				{Version: 2, Name: "next"},
+			})},
+			status:   http.StatusServiceUnavailable,
+			failing:  "migrations",
+			expected: StatusNotReady,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checker := NewChecker(Config{ReadinessTimeout: time.Second}, nil, tt.opts...)
+			status, report := probe(t, checker.Ready)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.expected, report.Status)
+			if tt.failing != "" {
+				assert.Equal(t, StatusFailing, report.Checks[tt.failing].Status)
+			}
+		})
+	}
+}
+
+func TestReady_PingTimeout(t *testing.T) {
+	slowDB := pingerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	checker := NewChecker(Config{ReadinessTimeout: 10 * time.Millisecond}, nil, WithDatabase(slowDB))
+
+	status, report := probe(t, checker.Ready)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Contains(t, report.Checks["database"].Error, context.DeadlineExceeded.Error())
+}
+
+func TestReady_ReportsBacklog(t *testing.T) {
+	checker := NewChecker(Config{ReadinessTimeout: time.Second}, nil, WithPipeline(fixedPipeline{Backlog: 42}))
+
+	_, report := probe(t, checker.Ready)
+	require.NotNil(t, report.Checks["clicklog"].Backlog)
+	assert.Equal(t, 42, *report.Checks["clicklog"].Backlog)
+}
+
+func TestShuttingDown(t *testing.T) {
+	checker := NewChecker(Config{ReadinessTimeout: time.Second}, nil)
+	status, _ := probe(t, checker.Ready)
+	require.Equal(t, http.StatusOK, status)
+
+	checker.SetShuttingDown()
+
+	status, report := probe(t, checker.Ready)
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, StatusNotReady, report.Status)
+	status, _ = probe(t, checker.Live)
+	assert.Equal(t, http.StatusOK, status, "liveness is not affected by shutdown")
+}
@@ -0,0 +1,12 @@
+package metrics
+
+import "context"
+
+type Config struct {
+	// Enabled exposes Prometheus metrics on /metrics.
+	Enabled bool `envconfig:"METRICS_ENABLED" default:"true"`
+}
+
+func (c Config) ValidateWithContext(_ context.Context) error {
+	return nil
+}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/vladislavprovich/url-shortener/internal/clicklog"
+	"github.com/vladislavprovich/url-shortener/internal/repository/cache"
+)
+
+const namespace = "urlshortener"
+
+// unmatchedRoute labels requests that matched no route, so that arbitrary
+// paths cannot blow up the label cardinality.
+const unmatchedRoute = "unmatched"
+
+// Metrics holds the Prometheus collectors of the service. It implements
+// service.Metrics.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	redirects       *prometheus.CounterVec
+	linksCreated    prometheus.Counter
+	codeCollisions  prometheus.Counter
+	codeExhausted   prometheus.Counter
+	rateLimited     prometheus.Counter
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Resolved short URLs by outcome (hit, miss, expired, inactive, disabled, blocked, locked, exhausted).",
+		}, []string{"outcome"}),
+		linksCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "links_created_total",
+			Help:      "Links created.",
+		}),
+		codeCollisions: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "code_collisions_total",
+			Help:      "Generated short codes that were already taken and had to be retried.",
+		}),
+		codeExhausted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "code_retries_exhausted_total",
+			Help:      "Link creations that failed because the collision retry budget was spent.",
+		}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_requests_total",
+			Help:      "Requests rejected by the rate limiter.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.redirects,
+		m.linksCreated,
+		m.codeCollisions,
+		m.codeExhausted,
+		m.rateLimited,
+	)
+	return m
+}
+
+// RegisterDB exports the connection pool statistics of db, see sql.DB.Stats.
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterClickLog exports the counters of the redirect log pipeline, read
+// from stats on every scrape.
+func (m *Metrics) RegisterClickLog(stats func() clicklog.Stats) {
+	counter := func(name, help string, value func(clicklog.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "clicklog",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(stats())) })
+	}
+	m.registry.MustRegister(
+		counter("enqueued_total", "Redirect logs accepted by the pipeline.",
+			func(s clicklog.Stats) uint64 { return s.Enqueued }),
+		counter("dropped_total", "Redirect logs dropped because the buffer was full.",
+			func(s clicklog.Stats) uint64 { return s.Dropped }),
+		counter("written_total", "Redirect logs written to the repository.",
+			func(s clicklog.Stats) uint64 { return s.Written }),
+		counter("failed_total", "Redirect logs lost because their batch could not be written.",
+			func(s clicklog.Stats) uint64 { return s.Failed }),
+		counter("batches_total", "Batches written to the repository.",
+			func(s clicklog.Stats) uint64 { return s.Batches }),
+		counter("failed_batches_total", "Batches that could not be written.",
+			func(s clicklog.Stats) uint64 { return s.FailedBatches }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "clicklog",
+			Name:      "backlog",
+			Help:      "Redirect logs buffered and not yet written.",
+		}, func() float64 { return float64(stats().Backlog) }),
+	)
+}
+
+// RegisterCache exports the counters of the link cache, read from stats on
+// every scrape.
+func (m *Metrics) RegisterCache(stats func() cache.Stats) {
+	counter := func(name, help string, value func(cache.Stats) uint64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return float64(value(stats())) })
+	}
+	m.registry.MustRegister(
+		counter("hits_total", "Link lookups served from the cache.",
+			func(s cache.Stats) uint64 { return s.Hits }),
+		counter("negative_hits_total", "Lookups of unknown codes answered from the cache.",
+			func(s cache.Stats) uint64 { return s.NegativeHits }),
+		counter("misses_total", "Link lookups passed to the repository.",
+			func(s cache.Stats) uint64 { return s.Misses }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "cache",
+			Name:      "entries",
+			Help:      "Links and unknown codes held by the cache.",
+		}, func() float64 { return float64(stats().Entries) }),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Middleware records the count and latency of every request, labelled with
+// the chi route pattern rather than the raw path.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chiMiddleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := unmatchedRoute
+		// The pattern is only known once the router has matched the request.
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.requestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+func (m *Metrics) LinkCreated() {
+	m.linksCreated.Inc()
+}
+
+func (m *Metrics) Redirect(outcome string) {
+	m.redirects.WithLabelValues(outcome).Inc()
+}
+
+func (m *Metrics) CodeCollision() {
+	m.codeCollisions.Inc()
+}
+
+func (m *Metrics) CodeRetriesExhausted() {
+	m.codeExhausted.Inc()
+}
+
+// RateLimited counts a request rejected by middleware.RateLimiter.
+func (m *Metrics) RateLimited(_ *http.Request) {
+	m.rateLimited.Inc()
+}
@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/vladislavprovich/url-shortener/internal/clicklog"
+	"github.com/vladislavprovich/url-shortener/internal/repository/cache"
+)
+
+func TestMiddleware_LabelsByRoutePattern(t *testing.T) {
+	m := New()
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/{shortURL}", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})
+	r.Route("/links/{shortURL}", func(r chi.Router) {
+		r.Delete("/", func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+
+	for _, target := range []string{"/abc", "/def", "/links/abc", "/a/b/c"} {
+		method := http.MethodGet
+		if strings.HasPrefix(target, "/links") {
+			method = http.MethodDelete
+		}
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+	}
+
+	assert.InDelta(t, 2, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/{shortURL}", "302")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodDelete, "/links/{shortURL}", "204")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")), 0)
+	assert.Equal(t, 3, testutil.CollectAndCount(m.requestDuration))
+}
+
+func TestHandler_ExposesServiceMetrics(t *testing.T) {
+	m := New()
+	m.LinkCreated()
+	m.Redirect("hit")
+	m.Redirect("miss")
+	m.CodeCollision()
+	m.RateLimited(nil)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body := rec.Body.String()
+	assert.Contains(t, body, "urlshortener_links_created_total 1")
+	assert.Contains(t, body, `urlshortener_redirects_total{outcome="hit"} 1`)
+	assert.Contains(t, body, `urlshortener_redirects_total{outcome="miss"} 1`)
+	assert.Contains(t, body, "urlshortener_code_collisions_total 1")
+	assert.Contains(t, body, "urlshortener_rate_limited_requests_total 1")
+}
+
+func TestRegisterClickLog(t *testing.T) {
+	m := New()
+	stats := clicklog.Stats{Enqueued: 10, Dropped: 3, Written: 6, Failed: 1, Batches: 2, FailedBatches: 1, Backlog: 4}
+	m.RegisterClickLog(func() clicklog.Stats { return stats })
+	stats.Dropped = 5
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "urlshortener_clicklog_enqueued_total 10")
+	assert.Contains(t, body, "urlshortener_clicklog_dropped_total 5")
+	assert.Contains(t, body, "urlshortener_clicklog_failed_batches_total 1")
+	assert.Contains(t, body, "urlshortener_clicklog_backlog 4")
+}
+
+func TestRegisterCache(t *testing.T) {
+	m := New()
+	m.RegisterCache(func() cache.Stats { return cache.Stats{Hits: 7, NegativeHits: 2, Misses: 3, Entries: 5} })
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	assert.Contains(t, body, "urlshortener_cache_hits_total 7")
+	assert.Contains(t, body, "urlshortener_cache_negative_hits_total 2")
+	assert.Contains(t, body, "urlshortener_cache_misses_total 3")
+	assert.Contains(t, body, "urlshortener_cache_entries 5")
+}
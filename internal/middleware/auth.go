@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// APIKeyHeader is an alternative to "Authorization: Bearer <key>".
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator resolves an API key to the owner it was issued to.
+type Authenticator interface {
+	Authenticate(ctx context.Context, key string) (string, error)
+}
+
+// APIKeyAuth rejects requests without a valid API key and stores the owner of
+// the key in the request context, see auth.OwnerFromContext.
+func APIKeyAuth(authenticator Authenticator, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := apiKey(r)
+			if key == "" {
+				writeUnauthorized(w, logger)
+				return
+			}
+			owner, err := authenticator.Authenticate(r.Context(), key)
+			if err != nil {
+				if !errors.Is(err, models.ErrUnauthorized) {
+					logger.Error("middleware, failed to authenticate API key", zap.Error(err))
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				writeUnauthorized(w, logger)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(auth.WithOwner(r.Context(), owner)))
+		})
+	}
+}
+
+func apiKey(r *http.Request) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+func writeUnauthorized(w http.ResponseWriter, logger *zap.Logger) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="url-shortener"`)
+	writeError(w, http.StatusUnauthorized, "unauthorized", models.ErrUnauthorized.Error(), logger)
+}
+
+// writeError answers with the JSON error body used by the handlers.
+func writeError(w http.ResponseWriter, status int, code, message string, logger *zap.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(models.ErrorResponse{Code: code, Message: message}); err != nil {
+		logger.Error("middleware, failed to encode response", zap.Error(err))
+	}
+}
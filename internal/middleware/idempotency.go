@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyReleaseTimeout = 5 * time.Second
+	// maxIdempotentBodyBytes bounds the buffered body of a request with a key,
+	// enough for a full batch.
+	maxIdempotentBodyBytes = 8 << 20
+)
+
+// Idempotency answers retries of a request carrying an Idempotency-Key header
+// with the stored response of the first attempt for window. Reusing a key
+// with a different request is rejected, as is a retry while the first attempt
+// is still running. Server errors are not stored so they can be retried.
+// Keys are scoped to the authenticated owner and the request path.
+//
+// A running attempt only holds its key for lease, so the key of an attempt
+// whose process died can be used again once the lease has run out.
+func Idempotency(
+	repo repository.IdempotencyRepository, window, lease time.Duration, logger *zap.Logger,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeError(w, http.StatusBadRequest, "invalid_request",
+					"Idempotency-Key must not be longer than 255 characters", logger)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, http.StatusRequestEntityTooLarge, "invalid_request", "request body too large", logger)
+					return
+				}
+				writeError(w, http.StatusBadRequest, "invalid_request", "invalid request payload", logger)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			owner, _ := auth.OwnerFromContext(r.Context())
+			now := time.Now()
+			record := models.IdempotencyRecord{
+				Scope:       owner + " " + r.URL.Path,
+				Key:         key,
+				Fingerprint: fingerprint(r, body),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(lease),
+			}
+			existing, claimed, err := repo.ClaimIdempotencyKey(r.Context(), record)
+			if err != nil {
+				logger.Error("middleware, failed to claim idempotency key", zap.Error(err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !claimed {
+				replay(w, existing, record.Fingerprint, logger)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				if completed {
+					return
+				}
+				// The handler failed or panicked, let the client retry.
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), idempotencyReleaseTimeout)
+				defer cancel()
+				if err := repo.ReleaseIdempotencyKey(ctx, record.Scope, record.Key); err != nil {
+					logger.Error("middleware, failed to release idempotency key", zap.Error(err))
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+
+			if recorder.status >= http.StatusInternalServerError {
+				return
+			}
+			record.StatusCode = recorder.status
+			record.ContentType = recorder.Header().Get("Content-Type")
+			record.Body = recorder.body.Bytes()
+			record.ExpiresAt = time.Now().Add(window)
+			if err = repo.CompleteIdempotencyKey(context.WithoutCancel(r.Context()), record); err != nil {
+				logger.Error("middleware, failed to store idempotent response", zap.Error(err))
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// fingerprint identifies a request by method, path and body.
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replay(w http.ResponseWriter, existing models.IdempotencyRecord, fingerprint string, logger *zap.Logger) {
+	switch {
+	case existing.Fingerprint != fingerprint:
+		writeError(w, http.StatusUnprocessableEntity, "idempotency_key_reused",
+			"Idempotency-Key was already used with a different request", logger)
+	case existing.StatusCode == 0:
+		writeError(w, http.StatusConflict, "idempotency_key_in_progress",
+			"a request with this Idempotency-Key is still in progress", logger)
+	default:
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		w.Header().Set(IdempotentReplayedHeader, "true")
+		w.WriteHeader(existing.StatusCode)
+		if _, err := w.Write(existing.Body); err != nil {
+			logger.Error("middleware, failed to replay idempotent response", zap.Error(err))
+		}
+	}
+}
+
+// responseRecorder passes the response through while keeping a copy.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -7,11 +7,46 @@ import (
 	"github.com/go-chi/httprate"
 )
 
-const defaultRateLimit = 100
+const (
+	defaultRateLimit             = 100
+	defaultPasswordAttempts      = 5
+	defaultPasswordAttemptWindow = 15 * time.Minute
+)
 
-func RateLimiter(rateLimit int) func(next http.Handler) http.Handler {
+// RateLimiter limits requests per client IP to rateLimit per minute. onReject,
+// if not nil, is called for every rejected request.
+func RateLimiter(rateLimit int, onReject func(r *http.Request)) func(next http.Handler) http.Handler {
 	if rateLimit == 0 {
 		rateLimit = defaultRateLimit
 	}
-	return httprate.LimitByIP(rateLimit, time.Minute)
+	return httprate.Limit(rateLimit, time.Minute,
+		httprate.WithKeyFuncs(httprate.KeyByIP),
+		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+			if onReject != nil {
+				onReject(r)
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}),
+	)
+}
+
+// PasswordAttemptLimiter limits password attempts per client IP and link to
+// attempts per window, so link passwords cannot be guessed by brute force.
+func PasswordAttemptLimiter(attempts int, window time.Duration,
+	onReject func(r *http.Request)) func(next http.Handler) http.Handler {
+	if attempts == 0 {
+		attempts = defaultPasswordAttempts
+	}
+	if window == 0 {
+		window = defaultPasswordAttemptWindow
+	}
+	return httprate.Limit(attempts, window,
+		httprate.WithKeyFuncs(httprate.KeyByIP, httprate.KeyByEndpoint),
+		httprate.WithLimitHandler(func(w http.ResponseWriter, r *http.Request) {
+			if onReject != nil {
+				onReject(r)
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		}),
+	)
 }
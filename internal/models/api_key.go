@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// APIKey authenticates an owner. Only the hash of the key is stored.
+type APIKey struct {
+	ID        string     `json:"id"`
+	OwnerID   string     `json:"owner_id"`
+	Name      string     `json:"name"`
+	KeyHash   string     `json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+type BatchShortenRequest struct {
+	Items []ShortenRequest `json:"items"`
+	// Atomic creates either all items or none. By default every item
+	// succeeds or fails on its own.
+	Atomic bool `json:"atomic,omitempty"`
+}
+
+// BatchItemResult is the outcome of the item at Index of the request, either
+// the short URL or an error.
+type BatchItemResult struct {
+	Index     int            `json:"index"`
+	ShortURL  string         `json:"short_url,omitempty"`
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"`
+	Error     *ErrorResponse `json:"error,omitempty"`
+}
+
+type BatchShortenResponse struct {
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "errors"
+
+// Domain errors shared by the repository, service and handler layers.
+// Callers must match them with errors.Is, they are usually wrapped.
+var (
+	ErrNotFound          = errors.New("URL not found")
+	ErrExpired           = errors.New("URL has expired")
+	ErrNotYetActive      = errors.New("URL is not active yet")
+	ErrDisabled          = errors.New("URL is disabled")
+	ErrClickLimitReached = errors.New("URL has reached its click limit")
+	ErrAliasTaken        = errors.New("custom alias already in use")
+	ErrShortURLTaken     = errors.New("short URL already in use")
+	ErrInvalidURL        = errors.New("invalid URL")
+	ErrInvalidExpiration = errors.New("invalid expiration")
+	ErrInvalidRequest    = errors.New("invalid request")
+	ErrUnauthorized      = errors.New("missing or invalid API key")
+	ErrForbidden         = errors.New("link belongs to another owner")
+	// ErrPasswordRequired and ErrInvalidPassword are returned when following a
+	// password protected link without or with a wrong password.
+	ErrPasswordRequired = errors.New("password required")
+	ErrInvalidPassword  = errors.New("invalid password")
+	// ErrTooManyAttempts means the link had too many wrong passwords recently.
+	ErrTooManyAttempts = errors.New("too many wrong passwords, try again later")
+	// ErrBlocked means the destination is rejected by the destination policy
+	// or the link was blocked by an operator.
+	ErrBlocked = errors.New("destination is blocked")
+	// ErrBatchAborted marks batch items that were not created because another
+	// item of an all-or-nothing batch failed.
+	ErrBatchAborted = errors.New("not created, another item of the batch failed")
+	// ErrCodeGenerationFailed means no free short code was found within the retry budget.
+	ErrCodeGenerationFailed = errors.New("could not generate a unique short URL")
+)
+
+// ErrorResponse is the JSON body of every API error.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
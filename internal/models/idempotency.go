@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord remembers the response to a request sent with an
+// Idempotency-Key header so that retries can be answered with it.
+type IdempotencyRecord struct {
+	// Scope separates keys of different owners and endpoints.
+	Scope string
+	Key   string
+	// Fingerprint identifies the request body the key was first used with.
+	Fingerprint string
+	// StatusCode is zero while the first request is still in progress.
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
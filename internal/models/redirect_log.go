@@ -7,4 +7,29 @@ type RedirectLog struct {
 	ShortURL   string    `json:"short_url"`
 	AccessedAt time.Time `json:"accessed_at"`
 	Referrer   *string   `json:"referrer,omitempty"`
+	// ReferrerHost is the lowercased host of Referrer, nil if it has none.
+	ReferrerHost *string `json:"referrer_host,omitempty"`
+	// FallbackReason is set when the visitor was sent to the fallback URL
+	// instead of the destination, such visits are not counted as redirects.
+	FallbackReason *string `json:"fallback_reason,omitempty"`
+	UserAgent      *string `json:"user_agent,omitempty"`
+	// Browser, OS and Device classify UserAgent, Bot marks crawlers and other
+	// automated clients, which are left out of the statistics.
+	Browser string `json:"browser,omitempty"`
+	OS      string `json:"os,omitempty"`
+	Device  string `json:"device,omitempty"`
+	Bot     bool   `json:"bot"`
+	// Country, Region and City locate the client address, which itself is
+	// not stored. They are empty without a GeoIP database.
+	Country string `json:"country,omitempty"`
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// GeoLocation is the location of a client address. Country is the ISO 3166-1
+// alpha-2 code, Region and City are English names.
+type GeoLocation struct {
+	Country string
+	Region  string
+	City    string
 }
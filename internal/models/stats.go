@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
+)
+
+// StatsQuery selects the click time series of the statistics of a link.
+// The series covers [From, To) in buckets of Granularity, in the calendar of
+// Location.
+type StatsQuery struct {
+	From        time.Time
+	To          time.Time
+	Granularity timebucket.Granularity
+	Location    *time.Location
+}
+
+// ClickBucket counts the clicks of the bucket starting at Start.
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int       `json:"clicks"`
+}
+
+// Referrer groups of ReferrerQuery, and the referrer reported for visits
+// without a Referer header.
+const (
+	ReferrerGroupHost = "host"
+	ReferrerGroupURL  = "url"
+	DirectReferrer    = "direct"
+)
+
+// ReferrerQuery selects a page of the referrers of a link, ordered by clicks.
+type ReferrerQuery struct {
+	Group  string
+	Limit  int
+	Offset int
+}
+
+// ReferrerCount counts the clicks sent by a referrer.
+type ReferrerCount struct {
+	Referrer string `json:"referrer"`
+	Clicks   int    `json:"clicks"`
+}
+
+// ReferrerPage is a page of referrers, Total is the number of distinct
+// referrers of the group.
+type ReferrerPage struct {
+	Group  string          `json:"group"`
+	Items  []ReferrerCount `json:"items"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+// Dimensions of the client breakdown of the statistics.
+const (
+	DimensionBrowser = "browser"
+	DimensionOS      = "os"
+	DimensionDevice  = "device"
+	DimensionCountry = "country"
+)
+
+// DimensionCount counts the clicks with Value in a dimension of the client
+// breakdown. Visits recorded before user agents were captured are "unknown".
+type DimensionCount struct {
+	Value  string `json:"value"`
+	Clicks int    `json:"clicks"`
+}
@@ -11,20 +11,101 @@ type URL struct {
 	CustomAlias *string    `json:"custom_alias,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	ExpiredAt   *time.Time `json:"expired_at,omitempty"`
+	// ActivatesAt is when the link starts working, nil means immediately.
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	Disabled    bool       `json:"disabled"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+	OwnerID     *string    `json:"owner_id,omitempty"`
+	// RedirectType is the HTTP status used to redirect, zero means the server default.
+	RedirectType int `json:"redirect_type,omitempty"`
+	// MaxClicks limits the number of redirects, nil means unlimited.
+	// ClickCount counts the redirects of limited links only.
+	MaxClicks  *int `json:"max_clicks,omitempty"`
+	ClickCount int  `json:"click_count,omitempty"`
+	// FallbackURL receives visitors while the link cannot be followed.
+	FallbackURL string `json:"fallback_url,omitempty"`
+	// PasswordHash is the bcrypt hash of the password protecting the link, if any.
+	PasswordHash string `json:"-"`
+	// Blocked is set by operators for abusive links, redirects then show a warning page.
+	Blocked bool `json:"blocked,omitempty"`
+	// DestinationHash identifies the normalized OriginalURL for deduplication.
+	DestinationHash string `json:"-"`
 }
 
 type ShortenRequest struct {
-	URL         string  `json:"url" validate:"required,url"`
-	CustomAlias *string `json:"custom_alias,omitempty" validate:"omitempty,alphanum"`
+	URL string `json:"url" validate:"required,url"`
+	// CustomAlias is used as the short code, the columns hold 30 characters.
+	CustomAlias *string `json:"custom_alias,omitempty" validate:"omitempty,alphanum,max=30"`
+	// ExpiresAt is an absolute expiration time, TTL is a duration relative to
+	// creation time (e.g. "24h"). At most one of them may be set.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" validate:"omitempty,excluded_with=TTL"`
+	TTL       *string    `json:"ttl,omitempty" validate:"omitempty,excluded_with=ExpiresAt"`
+	// ActivatesAt delays the link until launch, it must be before the expiration.
+	ActivatesAt *time.Time `json:"activates_at,omitempty"`
+	// RedirectType is one of 301, 302, 307 or 308, the server default if omitted.
+	RedirectType int `json:"redirect_type,omitempty" validate:"omitempty,oneof=301 302 307 308"`
+	// MaxClicks makes the link stop working after this many redirects.
+	MaxClicks *int `json:"max_clicks,omitempty" validate:"omitempty,min=1"`
+	// FallbackURL is used instead of an error once the link is expired,
+	// exhausted or disabled, or before it is active.
+	FallbackURL *string `json:"fallback_url,omitempty" validate:"omitempty,url"`
+	// Password must be entered before the redirect, bcrypt limits it to 72 bytes.
+	Password *string `json:"password,omitempty" validate:"omitempty,min=4,max=72"`
+	// Deduplicate returns an existing link to the same destination instead of
+	// creating a new one, overriding the server default.
+	Deduplicate *bool `json:"deduplicate,omitempty"`
+}
+
+// UpdateURLRequest changes an existing link, nil fields are left unchanged.
+// The short code itself is immutable, a new alias is added next to it.
+type UpdateURLRequest struct {
+	URL         *string    `json:"url,omitempty" validate:"omitempty,url"`
+	CustomAlias *string    `json:"custom_alias,omitempty" validate:"omitempty,alphanum,max=30"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" validate:"omitempty,excluded_with=TTL NoExpiration"`
+	TTL         *string    `json:"ttl,omitempty" validate:"omitempty,excluded_with=ExpiresAt NoExpiration"`
+	// NoExpiration removes the expiration of the link.
+	NoExpiration bool `json:"no_expiration,omitempty"`
+	// ActivatesAt schedules the activation of the link, ActivateNow removes the schedule.
+	ActivatesAt *time.Time `json:"activates_at,omitempty" validate:"omitempty,excluded_with=ActivateNow"`
+	ActivateNow bool       `json:"activate_now,omitempty"`
+	// RedirectType is one of 301, 302, 307 or 308, or 0 to use the server default.
+	RedirectType *int `json:"redirect_type,omitempty" validate:"omitempty,oneof=0 301 302 307 308"`
+	// FallbackURL replaces the fallback of the link, an empty URL removes it.
+	FallbackURL *string `json:"fallback_url,omitempty" validate:"omitempty,eq=|url"`
+	// Password replaces the password of the link, an empty password removes it.
+	// Other passwords are bounded like those of ShortenRequest.
+	Password *string `json:"password,omitempty" validate:"omitempty,eq=|min=4,max=72"`
 }
 
 type ShortenResponse struct {
-	ShortURL string `json:"short_url"`
+	ShortURL  string     `json:"short_url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type StatsResponse struct {
+	// RedirectCount, LastAccessed and every breakdown leave out bots, their
+	// visits are counted by BotCount.
 	RedirectCount int        `json:"redirect_count"`
+	BotCount      int        `json:"bot_count"`
 	CreatedAt     time.Time  `json:"created_at"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
 	LastAccessed  *time.Time `json:"last_accessed,omitempty"`
-	Referrers     []string   `json:"referrers,omitempty"`
+	// ReferrerHosts and ReferrerURLs are the top referrers by clicks, grouped
+	// by host and by full URL. Visits without referrer count as "direct".
+	ReferrerHosts []ReferrerCount `json:"referrer_hosts,omitempty"`
+	ReferrerURLs  []ReferrerCount `json:"referrer_urls,omitempty"`
+	// MaxClicks and RemainingClicks are only set for links with a click limit.
+	MaxClicks       *int `json:"max_clicks,omitempty"`
+	RemainingClicks *int `json:"remaining_clicks,omitempty"`
+	// Series is the click time series selected by the StatsQuery, with a
+	// bucket for every period including those without clicks.
+	Granularity string        `json:"granularity,omitempty"`
+	TimeZone    string        `json:"time_zone,omitempty"`
+	Series      []ClickBucket `json:"series,omitempty"`
+	// Browsers, OperatingSystems, Devices and Countries are the top values of
+	// the client breakdown by clicks.
+	Browsers         []DimensionCount `json:"browsers,omitempty"`
+	OperatingSystems []DimensionCount `json:"operating_systems,omitempty"`
+	Devices          []DimensionCount `json:"devices,omitempty"`
+	Countries        []DimensionCount `json:"countries,omitempty"`
 }
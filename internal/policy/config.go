@@ -0,0 +1,28 @@
+package policy
+
+import (
+	"context"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	// File holds the domain block- and allowlist, without it no domain is listed.
+	File string `envconfig:"POLICY_FILE"`
+	// ReloadInterval is how often File is checked for changes, zero disables reloading.
+	ReloadInterval time.Duration `envconfig:"POLICY_RELOAD_INTERVAL" default:"1m"`
+	// AllowPrivate accepts destinations on loopback, private and link-local addresses.
+	AllowPrivate bool `envconfig:"POLICY_ALLOW_PRIVATE" default:"false"`
+	// ResolveHosts looks up the addresses of new destinations so host names
+	// pointing at private addresses are rejected as well.
+	ResolveHosts   bool          `envconfig:"POLICY_RESOLVE_HOSTS" default:"false"`
+	ResolveTimeout time.Duration `envconfig:"POLICY_RESOLVE_TIMEOUT" default:"2s"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.ReloadInterval, validation.Min(time.Duration(0))),
+		validation.Field(&c.ResolveTimeout, validation.When(c.ResolveHosts, validation.Required)),
+	)
+}
@@ -0,0 +1,293 @@
+// Package policy decides which destinations may be shortened and followed.
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/idna"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// Resolver looks up the addresses of a host, net.DefaultResolver in production.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Policy checks destinations against the domain lists of the policy file, the
+// addresses they point at and the hosts of the service itself. It is safe for
+// concurrent use, the lists are swapped atomically on reload.
+type Policy struct {
+	cfg      Config
+	logger   *zap.Logger
+	resolver Resolver
+	self     map[string]struct{}
+	lists    atomic.Pointer[lists]
+
+	mu      sync.Mutex
+	modTime time.Time
+}
+
+// Option customizes the Policy created by New.
+type Option func(*Policy)
+
+// WithSelfURLs rejects destinations on the hosts of the given URLs, typically
+// the base URL of the service, since such links redirect to themselves.
+func WithSelfURLs(urls ...string) Option {
+	return func(p *Policy) {
+		for _, raw := range urls {
+			if parsed, err := url.Parse(raw); err == nil && parsed.Hostname() != "" {
+				p.self[canonicalHost(parsed.Hostname())] = struct{}{}
+			}
+		}
+	}
+}
+
+// WithResolver replaces net.DefaultResolver.
+func WithResolver(resolver Resolver) Option {
+	return func(p *Policy) {
+		p.resolver = resolver
+	}
+}
+
+// New loads the policy file of cfg, if any.
+func New(cfg Config, logger *zap.Logger, opts ...Option) (*Policy, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	p := &Policy{
+		cfg:      cfg,
+		logger:   logger,
+		resolver: net.DefaultResolver,
+		self:     make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.lists.Store(&lists{})
+	if cfg.File != "" {
+		if err := p.Reload(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Reload reads the policy file again. On error the current lists stay in effect.
+func (p *Policy) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	file, err := os.Open(p.cfg.File)
+	if err != nil {
+		return fmt.Errorf("open policy file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat policy file: %w", err)
+	}
+	loaded, err := parseLists(file)
+	if err != nil {
+		return fmt.Errorf("policy file %s: %w", p.cfg.File, err)
+	}
+	p.lists.Store(loaded)
+	p.modTime = info.ModTime()
+	p.logger.Info("Loaded destination policy",
+		zap.Int("blocked", len(loaded.blocked)), zap.Int("allowed", len(loaded.allowed)))
+	return nil
+}
+
+// Watch reloads the policy file whenever it changes until ctx is done.
+func (p *Policy) Watch(ctx context.Context) {
+	if p.cfg.File == "" || p.cfg.ReloadInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(p.cfg.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !p.changed() {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				p.logger.Error("Failed to reload destination policy", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (p *Policy) changed() bool {
+	info, err := os.Stat(p.cfg.File)
+	if err != nil {
+		p.logger.Warn("Failed to stat policy file", zap.Error(err))
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !info.ModTime().Equal(p.modTime)
+}
+
+// CheckDestination reports why destination may not be shortened, wrapping
+// models.ErrBlocked, or nil if it may.
+func (p *Policy) CheckDestination(ctx context.Context, destination string) error {
+	host, err := p.check(destination)
+	if err != nil || host == "" || !p.cfg.ResolveHosts || p.cfg.AllowPrivate || net.ParseIP(host) != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ResolveTimeout)
+	defer cancel()
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		// A host that does not resolve cannot be abused to reach internal services.
+		p.logger.Debug("Failed to resolve destination host", zap.String("host", host), zap.Error(err))
+		return nil
+	}
+	for _, addr := range addrs {
+		if isPrivate(addr.IP) {
+			return fmt.Errorf("%w: host %q resolves to a private address", models.ErrBlocked, host)
+		}
+	}
+	return nil
+}
+
+// CheckRedirect is CheckDestination without address lookups, so it is cheap
+// enough for every redirect and catches links listed after their creation.
+func (p *Policy) CheckRedirect(destination string) error {
+	_, err := p.check(destination)
+	return err
+}
+
+// check applies every rule that does not need the network and returns the
+// host of destination, which is empty for URLs without one.
+func (p *Policy) check(destination string) (string, error) {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", models.ErrBlocked, err)
+	}
+	host := canonicalHost(parsed.Hostname())
+	if host == "" {
+		return "", nil
+	}
+
+	if _, ok := p.self[host]; ok {
+		return "", fmt.Errorf("%w: links to this service are not allowed", models.ErrBlocked)
+	}
+	if err = p.lists.Load().check(host); err != nil {
+		return "", err
+	}
+	if !p.cfg.AllowPrivate {
+		if ip := net.ParseIP(host); (ip != nil && isPrivate(ip)) || isLocalName(host) {
+			return "", fmt.Errorf("%w: host %q is a private address", models.ErrBlocked, host)
+		}
+	}
+	return host, nil
+}
+
+func canonicalHost(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return ascii
+	}
+	return host
+}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+func isLocalName(host string) bool {
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// anyDomain is the list entry matching every host.
+const anyDomain = "*"
+
+// lists are the domains of the policy file. An entry matches the domain itself
+// and all of its subdomains.
+type lists struct {
+	blocked map[string]struct{}
+	allowed map[string]struct{}
+}
+
+// check rejects host if its most specific matching entry is a blocked one, so
+// allowed entries are exceptions to blocked parent domains. "block *" turns
+// the allowed entries into an allowlist.
+func (l *lists) check(host string) error {
+	if match(l.blocked, host) > match(l.allowed, host) {
+		return fmt.Errorf("%w: host %q is blocked", models.ErrBlocked, host)
+	}
+	return nil
+}
+
+// match returns the length of the most specific entry matching host, zero for
+// anyDomain and -1 if nothing matches.
+func match(entries map[string]struct{}, host string) int {
+	for domain := host; ; {
+		if _, ok := entries[domain]; ok {
+			return len(domain)
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			break
+		}
+		domain = domain[i+1:]
+	}
+	if _, ok := entries[anyDomain]; ok {
+		return 0
+	}
+	return -1
+}
+
+// parseLists reads one rule per line, "block <domain>" or "allow <domain>",
+// where the domain may be "*". Empty lines and lines starting with "#" are ignored.
+func parseLists(r io.Reader) (*lists, error) {
+	loaded := &lists{blocked: make(map[string]struct{}), allowed: make(map[string]struct{})}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"block <domain>\" or \"allow <domain>\"", line)
+		}
+		domain := anyDomain
+		if fields[1] != anyDomain {
+			var err error
+			domain, err = idna.Lookup.ToASCII(strings.TrimSuffix(strings.ToLower(fields[1]), "."))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid domain %q: %w", line, fields[1], err)
+			}
+		}
+		switch fields[0] {
+		case "block":
+			loaded.blocked[domain] = struct{}{}
+		case "allow":
+			loaded.allowed[domain] = struct{}{}
+		default:
+			return nil, fmt.Errorf("line %d: unknown rule %q", line, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
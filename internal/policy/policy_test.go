@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+type staticResolver map[string][]net.IPAddr
+
+func (r staticResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestCheckDestination(t *testing.T) {
+	path := writePolicy(t, `
+# known bad
+block evil.example
+block bad.example
+allow fine.bad.example
+`)
+	p, err := New(Config{File: path}, nil, WithSelfURLs("https://Sho.rt:8443"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		destination string
+		blocked     bool
+	}{
+		{destination: "https://example.com/", blocked: false},
+		{destination: "https://evil.example/login", blocked: true},
+		{destination: "https://www.evil.example/", blocked: true},
+		{destination: "https://notevil.example/", blocked: false},
+		{destination: "https://bad.example/", blocked: true},
+		{destination: "https://fine.bad.example/", blocked: false},
+		{destination: "https://sub.fine.bad.example/", blocked: false},
+		{destination: "https://sho.rt/abc", blocked: true},
+		{destination: "http://sho.rt:80/abc", blocked: true},
+		{destination: "http://127.0.0.1/", blocked: true},
+		{destination: "http://10.1.2.3:8080/", blocked: true},
+		{destination: "http://192.168.0.1/", blocked: true},
+		{destination: "http://169.254.169.254/latest/meta-data", blocked: true},
+		{destination: "http://[::1]/", blocked: true},
+		{destination: "http://0.0.0.0/", blocked: true},
+		{destination: "http://localhost:8080/", blocked: true},
+		{destination: "http://app.localhost/", blocked: true},
+		{destination: "http://8.8.8.8/", blocked: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			err := p.CheckDestination(context.Background(), tt.destination)
+			if tt.blocked {
+				require.ErrorIs(t, err, models.ErrBlocked)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, err, p.CheckRedirect(tt.destination))
+		})
+	}
+}
+
+func TestCheckDestination_Allowlist(t *testing.T) {
+	p, err := New(Config{File: writePolicy(t, "block *\nallow example.com\nblock private.example.com\n")}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, p.CheckRedirect("https://example.com/"))
+	require.NoError(t, p.CheckRedirect("https://docs.example.com/"))
+	require.ErrorIs(t, p.CheckRedirect("https://private.example.com/"), models.ErrBlocked)
+	require.ErrorIs(t, p.CheckRedirect("https://example.org/"), models.ErrBlocked)
+}
+
+func TestCheckDestination_AllowPrivate(t *testing.T) {
+	p, err := New(Config{AllowPrivate: true}, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.CheckRedirect("http://127.0.0.1:8080/"))
+	require.NoError(t, p.CheckRedirect("http://localhost/"))
+}
+
+func TestCheckDestination_ResolveHosts(t *testing.T) {
+	resolver := staticResolver{
+		"internal.example": {{IP: net.ParseIP("93.184.216.34")}, {IP: net.ParseIP("10.0.0.7")}},
+		"public.example":   {{IP: net.ParseIP("93.184.216.34")}},
+	}
+	p, err := New(Config{ResolveHosts: true, ResolveTimeout: time.Second}, nil, WithResolver(resolver))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.ErrorIs(t, p.CheckDestination(ctx, "https://internal.example/"), models.ErrBlocked)
+	require.NoError(t, p.CheckDestination(ctx, "https://public.example/"))
+	require.NoError(t, p.CheckDestination(ctx, "https://unknown.example/"), "unresolvable hosts are accepted")
+	// Redirects never resolve hosts.
+	require.NoError(t, p.CheckRedirect("https://internal.example/"))
+}
+
+func TestReload(t *testing.T) {
+	path := writePolicy(t, "block evil.example\n")
+	p, err := New(Config{File: path}, nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, p.CheckRedirect("https://evil.example/"), models.ErrBlocked)
+
+	require.NoError(t, os.WriteFile(path, []byte("block other.example\n"), 0o600))
+	require.NoError(t, p.Reload())
+	require.NoError(t, p.CheckRedirect("https://evil.example/"))
+	require.ErrorIs(t, p.CheckRedirect("https://other.example/"), models.ErrBlocked)
+
+	// A broken file keeps the previous lists.
+	require.NoError(t, os.WriteFile(path, []byte("deny other.example\n"), 0o600))
+	require.Error(t, p.Reload())
+	require.ErrorIs(t, p.CheckRedirect("https://other.example/"), models.ErrBlocked)
+}
+
+func TestWatch(t *testing.T) {
+	path := writePolicy(t, "")
+	p, err := New(Config{File: path, ReloadInterval: 10 * time.Millisecond}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go p.Watch(ctx)
+
+	require.NoError(t, os.WriteFile(path, []byte("block evil.example\n"), 0o600))
+	// Make sure the modification time differs on coarse file systems.
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	assert.Eventually(t, func() bool {
+		return p.CheckRedirect("https://evil.example/") != nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNew_InvalidFile(t *testing.T) {
+	_, err := New(Config{File: writePolicy(t, "block\n")}, nil)
+	require.Error(t, err)
+	_, err = New(Config{File: filepath.Join(t.TempDir(), "missing.txt")}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+type APIKeyRepository interface {
+	SaveAPIKey(ctx context.Context, key models.APIKey) error
+	// GetAPIKeyByHash returns the key with the given hash, revoked or not.
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+type apiKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+func (repo *apiKeyRepository) SaveAPIKey(ctx context.Context, key models.APIKey) error {
+	query := `
+        INSERT INTO api_keys (id, owner_id, name, key_hash, created_at)
+        VALUES ($1, $2, $3, $4, $5)`
+	_, err := repo.db.ExecContext(ctx, query, key.ID, key.OwnerID, key.Name, key.KeyHash, key.CreatedAt)
+	return err
+}
+
+func (repo *apiKeyRepository) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	var key models.APIKey
+	query := `
+        SELECT id, owner_id, name, key_hash, created_at, revoked_at
+        FROM api_keys WHERE key_hash = $1`
+	err := repo.db.QueryRowContext(ctx, query, hash).
+		Scan(&key.ID, &key.OwnerID, &key.Name, &key.KeyHash, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return key, models.ErrNotFound
+		}
+		return key, err
+	}
+	return key, nil
+}
+
+// RevokeAPIKey marks the key as revoked. Revoking a key twice keeps the first timestamp.
+func (repo *apiKeyRepository) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error {
+	query := `
+        UPDATE api_keys SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`
+	result, err := repo.db.ExecContext(ctx, query, id, revokedAt)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
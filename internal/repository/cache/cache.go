@@ -0,0 +1,207 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// cachedURL is either a resolved URL or, for negative caching, a known miss.
+type cachedURL struct {
+	url   models.URL
+	found bool
+}
+
+// Stats is a snapshot of the cache counters.
+type Stats struct {
+	Hits         uint64
+	NegativeHits uint64
+	Misses       uint64
+	Entries      int
+}
+
+// URLRepository is a read-through cache in front of another URLRepository.
+// Lookups by short URL or alias are served from an in-process LRU, concurrent
+// misses for the same code share a single backend query and unknown codes are
+// cached for NegativeTTL. All other methods are passed through.
+//
+// Writes through the cache invalidate it directly, links changed by another
+// process are picked up by Watch.
+type URLRepository struct {
+	repository.URLRepository
+
+	config  Config
+	logger  *zap.Logger
+	entries *lru[cachedURL]
+	group   singleflight.Group
+	// generation is bumped on every invalidation so that a lookup racing with
+	// an update does not store the stale row it read.
+	generation atomic.Uint64
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	misses       atomic.Uint64
+}
+
+func NewURLRepository(next repository.URLRepository, cfg Config, logger *zap.Logger) *URLRepository {
+	return &URLRepository{
+		URLRepository: next,
+		config:        cfg,
+		logger:        logger,
+		entries:       newLRU[cachedURL](cfg.Size),
+	}
+}
+
+func (c *URLRepository) GetURL(ctx context.Context, shortURL string) (models.URL, error) {
+	if cached, ok := c.entries.get(shortURL); ok {
+		if !cached.found {
+			c.negativeHits.Add(1)
+			return models.URL{}, models.ErrNotFound
+		}
+		c.hits.Add(1)
+		return cached.url, nil
+	}
+	c.misses.Add(1)
+
+	result, err, _ := c.group.Do(shortURL, func() (any, error) {
+		generation := c.generation.Load()
+		// Detach from the first caller so its cancellation does not fail the others.
+		url, err := c.URLRepository.GetURL(context.WithoutCancel(ctx), shortURL)
+		switch {
+		case c.generation.Load() != generation:
+			// Invalidated while loading, the result may already be stale.
+		case err == nil:
+			c.entries.set(shortURL, cachedURL{url: url, found: true}, c.config.TTL)
+		case errors.Is(err, models.ErrNotFound) && c.config.NegativeTTL > 0:
+			c.entries.set(shortURL, cachedURL{}, c.config.NegativeTTL)
+		}
+		return url, err
+	})
+	if err != nil {
+		return models.URL{}, err
+	}
+	return result.(models.URL), nil //nolint:errcheck // the group only returns models.URL
+}
+
+func (c *URLRepository) SaveURL(ctx context.Context, url models.URL) error {
+	err := c.URLRepository.SaveURL(ctx, url)
+	// Drop negative entries for the new codes even if the insert failed, the
+	// backend is the source of truth either way.
+	c.InvalidateURL(url)
+	return err
+}
+
+func (c *URLRepository) SaveURLs(ctx context.Context, urls []models.URL, skipConflicts bool) ([]string, error) {
+	saved, err := c.URLRepository.SaveURLs(ctx, urls, skipConflicts)
+	for _, url := range urls {
+		c.InvalidateURL(url)
+	}
+	return saved, err
+}
+
+func (c *URLRepository) UpdateURL(ctx context.Context, url models.URL) error {
+	// The previous alias must be dropped as well, so look it up before it changes.
+	previous, lookupErr := c.URLRepository.GetURL(ctx, url.ShortURL)
+	err := c.URLRepository.UpdateURL(ctx, url)
+	if lookupErr == nil {
+		c.InvalidateURL(previous)
+	}
+	c.InvalidateURL(url)
+	return err
+}
+
+func (c *URLRepository) ConsumeClick(ctx context.Context, shortURL string) error {
+	err := c.URLRepository.ConsumeClick(ctx, shortURL)
+	// Keep the click count of cached lookups current, limited links are rare.
+	c.Invalidate(shortURL)
+	return err
+}
+
+func (c *URLRepository) SetBlocked(ctx context.Context, shortURL string, blocked bool) error {
+	previous, lookupErr := c.URLRepository.GetURL(ctx, shortURL)
+	err := c.URLRepository.SetBlocked(ctx, shortURL, blocked)
+	if lookupErr == nil {
+		c.InvalidateURL(previous)
+	}
+	c.Invalidate(shortURL)
+	return err
+}
+
+func (c *URLRepository) DeleteURL(ctx context.Context, shortURL string) error {
+	previous, lookupErr := c.URLRepository.GetURL(ctx, shortURL)
+	err := c.URLRepository.DeleteURL(ctx, shortURL)
+	if lookupErr == nil {
+		c.InvalidateURL(previous)
+	}
+	c.Invalidate(shortURL)
+	return err
+}
+
+// Watch drops the links changed by another process, e.g. another replica or
+// the link command, every SyncInterval until ctx is done.
+func (c *URLRepository) Watch(ctx context.Context) {
+	if c.config.SyncInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.config.SyncInterval)
+	defer ticker.Stop()
+	synced := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Overlap the previous sync by an interval, so changes committed
+			// while it ran are not missed.
+			started := time.Now()
+			if err := c.sync(ctx, started.Sub(synced)+c.config.SyncInterval); err != nil {
+				c.logger.Warn("Failed to sync changed links", zap.Error(err))
+				continue
+			}
+			synced = started
+		}
+	}
+}
+
+func (c *URLRepository) sync(ctx context.Context, window time.Duration) error {
+	codes, err := c.URLRepository.FindChanges(ctx, window)
+	if err != nil {
+		return err
+	}
+	if len(codes) > 0 {
+		c.Invalidate(codes...)
+	}
+	return nil
+}
+
+// Invalidate removes the cached lookups for the given short URLs or aliases.
+func (c *URLRepository) Invalidate(keys ...string) {
+	c.generation.Add(1)
+	for _, key := range keys {
+		c.group.Forget(key)
+		c.entries.remove(key)
+	}
+}
+
+// InvalidateURL removes every cached lookup that may resolve to url.
+func (c *URLRepository) InvalidateURL(url models.URL) {
+	c.Invalidate(url.ShortURL)
+	if url.CustomAlias != nil {
+		c.Invalidate(*url.CustomAlias)
+	}
+}
+
+func (c *URLRepository) Stats() Stats {
+	return Stats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Entries:      c.entries.len(),
+	}
+}
@@ -0,0 +1,213 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+	"go.uber.org/zap"
+)
+
+// countingRepository counts backend lookups and can delay them.
+type countingRepository struct {
+	repository.URLRepository
+	lookups atomic.Int64
+	delay   time.Duration
+}
+
+func (r *countingRepository) GetURL(ctx context.Context, shortURL string) (models.URL, error) {
+	r.lookups.Add(1)
+	time.Sleep(r.delay)
+	return r.URLRepository.GetURL(ctx, shortURL)
+}
+
+func testConfig() Config {
+	return Config{Enabled: true, Size: 10, TTL: time.Minute, NegativeTTL: time.Minute}
+}
+
+func TestGetURL_CachesHits(t *testing.T) {
+	backend := &countingRepository{URLRepository: memory.NewURLRepository()}
+	repo := NewURLRepository(backend, testConfig(), zap.NewNop())
+	ctx := context.TODO()
+
+	alias := "alias"
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123", OriginalURL: "https://example.com", CustomAlias: &alias}))
+
+	for range 3 {
+		url, err := repo.GetURL(ctx, "abc123")
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com", url.OriginalURL)
+	}
+	_, err := repo.GetURL(ctx, alias)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), backend.lookups.Load())
+	stats := repo.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(2), stats.Misses)
+	assert.Equal(t, 2, stats.Entries)
+}
+
+func TestGetURL_NegativeCaching(t *testing.T) {
+	backend := &countingRepository{URLRepository: memory.NewURLRepository()}
+	repo := NewURLRepository(backend, testConfig(), zap.NewNop())
+	ctx := context.TODO()
+
+	for range 3 {
+		_, err := repo.GetURL(ctx, "missing")
+		require.ErrorIs(t, err, models.ErrNotFound)
+	}
+	assert.Equal(t, int64(1), backend.lookups.Load())
+	assert.Equal(t, uint64(2), repo.Stats().NegativeHits)
+
+	// Creating the code through the cache drops the negative entry.
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "missing", OriginalURL: "https://example.com"}))
+	url, err := repo.GetURL(ctx, "missing")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", url.OriginalURL)
+}
+
+func TestGetURL_CollapsesConcurrentMisses(t *testing.T) {
+	backend := &countingRepository{URLRepository: memory.NewURLRepository(), delay: 50 * time.Millisecond}
+	repo := NewURLRepository(backend, testConfig(), zap.NewNop())
+	ctx := context.TODO()
+	require.NoError(t, backend.SaveURL(ctx, models.URL{ShortURL: "abc123"}))
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.GetURL(ctx, "abc123")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(1), backend.lookups.Load())
+}
+
+func TestInvalidateURL(t *testing.T) {
+	backend := &countingRepository{URLRepository: memory.NewURLRepository()}
+	repo := NewURLRepository(backend, testConfig(), zap.NewNop())
+	ctx := context.TODO()
+
+	alias := "alias"
+	url := models.URL{ShortURL: "abc123", CustomAlias: &alias}
+	require.NoError(t, repo.SaveURL(ctx, url))
+	_, err := repo.GetURL(ctx, "abc123")
+	require.NoError(t, err)
+	_, err = repo.GetURL(ctx, alias)
+	require.NoError(t, err)
+
+	repo.InvalidateURL(url)
+	assert.Equal(t, 0, repo.Stats().Entries)
+}
+
+func TestLRU_EvictsAndExpires(t *testing.T) {
+	now := time.Now()
+	cache := newLRU[int](2)
+	cache.now = func() time.Time { return now }
+
+	cache.set("a", 1, time.Minute)
+	cache.set("b", 2, time.Minute)
+	_, ok := cache.get("a")
+	require.True(t, ok)
+	cache.set("c", 3, time.Minute)
+
+	_, ok = cache.get("b")
+	assert.False(t, ok, "least recently used entry must be evicted")
+	_, ok = cache.get("a")
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Minute)
+	_, ok = cache.get("c")
+	assert.False(t, ok, "expired entry must not be returned")
+	assert.Equal(t, 1, cache.len())
+}
+
+func TestUpdateURL_InvalidatesPreviousAlias(t *testing.T) {
+	repo := NewURLRepository(memory.NewURLRepository(), testConfig(), zap.NewNop())
+	ctx := context.TODO()
+
+	alias := "old"
+	url := models.URL{ID: "uuid", ShortURL: "abc123", OriginalURL: "https://example.com", CustomAlias: &alias}
+	require.NoError(t, repo.SaveURL(ctx, url))
+	_, err := repo.GetURL(ctx, alias)
+	require.NoError(t, err)
+
+	newAlias := "new"
+	url.CustomAlias = &newAlias
+	url.OriginalURL = "https://example.org"
+	require.NoError(t, repo.UpdateURL(ctx, url))
+
+	_, err = repo.GetURL(ctx, alias)
+	require.ErrorIs(t, err, models.ErrNotFound)
+	resolved, err := repo.GetURL(ctx, newAlias)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org", resolved.OriginalURL)
+}
+
+func TestDeleteURL_Invalidates(t *testing.T) {
+	repo := NewURLRepository(memory.NewURLRepository(), testConfig(), zap.NewNop())
+	ctx := context.TODO()
+
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ID: "uuid", ShortURL: "abc123"}))
+	_, err := repo.GetURL(ctx, "abc123")
+	require.NoError(t, err)
+
+	require.NoError(t, repo.DeleteURL(ctx, "abc123"))
+	_, err = repo.GetURL(ctx, "abc123")
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestWatch_DropsLinksChangedElsewhere(t *testing.T) {
+	backend := memory.NewURLRepository()
+	cfg := testConfig()
+	cfg.SyncInterval = 10 * time.Millisecond
+	repo := NewURLRepository(backend, cfg, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alias := "alias"
+	blocked := models.URL{ID: "1", ShortURL: "blocked", CustomAlias: &alias}
+	disabled := models.URL{ID: "2", ShortURL: "disabled"}
+	for _, url := range []models.URL{blocked, disabled, {ID: "3", ShortURL: "deleted"}} {
+		require.NoError(t, repo.SaveURL(ctx, url))
+	}
+	for _, code := range []string{"blocked", alias, "disabled", "deleted", "new"} {
+		_, _ = repo.GetURL(ctx, code)
+	}
+
+	// Another process changes the links, bypassing this cache.
+	require.NoError(t, backend.SetBlocked(ctx, "blocked", true))
+	disabled.Disabled = true
+	newAlias := "new"
+	disabled.CustomAlias = &newAlias
+	require.NoError(t, backend.UpdateURL(ctx, disabled))
+	require.NoError(t, backend.DeleteURL(ctx, "deleted"))
+	url, err := repo.GetURL(ctx, "blocked")
+	require.NoError(t, err)
+	require.False(t, url.Blocked)
+
+	go repo.Watch(ctx)
+	for code, changed := range map[string]func(models.URL, error) bool{
+		"blocked":  func(url models.URL, err error) bool { return err == nil && url.Blocked },
+		alias:      func(url models.URL, err error) bool { return err == nil && url.Blocked },
+		"disabled": func(url models.URL, err error) bool { return err == nil && url.Disabled },
+		"new":      func(url models.URL, err error) bool { return err == nil && url.ShortURL == "disabled" },
+		"deleted":  func(_ models.URL, err error) bool { return errors.Is(err, models.ErrNotFound) },
+	} {
+		assert.Eventually(t, func() bool {
+			return changed(repo.GetURL(ctx, code))
+		}, time.Second, 10*time.Millisecond, code)
+	}
+}
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	Enabled     bool          `envconfig:"CACHE_ENABLED" default:"true"`
+	Size        int           `envconfig:"CACHE_SIZE" default:"10000"`
+	TTL         time.Duration `envconfig:"CACHE_TTL" default:"5m"`
+	NegativeTTL time.Duration `envconfig:"CACHE_NEGATIVE_TTL" default:"30s"`
+	// SyncInterval is how often links changed by other processes, e.g. other
+	// replicas or the link command, are dropped from the cache. Until then
+	// lookups may return the cached link. 0 turns the sync off, then changes
+	// only show up after TTL.
+	SyncInterval time.Duration `envconfig:"CACHE_SYNC_INTERVAL" default:"10s"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.Size, validation.When(c.Enabled, validation.Required, validation.Min(1))),
+		validation.Field(&c.TTL, validation.When(c.Enabled, validation.Required)),
+		validation.Field(&c.NegativeTTL, validation.Min(time.Duration(0))),
+		validation.Field(&c.SyncInterval, validation.Min(time.Duration(0))),
+	)
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// maxClaimAttempts bounds the retries of ClaimIdempotencyKey when the
+// conflicting record disappears before it can be read.
+const maxClaimAttempts = 3
+
+type IdempotencyRepository interface {
+	// ClaimIdempotencyKey stores record unless an unexpired record with the
+	// same scope and key exists, which is returned instead. claimed reports
+	// whether record was stored. Claims should expire soon, so the key is not
+	// blocked for long if the claiming request never completes.
+	ClaimIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) (
+		existing models.IdempotencyRecord, claimed bool, err error)
+	// CompleteIdempotencyKey stores the response and the expiration of a
+	// claimed record.
+	CompleteIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error
+	// ReleaseIdempotencyKey removes a claimed record, so the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, scope, key string) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) IdempotencyRepository {
+	return &idempotencyRepository{db: db}
+}
+
+func (repo *idempotencyRepository) ClaimIdempotencyKey(
+	ctx context.Context, record models.IdempotencyRecord,
+) (models.IdempotencyRecord, bool, error) {
+	for attempt := 1; ; attempt++ {
+		existing, claimed, err := repo.claim(ctx, record)
+		// The conflicting record was released or expired before it was read.
+		if errors.Is(err, sql.ErrNoRows) && attempt < maxClaimAttempts {
+			continue
+		}
+		return existing, claimed, err
+	}
+}
+
+func (repo *idempotencyRepository) claim(
+	ctx context.Context, record models.IdempotencyRecord,
+) (models.IdempotencyRecord, bool, error) {
+	// An expired record, a finished one or a stale claim, no longer blocks its key.
+	_, err := repo.db.ExecContext(ctx, `
+        DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND expires_at <= $3`,
+		record.Scope, record.Key, record.CreatedAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+
+	result, err := repo.db.ExecContext(ctx, `
+        INSERT INTO idempotency_keys (scope, idempotency_key, fingerprint, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5)
+        ON CONFLICT DO NOTHING`,
+		record.Scope, record.Key, record.Fingerprint, record.CreatedAt, record.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	if affected == 1 {
+		return record, true, nil
+	}
+
+	existing := models.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	var (
+		statusCode  sql.NullInt64
+		contentType sql.NullString
+	)
+	err = repo.db.QueryRowContext(ctx, `
+        SELECT fingerprint, status_code, content_type, response_body, created_at, expires_at
+        FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2`, record.Scope, record.Key).
+		Scan(&existing.Fingerprint, &statusCode, &contentType, &existing.Body, &existing.CreatedAt, &existing.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("read idempotency key: %w", err)
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	existing.ContentType = contentType.String
+	return existing, false, nil
+}
+
+func (repo *idempotencyRepository) CompleteIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	result, err := repo.db.ExecContext(ctx, `
+        UPDATE idempotency_keys SET status_code = $3, content_type = $4, response_body = $5, expires_at = $6
+        WHERE scope = $1 AND idempotency_key = $2 AND status_code IS NULL`,
+		record.Scope, record.Key, record.StatusCode, record.ContentType, record.Body, record.ExpiresAt)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (repo *idempotencyRepository) ReleaseIdempotencyKey(ctx context.Context, scope, key string) error {
+	_, err := repo.db.ExecContext(ctx, `
+        DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND status_code IS NULL`, scope, key)
+	return err
+}
+
+func (repo *idempotencyRepository) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int64, error) {
+	result, err := repo.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewIdempotencyRepository(db)
+
+	now := time.Now()
+	record := models.IdempotencyRecord{
+		Scope: "alice /shorten", Key: "key", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	}
+	deleteExpired := regexp.QuoteMeta(
+		`DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND expires_at <= $3`)
+	insert := regexp.QuoteMeta(`INSERT INTO idempotency_keys`)
+
+	mock.ExpectExec(deleteExpired).WithArgs(record.Scope, record.Key, now).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).
+		WithArgs(record.Scope, record.Key, record.Fingerprint, record.CreatedAt, record.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, claimed, err := repo.ClaimIdempotencyKey(context.TODO(), record)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	mock.ExpectExec(deleteExpired).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        SELECT fingerprint, status_code, content_type, response_body, created_at, expires_at
+        FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2`)).
+		WithArgs(record.Scope, record.Key).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"fingerprint", "status_code", "content_type", "response_body", "created_at", "expires_at",
+		}).AddRow("abc", 200, "application/json", []byte(`{}`), now, now.Add(time.Hour)))
+
+	existing, claimed, err := repo.ClaimIdempotencyKey(context.TODO(), record)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, 200, existing.StatusCode)
+	assert.Equal(t, []byte(`{}`), existing.Body)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClaimIdempotencyKey_RetriesReleasedConflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewIdempotencyRepository(db)
+
+	now := time.Now()
+	record := models.IdempotencyRecord{
+		Scope: "alice /shorten", Key: "key", Fingerprint: "abc", CreatedAt: now, ExpiresAt: now.Add(time.Minute),
+	}
+	deleteExpired := regexp.QuoteMeta(`DELETE FROM idempotency_keys`)
+	insert := regexp.QuoteMeta(`INSERT INTO idempotency_keys`)
+
+	// The conflicting claim is released between the INSERT and the SELECT.
+	mock.ExpectExec(deleteExpired).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT fingerprint`)).WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(deleteExpired).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, claimed, err := repo.ClaimIdempotencyKey(context.TODO(), record)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompleteIdempotencyKey_ExtendsExpiration(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewIdempotencyRepository(db)
+
+	record := models.IdempotencyRecord{
+		Scope: "alice /shorten", Key: "key", StatusCode: 200, ContentType: "application/json", Body: []byte(`{}`),
+		ExpiresAt: time.Now().Add(24 * time.Hour),
+	}
+	mock.ExpectExec(regexp.QuoteMeta(`
+        UPDATE idempotency_keys SET status_code = $3, content_type = $4, response_body = $5, expires_at = $6
+        WHERE scope = $1 AND idempotency_key = $2 AND status_code IS NULL`)).
+		WithArgs(record.Scope, record.Key, record.StatusCode, record.ContentType, record.Body, record.ExpiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	require.NoError(t, repo.CompleteIdempotencyKey(context.TODO(), record))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
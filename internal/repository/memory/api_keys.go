@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+)
+
+// apiKeyRepository keeps API keys in process memory, indexed by hash.
+type apiKeyRepository struct {
+	mu     sync.RWMutex
+	keys   map[string]models.APIKey
+	hashes map[string]string
+}
+
+func NewAPIKeyRepository() repository.APIKeyRepository {
+	return &apiKeyRepository{
+		keys:   make(map[string]models.APIKey),
+		hashes: make(map[string]string),
+	}
+}
+
+func (repo *apiKeyRepository) SaveAPIKey(_ context.Context, key models.APIKey) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.hashes[key.KeyHash]; ok {
+		return errors.New("save api key: duplicate key hash")
+	}
+	repo.keys[key.ID] = key
+	repo.hashes[key.KeyHash] = key.ID
+	return nil
+}
+
+func (repo *apiKeyRepository) GetAPIKeyByHash(_ context.Context, hash string) (models.APIKey, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	id, ok := repo.hashes[hash]
+	if !ok {
+		return models.APIKey{}, models.ErrNotFound
+	}
+	return repo.keys[id], nil
+}
+
+func (repo *apiKeyRepository) RevokeAPIKey(_ context.Context, id string, revokedAt time.Time) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	key, ok := repo.keys[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &revokedAt
+		repo.keys[id] = key
+	}
+	return nil
+}
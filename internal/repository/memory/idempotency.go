@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+)
+
+type idempotencyKey struct {
+	scope string
+	key   string
+}
+
+// idempotencyRepository keeps idempotency records in process memory.
+type idempotencyRepository struct {
+	mu      sync.Mutex
+	records map[idempotencyKey]models.IdempotencyRecord
+}
+
+func NewIdempotencyRepository() repository.IdempotencyRepository {
+	return &idempotencyRepository{records: make(map[idempotencyKey]models.IdempotencyRecord)}
+}
+
+func (repo *idempotencyRepository) ClaimIdempotencyKey(
+	_ context.Context, record models.IdempotencyRecord,
+) (models.IdempotencyRecord, bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	id := idempotencyKey{scope: record.Scope, key: record.Key}
+	if existing, ok := repo.records[id]; ok && existing.ExpiresAt.After(record.CreatedAt) {
+		return existing, false, nil
+	}
+	repo.records[id] = record
+	return record, true, nil
+}
+
+func (repo *idempotencyRepository) CompleteIdempotencyKey(_ context.Context, record models.IdempotencyRecord) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	id := idempotencyKey{scope: record.Scope, key: record.Key}
+	existing, ok := repo.records[id]
+	if !ok || existing.StatusCode != 0 {
+		return models.ErrNotFound
+	}
+	existing.StatusCode = record.StatusCode
+	existing.ContentType = record.ContentType
+	existing.Body = record.Body
+	existing.ExpiresAt = record.ExpiresAt
+	repo.records[id] = existing
+	return nil
+}
+
+func (repo *idempotencyRepository) ReleaseIdempotencyKey(_ context.Context, scope, key string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	id := idempotencyKey{scope: scope, key: key}
+	if existing, ok := repo.records[id]; ok && existing.StatusCode == 0 {
+		delete(repo.records, id)
+	}
+	return nil
+}
+
+func (repo *idempotencyRepository) DeleteExpiredIdempotencyKeys(_ context.Context, now time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var deleted int64
+	for id, record := range repo.records {
+		if !record.ExpiresAt.After(now) {
+			delete(repo.records, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
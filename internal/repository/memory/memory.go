@@ -0,0 +1,516 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+)
+
+// urlRepository keeps URLs and redirect logs in process memory. It is meant
+// for tests and local development and loses all data on restart.
+type urlRepository struct {
+	mu      sync.RWMutex
+	urls    map[string]models.URL
+	ids     map[string]string
+	aliases map[string]string
+	logs    map[string][]models.RedirectLog
+	// changes holds when the link behind a short URL or alias last changed.
+	changes map[string]time.Time
+	// passwordFailures counts the wrong passwords per short URL.
+	passwordFailures map[string]failureWindow
+}
+
+// failureWindow counts the password failures since start.
+type failureWindow struct {
+	start    time.Time
+	failures int
+}
+
+func NewURLRepository() repository.URLRepository {
+	return &urlRepository{
+		urls:             make(map[string]models.URL),
+		ids:              make(map[string]string),
+		aliases:          make(map[string]string),
+		logs:             make(map[string][]models.RedirectLog),
+		changes:          make(map[string]time.Time),
+		passwordFailures: make(map[string]failureWindow),
+	}
+}
+
+func (repo *urlRepository) SaveURL(_ context.Context, url models.URL) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.urls[url.ShortURL]; ok {
+		return models.ErrShortURLTaken
+	}
+	if url.CustomAlias != nil {
+		if _, ok := repo.aliases[*url.CustomAlias]; ok {
+			return models.ErrAliasTaken
+		}
+		repo.aliases[*url.CustomAlias] = url.ShortURL
+	}
+	repo.urls[url.ShortURL] = url
+	repo.ids[url.ID] = url.ShortURL
+	return nil
+}
+
+func (repo *urlRepository) SaveURLs(_ context.Context, urls []models.URL, skipConflicts bool) ([]string, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	// Codes and aliases claimed by earlier rows of the same batch conflict as well.
+	codes := make(map[string]struct{})
+	aliases := make(map[string]struct{})
+	conflicts := func(url models.URL) error {
+		_, stored := repo.urls[url.ShortURL]
+		_, claimed := codes[url.ShortURL]
+		if stored || claimed {
+			return models.ErrShortURLTaken
+		}
+		if url.CustomAlias != nil {
+			_, stored = repo.aliases[*url.CustomAlias]
+			_, claimed = aliases[*url.CustomAlias]
+			if stored || claimed {
+				return models.ErrAliasTaken
+			}
+		}
+		return nil
+	}
+
+	accepted := make([]models.URL, 0, len(urls))
+	for _, url := range urls {
+		if err := conflicts(url); err != nil {
+			if skipConflicts {
+				continue
+			}
+			return nil, err
+		}
+		codes[url.ShortURL] = struct{}{}
+		if url.CustomAlias != nil {
+			aliases[*url.CustomAlias] = struct{}{}
+		}
+		accepted = append(accepted, url)
+	}
+
+	saved := make([]string, 0, len(accepted))
+	for _, url := range accepted {
+		if url.CustomAlias != nil {
+			repo.aliases[*url.CustomAlias] = url.ShortURL
+		}
+		repo.urls[url.ShortURL] = url
+		repo.ids[url.ID] = url.ShortURL
+		saved = append(saved, url.ID)
+	}
+	return saved, nil
+}
+
+func (repo *urlRepository) GetURL(_ context.Context, shortURL string) (models.URL, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	url, ok := repo.lookup(shortURL)
+	if !ok {
+		return models.URL{}, models.ErrNotFound
+	}
+	return url, nil
+}
+
+func (repo *urlRepository) FindTakenCodes(_ context.Context, codes []string) ([]string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var taken []string
+	for _, code := range codes {
+		if _, ok := repo.lookup(code); ok {
+			taken = append(taken, code)
+		}
+	}
+	return taken, nil
+}
+
+func (repo *urlRepository) FindByDestination(_ context.Context, hash string, owner *string) (models.URL, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var (
+		newest models.URL
+		found  bool
+	)
+	for _, url := range repo.urls {
+		switch {
+		case url.DestinationHash != hash, !sameOwner(url.OwnerID, owner),
+			url.CustomAlias != nil, url.ExpiredAt != nil, url.RedirectType != 0, url.Disabled, url.Blocked,
+			url.MaxClicks != nil, url.PasswordHash != "", url.ActivatesAt != nil,
+			url.FallbackURL != "":
+			continue
+		}
+		if !found || url.CreatedAt.After(newest.CreatedAt) {
+			newest, found = url, true
+		}
+	}
+	if !found {
+		return models.URL{}, models.ErrNotFound
+	}
+	return newest, nil
+}
+
+func (repo *urlRepository) ConsumeClick(_ context.Context, shortURL string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	url, ok := repo.urls[shortURL]
+	if !ok || (url.MaxClicks != nil && url.ClickCount >= *url.MaxClicks) {
+		return models.ErrClickLimitReached
+	}
+	url.ClickCount++
+	repo.urls[shortURL] = url
+	return nil
+}
+
+func (repo *urlRepository) SetBlocked(_ context.Context, shortURL string, blocked bool) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	url, ok := repo.urls[shortURL]
+	if !ok {
+		return models.ErrNotFound
+	}
+	url.Blocked = blocked
+	repo.urls[shortURL] = url
+	repo.recordChange(url)
+	return nil
+}
+
+func (repo *urlRepository) FindChanges(_ context.Context, window time.Duration) ([]string, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	since := time.Now().Add(-window)
+	var codes []string
+	for code, changedAt := range repo.changes {
+		if !changedAt.Before(since) {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+// recordChange stamps the short URL and alias of url for FindChanges, the
+// caller must hold the write lock.
+func (repo *urlRepository) recordChange(url models.URL) {
+	now := time.Now()
+	repo.changes[url.ShortURL] = now
+	if url.CustomAlias != nil {
+		repo.changes[*url.CustomAlias] = now
+	}
+}
+
+func (repo *urlRepository) CountPasswordFailure(_ context.Context, shortURL string, window time.Duration) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	// Mirrors the password_failures foreign key on urls(short_url).
+	if _, ok := repo.urls[shortURL]; !ok {
+		return 0, fmt.Errorf("count password failure: %w", models.ErrNotFound)
+	}
+	now := time.Now()
+	current := repo.passwordFailures[shortURL]
+	if !current.start.After(now.Add(-window)) {
+		current = failureWindow{start: now}
+	}
+	current.failures++
+	repo.passwordFailures[shortURL] = current
+	return current.failures, nil
+}
+
+func (repo *urlRepository) GetPasswordFailures(_ context.Context, shortURL string, window time.Duration) (int, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	current := repo.passwordFailures[shortURL]
+	if !current.start.After(time.Now().Add(-window)) {
+		return 0, nil
+	}
+	return current.failures, nil
+}
+
+func sameOwner(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func (repo *urlRepository) UpdateURL(_ context.Context, url models.URL) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	shortURL, ok := repo.ids[url.ID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	current := repo.urls[shortURL]
+
+	newAlias := url.CustomAlias
+	if newAlias != nil && (current.CustomAlias == nil || *current.CustomAlias != *newAlias) {
+		if owner, taken := repo.aliases[*newAlias]; taken && owner != shortURL {
+			return models.ErrAliasTaken
+		}
+	}
+	repo.recordChange(current)
+	if current.CustomAlias != nil {
+		delete(repo.aliases, *current.CustomAlias)
+	}
+	if newAlias != nil {
+		repo.aliases[*newAlias] = shortURL
+		repo.changes[*newAlias] = time.Now()
+	}
+
+	// Only the mutable columns change, like the UPDATE of the Postgres repository.
+	current.OriginalURL = url.OriginalURL
+	current.CustomAlias = url.CustomAlias
+	current.ExpiredAt = url.ExpiredAt
+	current.ActivatesAt = url.ActivatesAt
+	current.Disabled = url.Disabled
+	current.UpdatedAt = url.UpdatedAt
+	current.RedirectType = url.RedirectType
+	current.DestinationHash = url.DestinationHash
+	current.PasswordHash = url.PasswordHash
+	current.FallbackURL = url.FallbackURL
+	repo.urls[shortURL] = current
+	return nil
+}
+
+func (repo *urlRepository) DeleteURL(_ context.Context, shortURL string) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	url, ok := repo.urls[shortURL]
+	if !ok {
+		return models.ErrNotFound
+	}
+	repo.recordChange(url)
+	if url.CustomAlias != nil {
+		delete(repo.aliases, *url.CustomAlias)
+	}
+	delete(repo.ids, url.ID)
+	delete(repo.urls, shortURL)
+	delete(repo.logs, shortURL)
+	delete(repo.passwordFailures, shortURL)
+	return nil
+}
+
+func (repo *urlRepository) SaveRedirectLog(_ context.Context, log models.RedirectLog) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	// Mirrors the redirect_logs foreign key on urls(short_url).
+	if _, ok := repo.urls[log.ShortURL]; !ok {
+		return fmt.Errorf("save redirect log: %w", models.ErrNotFound)
+	}
+	repo.logs[log.ShortURL] = append(repo.logs[log.ShortURL], log)
+	return nil
+}
+
+// SaveRedirectLogs stores logs atomically: either all of them or none.
+func (repo *urlRepository) SaveRedirectLogs(_ context.Context, logs []models.RedirectLog) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	for _, log := range logs {
+		if _, ok := repo.urls[log.ShortURL]; !ok {
+			return fmt.Errorf("save redirect logs: %w", models.ErrNotFound)
+		}
+	}
+	for _, log := range logs {
+		repo.logs[log.ShortURL] = append(repo.logs[log.ShortURL], log)
+	}
+	return nil
+}
+
+func (repo *urlRepository) GetStats(_ context.Context, shortURL string) (models.StatsResponse, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	var stats models.StatsResponse
+	url, ok := repo.lookup(shortURL)
+	if !ok {
+		return stats, models.ErrNotFound
+	}
+	stats.CreatedAt = url.CreatedAt
+	stats.ExpiresAt = url.ExpiredAt
+	if url.MaxClicks != nil {
+		remaining := max(*url.MaxClicks-url.ClickCount, 0)
+		stats.MaxClicks, stats.RemainingClicks = url.MaxClicks, &remaining
+	}
+
+	for _, log := range repo.logs[url.ShortURL] {
+		switch {
+		case log.FallbackReason != nil:
+			continue
+		case log.Bot:
+			stats.BotCount++
+			continue
+		}
+		stats.RedirectCount++
+		if stats.LastAccessed == nil || log.AccessedAt.After(*stats.LastAccessed) {
+			accessedAt := log.AccessedAt
+			stats.LastAccessed = &accessedAt
+		}
+	}
+
+	return stats, nil
+}
+
+func (repo *urlRepository) GetClickSeries(
+	_ context.Context, shortURL string, query models.StatsQuery,
+) ([]models.ClickBucket, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	loc := query.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	counts := make(map[int64]*models.ClickBucket)
+	var buckets []*models.ClickBucket
+	for _, log := range repo.logs[shortURL] {
+		if !counted(log) || log.AccessedAt.Before(query.From) || !log.AccessedAt.Before(query.To) {
+			continue
+		}
+		start := query.Granularity.Truncate(log.AccessedAt, loc)
+		bucket, ok := counts[start.Unix()]
+		if !ok {
+			bucket = &models.ClickBucket{Start: start}
+			counts[start.Unix()] = bucket
+			buckets = append(buckets, bucket)
+		}
+		bucket.Clicks++
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+
+	series := make([]models.ClickBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		series = append(series, *bucket)
+	}
+	return series, nil
+}
+
+func (repo *urlRepository) GetReferrers(
+	_ context.Context, shortURL string, query models.ReferrerQuery,
+) (models.ReferrerPage, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	page := models.ReferrerPage{Group: query.Group, Limit: query.Limit, Offset: query.Offset}
+	if query.Group != models.ReferrerGroupHost && query.Group != models.ReferrerGroupURL {
+		return page, fmt.Errorf("%w: unknown referrer group %q", models.ErrInvalidRequest, query.Group)
+	}
+	clicks := make(map[string]int)
+	for _, log := range repo.logs[shortURL] {
+		if counted(log) {
+			clicks[referrerKey(log, query.Group)]++
+		}
+	}
+	items := make([]models.ReferrerCount, 0, len(clicks))
+	for referrer, n := range clicks {
+		items = append(items, models.ReferrerCount{Referrer: referrer, Clicks: n})
+	}
+	// Same order as the Postgres repository: most clicks first, ties by name.
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Clicks != items[j].Clicks {
+			return items[i].Clicks > items[j].Clicks
+		}
+		return items[i].Referrer < items[j].Referrer
+	})
+
+	page.Total = len(items)
+	start := min(query.Offset, len(items))
+	page.Items = items[start:min(start+query.Limit, len(items))]
+	return page, nil
+}
+
+// referrerKey mirrors the grouping expressions of the Postgres repository.
+func referrerKey(log models.RedirectLog, group string) string {
+	switch {
+	case group == models.ReferrerGroupHost && log.ReferrerHost != nil:
+		return *log.ReferrerHost
+	case log.Referrer != nil:
+		return *log.Referrer
+	default:
+		return models.DirectReferrer
+	}
+}
+
+// lookup resolves shortURL either as a short code or as a custom alias.
+// Callers must hold repo.mu.
+func (repo *urlRepository) lookup(shortURL string) (models.URL, bool) {
+	if url, ok := repo.urls[shortURL]; ok {
+		return url, true
+	}
+	if code, ok := repo.aliases[shortURL]; ok {
+		url, found := repo.urls[code]
+		return url, found
+	}
+	return models.URL{}, false
+}
+
+func (repo *urlRepository) GetBreakdown(
+	_ context.Context, shortURL, dimension string, limit int,
+) ([]models.DimensionCount, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	switch dimension {
+	case models.DimensionBrowser, models.DimensionOS, models.DimensionDevice, models.DimensionCountry:
+	default:
+		return nil, fmt.Errorf("%w: unknown dimension %q", models.ErrInvalidRequest, dimension)
+	}
+	clicks := make(map[string]int)
+	for _, log := range repo.logs[shortURL] {
+		if counted(log) {
+			clicks[dimensionValue(log, dimension)]++
+		}
+	}
+	counts := make([]models.DimensionCount, 0, len(clicks))
+	for value, n := range clicks {
+		counts = append(counts, models.DimensionCount{Value: value, Clicks: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Clicks != counts[j].Clicks {
+			return counts[i].Clicks > counts[j].Clicks
+		}
+		return counts[i].Value < counts[j].Value
+	})
+	return counts[:min(limit, len(counts))], nil
+}
+
+// counted reports whether log is a redirect counted by the statistics.
+func counted(log models.RedirectLog) bool {
+	return log.FallbackReason == nil && !log.Bot
+}
+
+// dimensionValue mirrors the breakdown columns of the Postgres repository.
+func dimensionValue(log models.RedirectLog, dimension string) string {
+	var value string
+	switch dimension {
+	case models.DimensionBrowser:
+		value = log.Browser
+	case models.DimensionOS:
+		value = log.OS
+	case models.DimensionDevice:
+		value = log.Device
+	case models.DimensionCountry:
+		value = log.Country
+	}
+	if value == "" {
+		return "unknown"
+	}
+	return value
+}
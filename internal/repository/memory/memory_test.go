@@ -0,0 +1,337 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
+)
+
+func TestSaveAndGetURL(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+
+	alias := "myalias"
+	url := models.URL{
+		ID:          "uuid",
+		OriginalURL: "https://example.com",
+		ShortURL:    "abc123",
+		CustomAlias: &alias,
+		CreatedAt:   time.Now(),
+	}
+	require.NoError(t, repo.SaveURL(ctx, url))
+
+	result, err := repo.GetURL(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, url, result)
+
+	result, err = repo.GetURL(ctx, alias)
+	require.NoError(t, err)
+	assert.Equal(t, url, result)
+
+	_, err = repo.GetURL(ctx, "missing")
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestSaveURL_Duplicates(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+
+	alias := "taken"
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123", CustomAlias: &alias}))
+
+	require.ErrorIs(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123"}), models.ErrShortURLTaken)
+	require.ErrorIs(t, repo.SaveURL(ctx, models.URL{ShortURL: "other", CustomAlias: &alias}), models.ErrAliasTaken)
+}
+
+func TestSaveRedirectLog_UnknownURL(t *testing.T) {
+	repo := NewURLRepository()
+
+	err := repo.SaveRedirectLog(context.TODO(), models.RedirectLog{ID: "uuid", ShortURL: "missing"})
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestGetStats(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+
+	createdAt := time.Now().Add(-2 * time.Hour)
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123", CreatedAt: createdAt, ExpiredAt: &expiresAt}))
+
+	ref1, ref2 := "https://referrer1.com", "https://referrer2.com"
+	lastAccessed := time.Now()
+	logs := []models.RedirectLog{
+		{ID: "1", ShortURL: "abc123", AccessedAt: lastAccessed.Add(-time.Minute), Referrer: &ref1},
+		{ID: "2", ShortURL: "abc123", AccessedAt: lastAccessed, Referrer: &ref2},
+		{ID: "3", ShortURL: "abc123", AccessedAt: lastAccessed.Add(-time.Hour), Referrer: &ref1},
+		{ID: "4", ShortURL: "abc123", AccessedAt: lastAccessed.Add(-time.Hour)},
+	}
+	for _, log := range logs {
+		require.NoError(t, repo.SaveRedirectLog(ctx, log))
+	}
+
+	stats, err := repo.GetStats(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.RedirectCount)
+	assert.Equal(t, createdAt, stats.CreatedAt)
+	assert.Equal(t, &expiresAt, stats.ExpiresAt)
+	assert.Equal(t, &lastAccessed, stats.LastAccessed)
+
+	_, err = repo.GetStats(ctx, "missing")
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestGetClickSeries(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123"}))
+
+	day := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	reason := "expired"
+	logs := []models.RedirectLog{
+		{ID: "1", ShortURL: "abc123", AccessedAt: day.Add(23 * time.Hour)},
+		{ID: "2", ShortURL: "abc123", AccessedAt: day.Add(-time.Hour)},
+		{ID: "3", ShortURL: "abc123", AccessedAt: day.Add(time.Hour)},
+		{ID: "4", ShortURL: "abc123", AccessedAt: day.Add(2 * time.Hour), FallbackReason: &reason},
+		{ID: "5", ShortURL: "abc123", AccessedAt: day.AddDate(0, 0, 5)},
+	}
+	for _, log := range logs {
+		require.NoError(t, repo.SaveRedirectLog(ctx, log))
+	}
+
+	// 23:00 UTC is already the next day in Berlin.
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	series, err := repo.GetClickSeries(ctx, "abc123", models.StatsQuery{
+		From: day.Add(-2 * time.Hour), To: day.AddDate(0, 0, 2), Granularity: timebucket.Day, Location: berlin,
+	})
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	assert.Equal(t, time.Date(2024, time.May, 1, 0, 0, 0, 0, berlin), series[0].Start)
+	assert.Equal(t, 2, series[0].Clicks)
+	assert.Equal(t, time.Date(2024, time.May, 2, 0, 0, 0, 0, berlin), series[1].Start)
+	assert.Equal(t, 1, series[1].Clicks)
+}
+
+func TestGetReferrers(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123"}))
+
+	a, b, app := "https://news.example/a", "https://news.example/b", "android-app://com.example"
+	host, reason := "news.example", "expired"
+	logs := []models.RedirectLog{
+		{ID: "1", ShortURL: "abc123", Referrer: &a, ReferrerHost: &host},
+		{ID: "2", ShortURL: "abc123", Referrer: &b, ReferrerHost: &host},
+		{ID: "3", ShortURL: "abc123", Referrer: &b, ReferrerHost: &host, FallbackReason: &reason},
+		{ID: "4", ShortURL: "abc123"},
+		{ID: "5", ShortURL: "abc123", Referrer: &app},
+	}
+	for _, log := range logs {
+		require.NoError(t, repo.SaveRedirectLog(ctx, log))
+	}
+
+	page, err := repo.GetReferrers(ctx, "abc123", models.ReferrerQuery{Group: models.ReferrerGroupHost, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, []models.ReferrerCount{{Referrer: host, Clicks: 2}, {Referrer: app, Clicks: 1}}, page.Items)
+
+	page, err = repo.GetReferrers(ctx, "abc123", models.ReferrerQuery{Group: models.ReferrerGroupURL, Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, 4, page.Total)
+	// Ties are ordered by name: android-app, direct, then the two news URLs.
+	assert.Equal(t, []models.ReferrerCount{{Referrer: a, Clicks: 1}, {Referrer: b, Clicks: 1}}, page.Items)
+}
+
+func TestGetBreakdown(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123"}))
+
+	reason := "expired"
+	logs := []models.RedirectLog{
+		{ID: "1", ShortURL: "abc123", Browser: "Firefox", Device: "desktop", Country: "DE"},
+		{ID: "2", ShortURL: "abc123", Browser: "Chrome", Device: "mobile"},
+		{ID: "3", ShortURL: "abc123", Browser: "Chrome", Device: "mobile"},
+		{ID: "4", ShortURL: "abc123", Browser: "Chrome", Device: "mobile", FallbackReason: &reason},
+		{ID: "5", ShortURL: "abc123", Browser: "Other", Device: "bot", Bot: true},
+		{ID: "6", ShortURL: "abc123"},
+	}
+	for _, log := range logs {
+		require.NoError(t, repo.SaveRedirectLog(ctx, log))
+	}
+
+	browsers, err := repo.GetBreakdown(ctx, "abc123", models.DimensionBrowser, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DimensionCount{{Value: "Chrome", Clicks: 2}, {Value: "Firefox", Clicks: 1}}, browsers)
+
+	devices, err := repo.GetBreakdown(ctx, "abc123", models.DimensionDevice, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DimensionCount{
+		{Value: "mobile", Clicks: 2}, {Value: "desktop", Clicks: 1}, {Value: "unknown", Clicks: 1},
+	}, devices)
+
+	countries, err := repo.GetBreakdown(ctx, "abc123", models.DimensionCountry, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DimensionCount{{Value: "unknown", Clicks: 3}, {Value: "DE", Clicks: 1}}, countries)
+
+	stats, err := repo.GetStats(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, 4, stats.RedirectCount)
+	assert.Equal(t, 1, stats.BotCount)
+
+	_, err = repo.GetBreakdown(ctx, "abc123", "language", 10)
+	require.ErrorIs(t, err, models.ErrInvalidRequest)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123"}))
+
+	var wg sync.WaitGroup
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: fmt.Sprintf("code%d", i)}))
+			assert.NoError(t, repo.SaveRedirectLog(ctx, models.RedirectLog{ShortURL: "abc123", AccessedAt: time.Now()}))
+			_, err := repo.GetStats(ctx, "abc123")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	stats, err := repo.GetStats(ctx, "abc123")
+	require.NoError(t, err)
+	assert.Equal(t, 50, stats.RedirectCount)
+}
+
+func TestSaveURLs(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+
+	taken := "taken"
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ID: "existing", ShortURL: "abc", CustomAlias: &taken}))
+
+	dup := "dup"
+	urls := []models.URL{
+		{ID: "code-conflict", ShortURL: "abc"},
+		{ID: "alias-conflict", ShortURL: taken, CustomAlias: &taken},
+		{ID: "first", ShortURL: "dup", CustomAlias: &dup},
+		{ID: "batch-conflict", ShortURL: "dup", CustomAlias: &dup},
+		{ID: "free", ShortURL: "free"},
+	}
+
+	_, err := repo.SaveURLs(ctx, urls, false)
+	require.ErrorIs(t, err, models.ErrShortURLTaken)
+	_, err = repo.GetURL(ctx, "free")
+	require.ErrorIs(t, err, models.ErrNotFound, "a failed batch stores nothing")
+
+	saved, err := repo.SaveURLs(ctx, urls, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "free"}, saved)
+	result, err := repo.GetURL(ctx, dup)
+	require.NoError(t, err)
+	assert.Equal(t, "first", result.ID)
+}
+
+func TestFindByDestination(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+
+	now := time.Now()
+	alice, bob := "alice", "bob"
+	later := now.Add(time.Hour)
+	alias := "mine"
+	for _, url := range []models.URL{
+		{ID: "old", ShortURL: "old", DestinationHash: "h", OwnerID: &alice, CreatedAt: now.Add(-2 * time.Hour)},
+		{ID: "new", ShortURL: "new", DestinationHash: "h", OwnerID: &alice, CreatedAt: now.Add(-time.Hour)},
+		{ID: "expiring", ShortURL: "expiring", DestinationHash: "h", OwnerID: &alice, CreatedAt: now, ExpiredAt: &later},
+		{ID: "permanent", ShortURL: "permanent", DestinationHash: "h", OwnerID: &alice, CreatedAt: now, RedirectType: 301},
+		{ID: "disabled", ShortURL: "disabled", DestinationHash: "h", OwnerID: &alice, CreatedAt: now, Disabled: true},
+		{ID: "alias", ShortURL: "alias", DestinationHash: "h", OwnerID: &alice, CreatedAt: now, CustomAlias: &alias},
+		{ID: "other", ShortURL: "other", DestinationHash: "other", OwnerID: &alice, CreatedAt: now},
+	} {
+		require.NoError(t, repo.SaveURL(ctx, url))
+	}
+
+	url, err := repo.FindByDestination(ctx, "h", &alice)
+	require.NoError(t, err)
+	assert.Equal(t, "new", url.ID)
+
+	_, err = repo.FindByDestination(ctx, "h", &bob)
+	require.ErrorIs(t, err, models.ErrNotFound)
+	_, err = repo.FindByDestination(ctx, "h", nil)
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestConsumeClick_Concurrent(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+
+	limit := 10
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123", MaxClicks: &limit}))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.ConsumeClick(ctx, "abc123")
+			if err == nil {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, models.ErrClickLimitReached)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, limit, allowed)
+
+	stats, err := repo.GetStats(ctx, "abc123")
+	require.NoError(t, err)
+	require.NotNil(t, stats.RemainingClicks)
+	assert.Equal(t, 0, *stats.RemainingClicks)
+}
+
+func TestCountPasswordFailure_Window(t *testing.T) {
+	repo := NewURLRepository()
+	ctx := context.TODO()
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ShortURL: "abc123"}))
+
+	window := 50 * time.Millisecond
+	for want := 1; want <= 2; want++ {
+		failures, err := repo.CountPasswordFailure(ctx, "abc123", window)
+		require.NoError(t, err)
+		assert.Equal(t, want, failures)
+	}
+	failures, err := repo.GetPasswordFailures(ctx, "abc123", window)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures)
+
+	// A failure after the window has ended starts a new one.
+	time.Sleep(window)
+	failures, err = repo.GetPasswordFailures(ctx, "abc123", window)
+	require.NoError(t, err)
+	assert.Zero(t, failures)
+	failures, err = repo.CountPasswordFailure(ctx, "abc123", window)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+
+	_, err = repo.CountPasswordFailure(ctx, "missing", window)
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
@@ -7,19 +7,26 @@ import (
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
+const (
+	DriverPostgres = "postgres"
+	// DriverMemory keeps all data in process memory, no database is needed.
+	DriverMemory = "memory"
+)
+
 type Config struct {
 	Driver             string        `envconfig:"DB_DRIVER" default:"postgres"`
 	ConnectionString   string        `envconfig:"DATABASE_URL"`
 	MaxOpenConnections int           `envconfig:"DB_MAX_OPEN_CONNS" default:"25"`
 	MaxIdleConnections int           `envconfig:"DB_MAX_IDLE_CONNS" default:"25"`
 	ConnMaxLifetime    time.Duration `envconfig:"DB_CONN_MAX_LIFETIME" default:"5m"`
-	EnsureIdxTimeout   time.Duration `envconfig:"ENSURE_IDX_TIMEOUT" default:"30s"`
+	AutoMigrate        bool          `envconfig:"DB_AUTO_MIGRATE" default:"true"`
+	MigrationTimeout   time.Duration `envconfig:"DB_MIGRATION_TIMEOUT" default:"30s"`
 }
 
 func (c Config) ValidateWithContext(ctx context.Context) error {
 	return validation.ValidateStructWithContext(ctx, &c,
-		validation.Field(&c.Driver, validation.Required),
-		validation.Field(&c.ConnectionString, validation.Required),
-		validation.Field(&c.EnsureIdxTimeout, validation.Required),
+		validation.Field(&c.Driver, validation.Required, validation.In(DriverPostgres, DriverMemory)),
+		validation.Field(&c.ConnectionString, validation.When(c.Driver != DriverMemory, validation.Required)),
+		validation.Field(&c.MigrationTimeout, validation.Required),
 	)
 }
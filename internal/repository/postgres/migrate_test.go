@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_index.up.sql":   {Data: []byte("CREATE INDEX b;")},
+		"m/0002_add_index.down.sql": {Data: []byte("DROP INDEX b;")},
+		"m/0001_init.up.sql":        {Data: []byte("CREATE TABLE a;")},
+		"m/0001_init.down.sql":      {Data: []byte("DROP TABLE a;")},
+		"m/README.md":               {Data: []byte("ignored")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	require.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "init", Up: "CREATE TABLE a;", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "add_index", Up: "CREATE INDEX b;", Down: "DROP INDEX b;"},
+	}, migrations)
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+	}{
+		{name: "missing up", fsys: fstest.MapFS{"m/0001_init.down.sql": {}}},
+		{name: "bad version", fsys: fstest.MapFS{"m/abc_init.up.sql": {}}},
+		{name: "no name", fsys: fstest.MapFS{"m/0001.up.sql": {}}},
+		{name: "conflicting names", fsys: fstest.MapFS{
+			"m/0001_init.up.sql":  {Data: []byte("x")},
+			"m/0001_other.up.sql": {Data: []byte("y")},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.fsys, "m")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "migration versions must be contiguous")
+		assert.NotEmpty(t, m.Down, "migration %d has no down migration", m.Version)
+	}
+}
+
+func TestMigratorUp(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	migrator := &Migrator{
+		db:     db,
+		logger: zap.NewNop(),
+		migrations: []Migration{
+			{Version: 1, Name: "init", Up: "CREATE TABLE a"},
+			{Version: 2, Name: "add_index", Up: "CREATE INDEX b"},
+		},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).
+		WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at FROM schema_migrations`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE INDEX b`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`)).
+		WithArgs(int64(2), "add_index", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	applied, err := migrator.Up(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorDown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	migrator := &Migrator{
+		db:     db,
+		logger: zap.NewNop(),
+		migrations: []Migration{
+			{Version: 1, Name: "init", Up: "CREATE TABLE a", Down: "DROP TABLE a"},
+			{Version: 2, Name: "add_index", Up: "CREATE INDEX b", Down: "DROP INDEX b"},
+		},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).
+		WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS schema_migrations`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at FROM schema_migrations`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).
+			AddRow(1, time.Now()).AddRow(2, time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DROP INDEX b`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM schema_migrations WHERE version = $1`)).
+		WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).
+		WithArgs(migrationLockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	reverted, err := migrator.Down(context.TODO(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigratorStatus_ReadOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	migrator := &Migrator{
+		db:     db,
+		logger: zap.NewNop(),
+		migrations: []Migration{
+			{Version: 1, Name: "init", Up: "CREATE TABLE a"},
+			{Version: 2, Name: "add_index", Up: "CREATE INDEX b"},
+		},
+	}
+
+	// Without the table nothing is created, every migration is pending.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	statuses, err := migrator.Status(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Nil(t, statuses[0].AppliedAt)
+
+	appliedAt := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT to_regclass('schema_migrations') IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, applied_at FROM schema_migrations`)).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, appliedAt))
+	statuses, err = migrator.Status(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, &appliedAt, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
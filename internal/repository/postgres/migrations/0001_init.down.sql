@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS redirect_logs;
+DROP TABLE IF EXISTS urls;
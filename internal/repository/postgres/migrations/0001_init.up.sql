@@ -14,3 +14,5 @@ CREATE TABLE IF NOT EXISTS redirect_logs (
     referrer TEXT,
     FOREIGN KEY (short_url) REFERENCES urls(short_url)
 );
+
+CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls (expires_at);
@@ -0,0 +1 @@
+CREATE SEQUENCE IF NOT EXISTS short_url_seq AS BIGINT MINVALUE 1;
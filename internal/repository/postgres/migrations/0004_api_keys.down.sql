@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_urls_owner_id;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS owner_id;
+
+DROP TABLE IF EXISTS api_keys;
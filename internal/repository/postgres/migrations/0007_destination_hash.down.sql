@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_destination_hash;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS destination_hash;
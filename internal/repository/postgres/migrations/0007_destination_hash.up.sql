@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS destination_hash CHAR(64);
+
+CREATE INDEX IF NOT EXISTS idx_urls_destination_hash ON urls (destination_hash, owner_id);
@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS blocked BOOLEAN NOT NULL DEFAULT FALSE;
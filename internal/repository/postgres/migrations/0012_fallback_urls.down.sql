@@ -0,0 +1,2 @@
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS fallback_reason;
+ALTER TABLE urls DROP COLUMN IF EXISTS fallback_url;
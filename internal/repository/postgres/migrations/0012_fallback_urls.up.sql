@@ -0,0 +1,2 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS fallback_url TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS fallback_reason TEXT;
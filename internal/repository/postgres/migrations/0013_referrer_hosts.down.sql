@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_redirect_logs_short_url_accessed_at;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS referrer_host;
@@ -0,0 +1,7 @@
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS referrer_host TEXT;
+
+UPDATE redirect_logs
+SET referrer_host = lower(substring(referrer FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/?#]*@)?([^/?#:@]+)'))
+WHERE referrer IS NOT NULL AND referrer_host IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_redirect_logs_short_url_accessed_at ON redirect_logs (short_url, accessed_at);
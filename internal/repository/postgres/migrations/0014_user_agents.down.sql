@@ -0,0 +1,5 @@
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS is_bot;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS device;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS os;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS browser;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS user_agent;
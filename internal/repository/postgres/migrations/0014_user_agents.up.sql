@@ -0,0 +1,5 @@
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS user_agent TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS browser TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS os TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS device TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS city;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS region;
+ALTER TABLE redirect_logs DROP COLUMN IF EXISTS country;
@@ -0,0 +1,3 @@
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS country TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS region TEXT;
+ALTER TABLE redirect_logs ADD COLUMN IF NOT EXISTS city TEXT;
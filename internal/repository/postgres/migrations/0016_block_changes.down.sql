@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_urls_blocked_changed_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS blocked_changed_at;
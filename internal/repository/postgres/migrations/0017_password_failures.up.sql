@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS password_failures (
+    short_url VARCHAR(10) PRIMARY KEY REFERENCES urls(short_url) ON DELETE CASCADE,
+    window_start TIMESTAMPTZ NOT NULL,
+    failures INTEGER NOT NULL
+);
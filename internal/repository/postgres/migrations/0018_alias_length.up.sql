@@ -0,0 +1,3 @@
+ALTER TABLE urls ALTER COLUMN short_url TYPE VARCHAR(30);
+ALTER TABLE redirect_logs ALTER COLUMN short_url TYPE VARCHAR(30);
+ALTER TABLE password_failures ALTER COLUMN short_url TYPE VARCHAR(30);
@@ -0,0 +1,6 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS blocked_changed_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_urls_blocked_changed_at ON urls (blocked_changed_at)
+WHERE blocked_changed_at IS NOT NULL;
+
+DROP TABLE IF EXISTS link_changes;
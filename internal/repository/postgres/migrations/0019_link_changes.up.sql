@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS link_changes (
+    code VARCHAR(30) PRIMARY KEY,
+    changed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_changes_changed_at ON link_changes (changed_at);
+
+DROP INDEX IF EXISTS idx_urls_blocked_changed_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS blocked_changed_at;
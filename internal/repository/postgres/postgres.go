@@ -32,52 +32,27 @@ func PrepareConnection(ctx context.Context, config Config, logger *zap.Logger) (
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Initialize Database
-	if err = ensureTables(ctx, db, config, logger); err != nil {
-		return nil, fmt.Errorf("ensure tables: %w", err)
+	if config.AutoMigrate {
+		if err = migrateUp(ctx, db, config, logger); err != nil {
+			return nil, fmt.Errorf("migrate database: %w", err)
+		}
 	}
 
 	return db, nil
 }
 
-func ensureTables(ctx context.Context, db *sql.DB, cfg Config, logger *zap.Logger) error {
-	ctxTimeout, cancel := context.WithTimeout(ctx, cfg.EnsureIdxTimeout)
+func migrateUp(ctx context.Context, db *sql.DB, cfg Config, logger *zap.Logger) error {
+	ctxTimeout, cancel := context.WithTimeout(ctx, cfg.MigrationTimeout)
 	defer cancel()
 
-	queries := []string{
-		// Create URLs table
-		`
-        CREATE TABLE IF NOT EXISTS urls (
-            id UUID PRIMARY KEY,
-            original_url TEXT NOT NULL,
-            short_url VARCHAR(10) UNIQUE NOT NULL,
-            custom_alias VARCHAR(30) UNIQUE,
-            created_at TIMESTAMP NOT NULL,
-            expires_at TIMESTAMP
-        );
-        `,
-		// Create Redirect Logs table
-		`
-        CREATE TABLE IF NOT EXISTS redirect_logs (
-            id UUID PRIMARY KEY,
-            short_url VARCHAR(10) NOT NULL,
-            accessed_at TIMESTAMP NOT NULL,
-            referrer TEXT,
-            FOREIGN KEY (short_url) REFERENCES urls(short_url)
-        );
-        `,
-		// Create index on created_at for expiration
-		`
-        CREATE INDEX IF NOT EXISTS idx_urls_expires_at ON urls (expires_at);
-        `,
+	migrator, err := NewMigrator(db, logger)
+	if err != nil {
+		return err
 	}
-
-	for _, query := range queries {
-		if _, err := db.ExecContext(ctxTimeout, query); err != nil {
-			logger.Error("Failed to execute query", zap.String("query", query), zap.Error(err))
-			return fmt.Errorf("execute query: %w", err)
-		}
+	applied, err := migrator.Up(ctxTimeout)
+	if err != nil {
+		return err
 	}
-
+	logger.Info("Database schema is up to date", zap.Int("applied_migrations", applied))
 	return nil
 }
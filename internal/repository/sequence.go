@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/vladislavprovich/url-shortener/pkg/shortener"
+)
+
+type shortURLSequence struct {
+	db *sql.DB
+}
+
+// NewShortURLSequence returns a shortener.Sequence backed by the short_url_seq
+// Postgres sequence, shared by all replicas.
+func NewShortURLSequence(db *sql.DB) shortener.Sequence {
+	return &shortURLSequence{db: db}
+}
+
+func (s *shortURLSequence) Next(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := s.db.QueryRowContext(ctx, `SELECT nextval('short_url_seq')`).Scan(&n)
+	return n, err
+}
@@ -4,15 +4,61 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 
 	"github.com/vladislavprovich/url-shortener/internal/models"
 )
 
+// uniqueViolation is the Postgres SQLSTATE for unique constraint violations.
+const uniqueViolation = "23505"
+
 type URLRepository interface {
 	SaveURL(ctx context.Context, url models.URL) error
+	// FindByDestination returns the newest enabled, unblocked link of owner with
+	// the given destination hash that has no custom alias, expiration or redirect type.
+	FindByDestination(ctx context.Context, hash string, owner *string) (models.URL, error)
+	// FindTakenCodes returns the codes among codes that are the short URL or
+	// alias of a link, in one round trip.
+	FindTakenCodes(ctx context.Context, codes []string) ([]string, error)
+	// SaveURLs inserts urls with a single multi-row INSERT and returns the IDs
+	// of the stored rows. With skipConflicts rows whose short URL or alias is
+	// taken are left out, otherwise a conflict fails the whole statement.
+	SaveURLs(ctx context.Context, urls []models.URL, skipConflicts bool) ([]string, error)
 	GetURL(ctx context.Context, shortURL string) (models.URL, error)
+	UpdateURL(ctx context.Context, url models.URL) error
+	// ConsumeClick counts a redirect of a link with a click limit. It fails
+	// with models.ErrClickLimitReached once the limit is reached, the check and
+	// the increment are a single atomic statement.
+	ConsumeClick(ctx context.Context, shortURL string) error
+	// SetBlocked sets the operator controlled blocked flag, which UpdateURL leaves alone.
+	SetBlocked(ctx context.Context, shortURL string, blocked bool) error
+	// FindChanges returns the short URLs and aliases of the links that were
+	// updated, blocked or deleted within the last window, so other processes
+	// can drop them from their caches.
+	FindChanges(ctx context.Context, window time.Duration) ([]string, error)
+	// CountPasswordFailure records a wrong password for shortURL and returns
+	// the failures of the current window, which starts with the first failure
+	// after the previous window has ended.
+	CountPasswordFailure(ctx context.Context, shortURL string, window time.Duration) (int, error)
+	// GetPasswordFailures returns the failures of the current window of shortURL.
+	GetPasswordFailures(ctx context.Context, shortURL string, window time.Duration) (int, error)
+	DeleteURL(ctx context.Context, shortURL string) error
 	SaveRedirectLog(ctx context.Context, log models.RedirectLog) error
+	SaveRedirectLogs(ctx context.Context, logs []models.RedirectLog) error
 	GetStats(ctx context.Context, shortURL string) (models.StatsResponse, error)
+	// GetClickSeries counts the redirects of shortURL, which must not be an
+	// alias, per bucket of query. Buckets without clicks are left out.
+	GetClickSeries(ctx context.Context, shortURL string, query models.StatsQuery) ([]models.ClickBucket, error)
+	// GetReferrers returns a page of the referrers of shortURL, which must not
+	// be an alias, ordered by clicks.
+	GetReferrers(ctx context.Context, shortURL string, query models.ReferrerQuery) (models.ReferrerPage, error)
+	// GetBreakdown returns the limit values of dimension with the most clicks
+	// on shortURL, which must not be an alias.
+	GetBreakdown(ctx context.Context, shortURL, dimension string, limit int) ([]models.DimensionCount, error)
 }
 
 type urlRepository struct {
@@ -25,33 +71,351 @@ func NewURLRepository(db *sql.DB) URLRepository {
 
 func (repo *urlRepository) SaveURL(ctx context.Context, url models.URL) error {
 	query := `
-        INSERT INTO urls (id, original_url, short_url, custom_alias, created_at, expires_at)
-        VALUES ($1, $2, $3, $4, $5, $6)`
-	_, err := repo.db.ExecContext(ctx, query, url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt, url.ExpiredAt)
-	return err
+        INSERT INTO urls (id, original_url, short_url, custom_alias, created_at, expires_at, owner_id, redirect_type,
+                          destination_hash, max_clicks, password_hash, activates_at, fallback_url)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`
+	_, err := repo.db.ExecContext(ctx, query, url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt,
+		url.ExpiredAt, url.OwnerID, url.RedirectType, url.DestinationHash, url.MaxClicks, nullString(url.PasswordHash),
+		url.ActivatesAt, nullString(url.FallbackURL))
+	return mapUniqueViolation(err)
+}
+
+func (repo *urlRepository) SaveURLs(ctx context.Context, urls []models.URL, skipConflicts bool) ([]string, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	const columns = 13
+	var query strings.Builder
+	query.WriteString(`
+        INSERT INTO urls (id, original_url, short_url, custom_alias, created_at, expires_at, owner_id, redirect_type,
+                          destination_hash, max_clicks, password_hash, activates_at, fallback_url)
+        VALUES `)
+	args := make([]any, 0, len(urls)*columns)
+	for i, url := range urls {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * columns
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12, n+13)
+		args = append(args, url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt, url.ExpiredAt,
+			url.OwnerID, url.RedirectType, url.DestinationHash, url.MaxClicks, nullString(url.PasswordHash),
+			url.ActivatesAt, nullString(url.FallbackURL))
+	}
+	if skipConflicts {
+		query.WriteString(" ON CONFLICT DO NOTHING")
+	}
+	query.WriteString(" RETURNING id")
+
+	rows, err := repo.db.QueryContext(ctx, query.String(), args...)
+	if err != nil {
+		return nil, mapUniqueViolation(err)
+	}
+	defer rows.Close()
+
+	saved := make([]string, 0, len(urls))
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		saved = append(saved, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, mapUniqueViolation(err)
+	}
+	return saved, nil
+}
+
+// mapUniqueViolation translates unique constraint violations on urls into domain errors.
+func mapUniqueViolation(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != uniqueViolation {
+		return err
+	}
+	if strings.Contains(pqErr.Constraint, "custom_alias") {
+		return fmt.Errorf("%w: %w", models.ErrAliasTaken, err)
+	}
+	return fmt.Errorf("%w: %w", models.ErrShortURLTaken, err)
 }
 
 func (repo *urlRepository) GetURL(ctx context.Context, shortURL string) (models.URL, error) {
-	var url models.URL
 	query := `
-        SELECT id, original_url, short_url, custom_alias, created_at, expires_at
+        SELECT ` + urlColumns + `
         FROM urls WHERE short_url = $1 OR custom_alias = $1`
-	row := repo.db.QueryRowContext(ctx, query, shortURL)
-	err := row.Scan(&url.ID, &url.OriginalURL, &url.ShortURL, &url.CustomAlias, &url.CreatedAt, &url.ExpiredAt)
+	return scanURL(repo.db.QueryRowContext(ctx, query, shortURL))
+}
+
+func (repo *urlRepository) FindByDestination(ctx context.Context, hash string, owner *string) (models.URL, error) {
+	query := `
+        SELECT ` + urlColumns + `
+        FROM urls
+        WHERE destination_hash = $1 AND owner_id IS NOT DISTINCT FROM $2
+          AND custom_alias IS NULL AND expires_at IS NULL AND redirect_type = 0 AND NOT disabled
+          AND NOT blocked AND max_clicks IS NULL AND password_hash IS NULL AND activates_at IS NULL
+          AND fallback_url IS NULL
+        ORDER BY created_at DESC
+        LIMIT 1`
+	return scanURL(repo.db.QueryRowContext(ctx, query, hash, owner))
+}
+
+func (repo *urlRepository) FindTakenCodes(ctx context.Context, codes []string) ([]string, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+	query := `
+        SELECT short_url, custom_alias FROM urls WHERE short_url = ANY($1) OR custom_alias = ANY($1)`
+	rows, err := repo.db.QueryContext(ctx, query, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requested := make(map[string]struct{}, len(codes))
+	for _, code := range codes {
+		requested[code] = struct{}{}
+	}
+	var taken []string
+	for rows.Next() {
+		var (
+			shortURL string
+			alias    sql.NullString
+		)
+		if err = rows.Scan(&shortURL, &alias); err != nil {
+			return nil, err
+		}
+		// A row matches by either column, only the requested one is taken.
+		for _, code := range []string{shortURL, alias.String} {
+			if _, ok := requested[code]; ok && code != "" {
+				taken = append(taken, code)
+				delete(requested, code)
+			}
+		}
+	}
+	return taken, rows.Err()
+}
+
+// urlColumns are the columns read by scanURL.
+const urlColumns = `id, original_url, short_url, custom_alias, created_at, expires_at, disabled, updated_at, owner_id,
+               redirect_type, COALESCE(destination_hash, ''), blocked, max_clicks, click_count,
+               COALESCE(password_hash, ''), activates_at, COALESCE(fallback_url, '')`
+
+func scanURL(row *sql.Row) (models.URL, error) {
+	var url models.URL
+	err := row.Scan(&url.ID, &url.OriginalURL, &url.ShortURL, &url.CustomAlias, &url.CreatedAt, &url.ExpiredAt,
+		&url.Disabled, &url.UpdatedAt, &url.OwnerID, &url.RedirectType, &url.DestinationHash,
+		&url.Blocked, &url.MaxClicks, &url.ClickCount, &url.PasswordHash, &url.ActivatesAt,
+		&url.FallbackURL)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return url, errors.New("URL not found")
+		if errors.Is(err, sql.ErrNoRows) {
+			return url, models.ErrNotFound
 		}
 		return url, err
 	}
 	return url, nil
 }
 
+// UpdateURL overwrites the mutable fields of the link identified by url.ID.
+func (repo *urlRepository) UpdateURL(ctx context.Context, url models.URL) error {
+	// The new alias may be cached as unknown elsewhere.
+	query := withLinkChanges("id = $1", "$3") + `
+        UPDATE urls SET original_url = $2, custom_alias = $3, expires_at = $4, disabled = $5, updated_at = $6,
+            redirect_type = $7, destination_hash = $8, password_hash = $9, activates_at = $10,
+            fallback_url = $11
+        WHERE id = $1`
+	result, err := repo.db.ExecContext(ctx, query, url.ID, url.OriginalURL, url.CustomAlias, url.ExpiredAt,
+		url.Disabled, url.UpdatedAt, url.RedirectType, url.DestinationHash, nullString(url.PasswordHash), url.ActivatesAt,
+		nullString(url.FallbackURL))
+	if err != nil {
+		return mapUniqueViolation(err)
+	}
+	return expectAffected(result)
+}
+
+func (repo *urlRepository) ConsumeClick(ctx context.Context, shortURL string) error {
+	query := `
+        UPDATE urls SET click_count = click_count + 1
+        WHERE short_url = $1 AND (max_clicks IS NULL OR click_count < max_clicks)`
+	result, err := repo.db.ExecContext(ctx, query, shortURL)
+	if err != nil {
+		return err
+	}
+	if err = expectAffected(result); errors.Is(err, models.ErrNotFound) {
+		return models.ErrClickLimitReached
+	}
+	return err
+}
+
+func (repo *urlRepository) SetBlocked(ctx context.Context, shortURL string, blocked bool) error {
+	query := withLinkChanges("short_url = $1", "") + `
+        UPDATE urls SET blocked = $2 WHERE short_url = $1`
+	result, err := repo.db.ExecContext(ctx, query, shortURL, blocked)
+	if err != nil {
+		return err
+	}
+	return expectAffected(result)
+}
+
+func (repo *urlRepository) FindChanges(ctx context.Context, window time.Duration) ([]string, error) {
+	// The window is measured on the database clock, the one that stamped the changes.
+	query := `SELECT code FROM link_changes WHERE changed_at >= now() - make_interval(secs => $1)`
+	rows, err := repo.db.QueryContext(ctx, query, window.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err = rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// withLinkChanges is a WITH clause for a write to urls that stamps the short
+// URL and alias of the links matching filter, and the extra codes, in
+// link_changes. It runs in the same statement as the write, so no change is
+// missed by the FindChanges of other processes.
+func withLinkChanges(filter, extra string) string {
+	codes := "short_url, custom_alias"
+	if extra != "" {
+		codes += ", " + extra
+	}
+	return `
+        WITH changes AS (
+            INSERT INTO link_changes (code, changed_at)
+            SELECT DISTINCT code, now() FROM urls, unnest(ARRAY[` + codes + `]) AS c(code)
+            WHERE ` + filter + ` AND code IS NOT NULL
+            ON CONFLICT (code) DO UPDATE SET changed_at = EXCLUDED.changed_at)`
+}
+
+func (repo *urlRepository) CountPasswordFailure(
+	ctx context.Context, shortURL string, window time.Duration,
+) (int, error) {
+	query := `
+        INSERT INTO password_failures AS f (short_url, window_start, failures) VALUES ($1, now(), 1)
+        ON CONFLICT (short_url) DO UPDATE SET
+            window_start = CASE WHEN f.window_start > now() - make_interval(secs => $2)
+                THEN f.window_start ELSE now() END,
+            failures = CASE WHEN f.window_start > now() - make_interval(secs => $2)
+                THEN f.failures + 1 ELSE 1 END
+        RETURNING failures`
+	var failures int
+	err := repo.db.QueryRowContext(ctx, query, shortURL, window.Seconds()).Scan(&failures)
+	return failures, err
+}
+
+func (repo *urlRepository) GetPasswordFailures(
+	ctx context.Context, shortURL string, window time.Duration,
+) (int, error) {
+	query := `
+        SELECT failures FROM password_failures
+        WHERE short_url = $1 AND window_start > now() - make_interval(secs => $2)`
+	var failures int
+	err := repo.db.QueryRowContext(ctx, query, shortURL, window.Seconds()).Scan(&failures)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return failures, err
+}
+
+// DeleteURL removes the link and its redirect logs.
+func (repo *urlRepository) DeleteURL(ctx context.Context, shortURL string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Rollback after a successful Commit is a no-op returning sql.ErrTxDone.
+		_ = tx.Rollback()
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM redirect_logs WHERE short_url = $1`, shortURL); err != nil {
+		return err
+	}
+	query := withLinkChanges("short_url = $1", "") + `
+        DELETE FROM urls WHERE short_url = $1`
+	result, err := tx.ExecContext(ctx, query, shortURL)
+	if err != nil {
+		return err
+	}
+	if err = expectAffected(result); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// expectAffected turns a statement that matched no rows into models.ErrNotFound.
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return models.ErrNotFound
+	}
+	return nil
+}
+
+const (
+	// MaxBindParameters is the Postgres limit of bind parameters per statement.
+	MaxBindParameters = 65535
+	// RedirectLogColumnCount is the number of bind parameters per row of
+	// SaveRedirectLogs, it must match redirectLogColumns.
+	RedirectLogColumnCount = 14
+)
+
+// redirectLogColumns are the columns written by SaveRedirectLog, in the order
+// of redirectLogArgs.
+const redirectLogColumns = `id, short_url, accessed_at, referrer, fallback_reason, referrer_host, user_agent,
+        browser, os, device, is_bot, country, region, city`
+
+func redirectLogArgs(log models.RedirectLog) []any {
+	return []any{log.ID, log.ShortURL, log.AccessedAt, log.Referrer, log.FallbackReason, log.ReferrerHost,
+		log.UserAgent, log.Browser, log.OS, log.Device, log.Bot, log.Country, log.Region, log.City}
+}
+
 func (repo *urlRepository) SaveRedirectLog(ctx context.Context, log models.RedirectLog) error {
 	query := `
-        INSERT INTO redirect_logs (id, short_url, accessed_at, referrer)
-        VALUES ($1, $2, $3, $4)`
-	_, err := repo.db.ExecContext(ctx, query, log.ID, log.ShortURL, log.AccessedAt, log.Referrer)
+        INSERT INTO redirect_logs (` + redirectLogColumns + `)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	_, err := repo.db.ExecContext(ctx, query, redirectLogArgs(log)...)
+	return err
+}
+
+// SaveRedirectLogs inserts logs with a single multi-row INSERT.
+func (repo *urlRepository) SaveRedirectLogs(ctx context.Context, logs []models.RedirectLog) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`
+        INSERT INTO redirect_logs (` + redirectLogColumns + `)
+        VALUES `)
+	var args []any
+	for i, log := range logs {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		row := redirectLogArgs(log)
+		query.WriteString("(")
+		for j := range row {
+			if j > 0 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+j+1)
+		}
+		query.WriteString(")")
+		args = append(args, row...)
+	}
+
+	_, err := repo.db.ExecContext(ctx, query.String(), args...)
 	return err
 }
 
@@ -59,23 +423,29 @@ func (repo *urlRepository) GetStats(ctx context.Context, shortURL string) (model
 	var stats models.StatsResponse
 
 	query := `
-        SELECT created_at FROM urls WHERE short_url = $1 OR custom_alias = $1
+        SELECT short_url, created_at, expires_at, max_clicks, click_count
+        FROM urls WHERE short_url = $1 OR custom_alias = $1
     `
 	row := repo.db.QueryRowContext(ctx, query, shortURL)
-	err := row.Scan(&stats.CreatedAt)
+	// Resolve aliases to the short URL redirect logs are recorded under.
+	var clickCount int
+	err := row.Scan(&shortURL, &stats.CreatedAt, &stats.ExpiresAt, &stats.MaxClicks, &clickCount)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return stats, errors.New("URL not found")
+			return stats, models.ErrNotFound
 		}
 		return stats, err
 	}
+	stats.RemainingClicks = remainingClicks(stats.MaxClicks, clickCount)
 
 	query = `
-        SELECT COUNT(*), MAX(accessed_at) FROM redirect_logs WHERE short_url = $1`
+        SELECT COUNT(*) FILTER (WHERE NOT is_bot), MAX(accessed_at) FILTER (WHERE NOT is_bot),
+            COUNT(*) FILTER (WHERE is_bot)
+        FROM redirect_logs WHERE short_url = $1 AND fallback_reason IS NULL`
 
 	row = repo.db.QueryRowContext(ctx, query, shortURL)
 	var lastAccessed sql.NullTime
-	err = row.Scan(&stats.RedirectCount, &lastAccessed)
+	err = row.Scan(&stats.RedirectCount, &lastAccessed, &stats.BotCount)
 	if err != nil {
 		return stats, err
 	}
@@ -83,30 +453,151 @@ func (repo *urlRepository) GetStats(ctx context.Context, shortURL string) (model
 		stats.LastAccessed = &lastAccessed.Time
 	}
 
-	query = `
-        SELECT DISTINCT referrer FROM redirect_logs WHERE short_url = $1 AND referrer IS NOT NULL`
+	return stats, nil
+}
 
-	rows, err := repo.db.QueryContext(ctx, query, shortURL)
+// referrerKeys are the SQL expressions grouping referrers. Referrers without
+// a host, which are not URLs, are grouped by their full text.
+var referrerKeys = map[string]string{
+	models.ReferrerGroupHost: `COALESCE(referrer_host, referrer, '` + models.DirectReferrer + `')`,
+	models.ReferrerGroupURL:  `COALESCE(referrer, '` + models.DirectReferrer + `')`,
+}
+
+func (repo *urlRepository) GetReferrers(
+	ctx context.Context, shortURL string, query models.ReferrerQuery,
+) (models.ReferrerPage, error) {
+	page := models.ReferrerPage{Group: query.Group, Limit: query.Limit, Offset: query.Offset}
+	key, ok := referrerKeys[query.Group]
+	if !ok {
+		return page, fmt.Errorf("%w: unknown referrer group %q", models.ErrInvalidRequest, query.Group)
+	}
+
+	totalQuery := `
+        SELECT COUNT(DISTINCT ` + key + `) FROM redirect_logs
+        WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot`
+	if err := repo.db.QueryRowContext(ctx, totalQuery, shortURL).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	// The alias must not be a column name, GROUP BY prefers columns to aliases.
+	pageQuery := `
+        SELECT ` + key + ` AS referrer_key, COUNT(*) AS clicks
+        FROM redirect_logs
+        WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot
+        GROUP BY referrer_key
+        ORDER BY clicks DESC, referrer_key
+        LIMIT $2 OFFSET $3`
+	rows, err := repo.db.QueryContext(ctx, pageQuery, shortURL, query.Limit, query.Offset)
 	if err != nil {
-		return stats, err
+		return page, err
 	}
-	defer func() {
-		if err = rows.Close(); err != nil {
-			panic(err)
+	defer rows.Close()
+
+	page.Items = make([]models.ReferrerCount, 0, query.Limit)
+	for rows.Next() {
+		var item models.ReferrerCount
+		if err = rows.Scan(&item.Referrer, &item.Clicks); err != nil {
+			return page, err
 		}
-	}()
+		page.Items = append(page.Items, item)
+	}
+	return page, rows.Err()
+}
+
+// breakdownColumns are the redirect_logs columns of the client breakdown
+// dimensions. Empty and missing values are reported as unknown.
+var breakdownColumns = map[string]string{
+	models.DimensionBrowser: "browser",
+	models.DimensionOS:      "os",
+	models.DimensionDevice:  "device",
+	models.DimensionCountry: "country",
+}
 
-	var referrers []string
+func (repo *urlRepository) GetBreakdown(
+	ctx context.Context, shortURL, dimension string, limit int,
+) ([]models.DimensionCount, error) {
+	column, ok := breakdownColumns[dimension]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown dimension %q", models.ErrInvalidRequest, dimension)
+	}
+	query := `
+        SELECT COALESCE(NULLIF(` + column + `, ''), 'unknown') AS value, COUNT(*) AS clicks
+        FROM redirect_logs
+        WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot
+        GROUP BY value
+        ORDER BY clicks DESC, value
+        LIMIT $2`
+	rows, err := repo.db.QueryContext(ctx, query, shortURL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []models.DimensionCount
 	for rows.Next() {
-		var referrer sql.NullString
-		if err = rows.Scan(&referrer); err != nil {
-			return stats, err
+		var count models.DimensionCount
+		if err = rows.Scan(&count.Value, &count.Clicks); err != nil {
+			return nil, err
 		}
-		if referrer.Valid {
-			referrers = append(referrers, referrer.String)
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+// GetClickSeries buckets redirect logs with date_trunc in the time zone of the
+// query. accessed_at holds UTC, it is converted to the local time of the zone
+// before truncation and the bucket start is converted back. Hours subtract the
+// elapsed part of the local hour instead, so the hour repeated when clocks go
+// back is not merged into one bucket.
+func (repo *urlRepository) GetClickSeries(
+	ctx context.Context, shortURL string, query models.StatsQuery,
+) ([]models.ClickBucket, error) {
+	loc := query.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	sqlQuery := `
+        SELECT CASE WHEN $2 = 'hour'
+                THEN (accessed_at - (local - date_trunc('hour', local))) AT TIME ZONE 'UTC'
+                ELSE date_trunc($2, local) AT TIME ZONE $3
+            END AS bucket, COUNT(*)
+        FROM (
+            SELECT accessed_at, accessed_at AT TIME ZONE 'UTC' AT TIME ZONE $3 AS local
+            FROM redirect_logs
+            WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot AND accessed_at >= $4 AND accessed_at < $5
+        ) AS logs
+        GROUP BY bucket
+        ORDER BY bucket`
+	rows, err := repo.db.QueryContext(ctx, sqlQuery, shortURL, string(query.Granularity), loc.String(),
+		query.From.UTC(), query.To.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []models.ClickBucket
+	for rows.Next() {
+		var bucket models.ClickBucket
+		if err = rows.Scan(&bucket.Start, &bucket.Clicks); err != nil {
+			return nil, err
 		}
+		bucket.Start = bucket.Start.In(loc)
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
+
+// remainingClicks is the number of redirects left for a link with a click
+// limit and nil for unlimited links.
+func remainingClicks(maxClicks *int, clickCount int) *int {
+	if maxClicks == nil {
+		return nil
 	}
-	stats.Referrers = referrers
+	remaining := max(*maxClicks-clickCount, 0)
+	return &remaining
+}
 
-	return stats, nil
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository/postgres"
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
+)
+
+// openTestDatabase connects to the migrated database of TEST_DATABASE_URL and
+// skips the test without one. The sqlmock tests only match the query text,
+// these tests run the statistics queries against Postgres itself.
+func openTestDatabase(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := postgres.NewMigrator(db, zap.NewNop())
+	require.NoError(t, err)
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return db
+}
+
+func TestPostgres_Stats(t *testing.T) {
+	db := openTestDatabase(t)
+	repo := NewURLRepository(db)
+	ctx := context.Background()
+
+	shortURL := uuid.New().String()[:10]
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, repo.SaveURL(ctx, models.URL{
+		ID: uuid.New().String(), OriginalURL: "https://example.com", ShortURL: shortURL, CreatedAt: now,
+	}))
+	t.Cleanup(func() { _ = repo.DeleteURL(context.Background(), shortURL) })
+
+	a, b, host := "https://news.example/a", "https://news.example/b", "news.example"
+	reason := "expired"
+	logs := []models.RedirectLog{
+		{Referrer: &a, ReferrerHost: &host, Browser: "Firefox", Device: "desktop", Country: "DE"},
+		{Referrer: &b, ReferrerHost: &host, Browser: "Chrome", Device: "mobile"},
+		{Browser: "Chrome", Device: "mobile"},
+		{Referrer: &a, ReferrerHost: &host, FallbackReason: &reason},
+		{Referrer: &a, ReferrerHost: &host, Device: "bot", Bot: true},
+	}
+	for i := range logs {
+		logs[i].ID, logs[i].ShortURL, logs[i].AccessedAt = uuid.New().String(), shortURL, now
+	}
+	require.NoError(t, repo.SaveRedirectLogs(ctx, logs))
+
+	stats, err := repo.GetStats(ctx, shortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.RedirectCount)
+	assert.Equal(t, 1, stats.BotCount)
+
+	page, err := repo.GetReferrers(ctx, shortURL, models.ReferrerQuery{Group: models.ReferrerGroupHost, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, []models.ReferrerCount{{Referrer: host, Clicks: 2}, {Referrer: "direct", Clicks: 1}}, page.Items)
+
+	page, err = repo.GetReferrers(ctx, shortURL, models.ReferrerQuery{Group: models.ReferrerGroupURL, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Items, 3)
+
+	browsers, err := repo.GetBreakdown(ctx, shortURL, models.DimensionBrowser, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DimensionCount{{Value: "Chrome", Clicks: 2}, {Value: "Firefox", Clicks: 1}}, browsers)
+
+	countries, err := repo.GetBreakdown(ctx, shortURL, models.DimensionCountry, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DimensionCount{{Value: "unknown", Clicks: 2}, {Value: "DE", Clicks: 1}}, countries)
+
+	series, err := repo.GetClickSeries(ctx, shortURL, models.StatsQuery{
+		From: now.Add(-time.Hour), To: now.Add(time.Hour), Granularity: timebucket.Hour, Location: time.UTC,
+	})
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, 3, series[0].Clicks)
+
+	// 2:30 in Berlin happens twice on 27 October 2024, once in CEST and once in CET.
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	cest := time.Date(2024, time.October, 27, 0, 30, 0, 0, time.UTC)
+	repeated := []models.RedirectLog{{AccessedAt: cest}, {AccessedAt: cest.Add(time.Hour)}}
+	for i := range repeated {
+		repeated[i].ID, repeated[i].ShortURL, repeated[i].Device = uuid.New().String(), shortURL, "desktop"
+	}
+	require.NoError(t, repo.SaveRedirectLogs(ctx, repeated))
+
+	series, err = repo.GetClickSeries(ctx, shortURL, models.StatsQuery{
+		From: cest.Add(-time.Hour), To: cest.Add(3 * time.Hour), Granularity: timebucket.Hour, Location: berlin,
+	})
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	assert.True(t, series[0].Start.Equal(cest.Truncate(time.Hour)), series[0].Start)
+	assert.True(t, series[1].Start.Equal(cest.Truncate(time.Hour).Add(time.Hour)), series[1].Start)
+}
+
+func TestPostgres_FindChanges(t *testing.T) {
+	db := openTestDatabase(t)
+	repo := NewURLRepository(db)
+	ctx := context.Background()
+
+	id, shortURL, alias := uuid.New().String(), uuid.New().String()[:10], uuid.New().String()[:10]
+	url := models.URL{
+		ID: id, OriginalURL: "https://example.com", ShortURL: shortURL, CustomAlias: &alias, CreatedAt: time.Now(),
+	}
+	require.NoError(t, repo.SaveURL(ctx, url))
+	t.Cleanup(func() { _ = repo.DeleteURL(context.Background(), shortURL) })
+
+	codes, err := repo.FindChanges(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.NotContains(t, codes, shortURL)
+
+	require.NoError(t, repo.SetBlocked(ctx, shortURL, true))
+	codes, err = repo.FindChanges(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, codes, shortURL)
+	assert.Contains(t, codes, alias)
+
+	// Updates stamp the previous and the new alias, deletes stamp the link.
+	newAlias := uuid.New().String()[:10]
+	url.CustomAlias = &newAlias
+	require.NoError(t, repo.UpdateURL(ctx, url))
+	codes, err = repo.FindChanges(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, codes, alias)
+	assert.Contains(t, codes, newAlias)
+
+	require.NoError(t, repo.DeleteURL(ctx, shortURL))
+	codes, err = repo.FindChanges(ctx, time.Minute)
+	require.NoError(t, err)
+	assert.Contains(t, codes, shortURL)
+}
+
+func TestPostgres_PasswordFailures(t *testing.T) {
+	db := openTestDatabase(t)
+	repo := NewURLRepository(db)
+	ctx := context.Background()
+
+	shortURL := uuid.New().String()[:10]
+	require.NoError(t, repo.SaveURL(ctx, models.URL{
+		ID: uuid.New().String(), OriginalURL: "https://example.com", ShortURL: shortURL, CreatedAt: time.Now(),
+	}))
+	t.Cleanup(func() { _ = repo.DeleteURL(context.Background(), shortURL) })
+
+	for want := 1; want <= 2; want++ {
+		failures, err := repo.CountPasswordFailure(ctx, shortURL, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, want, failures)
+	}
+	failures, err := repo.GetPasswordFailures(ctx, shortURL, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures)
+
+	// A window that has already ended is started over.
+	time.Sleep(1100 * time.Millisecond)
+	failures, err = repo.GetPasswordFailures(ctx, shortURL, time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, failures)
+	failures, err = repo.CountPasswordFailure(ctx, shortURL, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+}
@@ -2,21 +2,26 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
 )
 
 func TestSaveURL(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer func() {
+		mock.ExpectClose()
 		if err = db.Close(); err != nil {
 			t.Errorf("error closing db: %v", err)
 		}
@@ -25,17 +30,21 @@ func TestSaveURL(t *testing.T) {
 	repo := NewURLRepository(db)
 
 	url := models.URL{
-		ID:          "uuid",
-		OriginalURL: "https://example.com",
-		ShortURL:    "abc123",
-		CreatedAt:   time.Now(),
+		ID:              "uuid",
+		OriginalURL:     "https://example.com",
+		ShortURL:        "abc123",
+		CreatedAt:       time.Now(),
+		DestinationHash: "0a1b2c",
 	}
 
 	mock.ExpectExec(regexp.QuoteMeta(`
-        INSERT INTO urls (id, original_url, short_url, custom_alias, created_at, expires_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
+        INSERT INTO urls (id, original_url, short_url, custom_alias, created_at, expires_at, owner_id, redirect_type,
+                          destination_hash, max_clicks, password_hash, activates_at, fallback_url)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
     `)).
-		WithArgs(url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt, url.ExpiredAt).
+		WithArgs(url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt, url.ExpiredAt, url.OwnerID,
+			url.RedirectType, url.DestinationHash, url.MaxClicks, sql.NullString{}, url.ActivatesAt,
+			sql.NullString{}).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err = repo.SaveURL(context.TODO(), url)
@@ -43,10 +52,109 @@ func TestSaveURL(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSaveURLs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	now := time.Now()
+	urls := []models.URL{
+		{ID: "uuid1", OriginalURL: "https://example.com", ShortURL: "abc", CreatedAt: now},
+		{ID: "uuid2", OriginalURL: "https://example.org", ShortURL: "def", CreatedAt: now, RedirectType: 301},
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        INSERT INTO urls (id, original_url, short_url, custom_alias, created_at, expires_at, owner_id, redirect_type,
+                          destination_hash, max_clicks, password_hash, activates_at, fallback_url)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13),
+               ($14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26)
+        ON CONFLICT DO NOTHING RETURNING id
+    `)).
+		WithArgs(urls[0].ID, urls[0].OriginalURL, urls[0].ShortURL, urls[0].CustomAlias, urls[0].CreatedAt,
+			urls[0].ExpiredAt, urls[0].OwnerID, urls[0].RedirectType, urls[0].DestinationHash, urls[0].MaxClicks,
+			sql.NullString{}, urls[0].ActivatesAt, sql.NullString{},
+			urls[1].ID, urls[1].OriginalURL, urls[1].ShortURL, urls[1].CustomAlias, urls[1].CreatedAt,
+			urls[1].ExpiredAt, urls[1].OwnerID, urls[1].RedirectType, urls[1].DestinationHash, urls[1].MaxClicks,
+			sql.NullString{}, urls[1].ActivatesAt, sql.NullString{}).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("uuid2"))
+
+	saved, err := repo.SaveURLs(context.TODO(), urls, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"uuid2"}, saved)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`)).
+		WillReturnError(&pq.Error{Code: uniqueViolation, Constraint: "urls_custom_alias_key"})
+
+	_, err = repo.SaveURLs(context.TODO(), urls[:1], false)
+	require.ErrorIs(t, err, models.ErrAliasTaken)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveURL_UniqueViolation(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint string
+		expected   error
+	}{
+		{name: "custom alias", constraint: "urls_custom_alias_key", expected: models.ErrAliasTaken},
+		{name: "short url", constraint: "urls_short_url_key", expected: models.ErrShortURLTaken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func() {
+				mock.ExpectClose()
+				if err = db.Close(); err != nil {
+					t.Errorf("error closing db: %v", err)
+				}
+			}()
+
+			repo := NewURLRepository(db)
+
+			mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO urls`)).
+				WillReturnError(&pq.Error{Code: uniqueViolation, Constraint: tt.constraint})
+
+			err = repo.SaveURL(context.TODO(), models.URL{ID: "uuid", ShortURL: "abc123"})
+			require.ErrorIs(t, err, tt.expected)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestGetURL_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM urls WHERE short_url = $1 OR custom_alias = $1`)).
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	_, err = repo.GetURL(context.TODO(), "missing")
+	require.ErrorIs(t, err, models.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetURL(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer func() {
+		mock.ExpectClose()
 		if err = db.Close(); err != nil {
 			t.Errorf("error closing db: %v", err)
 		}
@@ -55,20 +163,39 @@ func TestGetURL(t *testing.T) {
 	repo := NewURLRepository(db)
 
 	shortURL := "abc123"
+	owner := "alice"
+	maxClicks := 10
+	activatesAt := time.Now().Add(time.Hour)
 	url := models.URL{
-		ID:          "uuid",
-		OriginalURL: "https://example.com",
-		ShortURL:    shortURL,
-		CreatedAt:   time.Now(),
+		ID:              "uuid",
+		OriginalURL:     "https://example.com",
+		ShortURL:        shortURL,
+		CreatedAt:       time.Now(),
+		OwnerID:         &owner,
+		RedirectType:    301,
+		DestinationHash: "0a1b2c",
+		MaxClicks:       &maxClicks,
+		ClickCount:      2,
+		PasswordHash:    "$2a$10$hash",
+		ActivatesAt:     &activatesAt,
+		FallbackURL:     "https://example.com/over",
 	}
 
 	mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT id, original_url, short_url, custom_alias, created_at, expires_at
+        SELECT id, original_url, short_url, custom_alias, created_at, expires_at, disabled, updated_at, owner_id,
+               redirect_type, COALESCE(destination_hash, ''), blocked, max_clicks, click_count,
+               COALESCE(password_hash, ''), activates_at, COALESCE(fallback_url, '')
         FROM urls WHERE short_url = $1 OR custom_alias = $1
     `)).
 		WithArgs(shortURL).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "original_url", "short_url", "custom_alias", "created_at", "expires_at"}).
-			AddRow(url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt, url.ExpiredAt))
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "original_url", "short_url", "custom_alias", "created_at", "expires_at", "disabled", "updated_at",
+			"owner_id", "redirect_type", "destination_hash", "blocked", "max_clicks", "click_count",
+			"password_hash", "activates_at", "fallback_url",
+		}).
+			AddRow(url.ID, url.OriginalURL, url.ShortURL, url.CustomAlias, url.CreatedAt, url.ExpiredAt,
+				url.Disabled, url.UpdatedAt, owner, url.RedirectType, url.DestinationHash, url.Blocked, maxClicks,
+				url.ClickCount, url.PasswordHash, activatesAt, url.FallbackURL))
 
 	result, err := repo.GetURL(context.TODO(), shortURL)
 	require.NoError(t, err)
@@ -76,10 +203,234 @@ func TestGetURL(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestFindByDestination(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	owner := "alice"
+	now := time.Now()
+	query := regexp.QuoteMeta(`
+        FROM urls
+        WHERE destination_hash = $1 AND owner_id IS NOT DISTINCT FROM $2
+          AND custom_alias IS NULL AND expires_at IS NULL AND redirect_type = 0 AND NOT disabled
+          AND NOT blocked AND max_clicks IS NULL AND password_hash IS NULL AND activates_at IS NULL
+          AND fallback_url IS NULL
+        ORDER BY created_at DESC
+        LIMIT 1
+    `)
+	mock.ExpectQuery(query).
+		WithArgs("0a1b2c", &owner).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "original_url", "short_url", "custom_alias", "created_at", "expires_at", "disabled", "updated_at",
+			"owner_id", "redirect_type", "destination_hash", "blocked", "max_clicks", "click_count",
+			"password_hash", "activates_at", "fallback_url",
+		}).
+			AddRow("uuid", "https://example.com", "abc123", nil, now, nil, false, nil, owner, 0, "0a1b2c", false,
+				nil, 0, "", nil, ""))
+	mock.ExpectQuery(query).
+		WithArgs("0a1b2c", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	url, err := repo.FindByDestination(context.TODO(), "0a1b2c", &owner)
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", url.ShortURL)
+
+	_, err = repo.FindByDestination(context.TODO(), "0a1b2c", nil)
+	require.ErrorIs(t, err, models.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	updatedAt := time.Now()
+	url := models.URL{
+		ID: "uuid", OriginalURL: "https://example.org", Disabled: true, UpdatedAt: &updatedAt, RedirectType: 308,
+	}
+
+	query := regexp.QuoteMeta(withLinkChanges("id = $1", "$3") + `
+        UPDATE urls SET original_url = $2, custom_alias = $3, expires_at = $4, disabled = $5, updated_at = $6,
+            redirect_type = $7, destination_hash = $8, password_hash = $9, activates_at = $10,
+            fallback_url = $11
+        WHERE id = $1
+    `)
+	mock.ExpectExec(query).
+		WithArgs(url.ID, url.OriginalURL, url.CustomAlias, url.ExpiredAt, url.Disabled, url.UpdatedAt, url.RedirectType,
+			url.DestinationHash, sql.NullString{}, url.ActivatesAt, sql.NullString{}).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.UpdateURL(context.TODO(), url))
+	require.ErrorIs(t, repo.UpdateURL(context.TODO(), url), models.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConsumeClick(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	query := regexp.QuoteMeta(`
+        UPDATE urls SET click_count = click_count + 1
+        WHERE short_url = $1 AND (max_clicks IS NULL OR click_count < max_clicks)
+    `)
+	mock.ExpectExec(query).WithArgs("abc123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs("abc123").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.ConsumeClick(context.TODO(), "abc123"))
+	require.ErrorIs(t, repo.ConsumeClick(context.TODO(), "abc123"), models.ErrClickLimitReached)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetBlocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	query := regexp.QuoteMeta(withLinkChanges("short_url = $1", "") + `
+        UPDATE urls SET blocked = $2 WHERE short_url = $1`)
+	mock.ExpectExec(query).WithArgs("abc123", true).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs("missing", true).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	require.NoError(t, repo.SetBlocked(context.TODO(), "abc123", true))
+	require.ErrorIs(t, repo.SetBlocked(context.TODO(), "missing", true), models.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFindChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT code FROM link_changes WHERE changed_at >= now() - make_interval(secs => $1)`)).
+		WithArgs(float64(20)).
+		WillReturnRows(sqlmock.NewRows([]string{"code"}).AddRow("abc123").AddRow("alias"))
+
+	codes, err := repo.FindChanges(context.TODO(), 20*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"abc123", "alias"}, codes)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWithLinkChanges(t *testing.T) {
+	assert.Equal(t, `
+        WITH changes AS (
+            INSERT INTO link_changes (code, changed_at)
+            SELECT DISTINCT code, now() FROM urls, unnest(ARRAY[short_url, custom_alias, $3]) AS c(code)
+            WHERE id = $1 AND code IS NOT NULL
+            ON CONFLICT (code) DO UPDATE SET changed_at = EXCLUDED.changed_at)`, withLinkChanges("id = $1", "$3"))
+}
+
+func TestPasswordFailures(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        INSERT INTO password_failures AS f (short_url, window_start, failures) VALUES ($1, now(), 1)
+        ON CONFLICT (short_url) DO UPDATE SET`)).
+		WithArgs("abc123", float64(900)).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	get := regexp.QuoteMeta(`
+        SELECT failures FROM password_failures
+        WHERE short_url = $1 AND window_start > now() - make_interval(secs => $2)`)
+	mock.ExpectQuery(get).WithArgs("abc123", float64(900)).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+	mock.ExpectQuery(get).WithArgs("other", float64(900)).WillReturnError(sql.ErrNoRows)
+
+	failures, err := repo.CountPasswordFailure(context.TODO(), "abc123", 15*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures)
+	failures, err = repo.GetPasswordFailures(context.TODO(), "abc123", 15*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 3, failures)
+	failures, err = repo.GetPasswordFailures(context.TODO(), "other", 15*time.Minute)
+	require.NoError(t, err)
+	assert.Zero(t, failures)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRedirectLogColumnCount(t *testing.T) {
+	assert.Len(t, strings.Split(redirectLogColumns, ","), RedirectLogColumnCount)
+	assert.Len(t, redirectLogArgs(models.RedirectLog{}), RedirectLogColumnCount)
+}
+
+func TestDeleteURL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM redirect_logs WHERE short_url = $1`)).
+		WithArgs("abc123").WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(withLinkChanges("short_url = $1", "") + `
+        DELETE FROM urls WHERE short_url = $1`)).
+		WithArgs("abc123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, repo.DeleteURL(context.TODO(), "abc123"))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestSaveRedirectLog(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer func() {
+		mock.ExpectClose()
 		if err = db.Close(); err != nil {
 			t.Errorf("error closing db: %v", err)
 		}
@@ -87,18 +438,29 @@ func TestSaveRedirectLog(t *testing.T) {
 
 	repo := NewURLRepository(db)
 
+	userAgent := "curl/8.5.0"
 	logEntry := models.RedirectLog{
 		ID:         "uuid",
 		ShortURL:   "abc123",
 		AccessedAt: time.Now(),
 		Referrer:   nil,
+		UserAgent:  &userAgent,
+		Browser:    "Other",
+		OS:         "Other",
+		Device:     "bot",
+		Bot:        true,
+		Country:    "DE",
+		Region:     "Bavaria",
+		City:       "Munich",
 	}
 
 	mock.ExpectExec(regexp.QuoteMeta(`
-        INSERT INTO redirect_logs (id, short_url, accessed_at, referrer)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO redirect_logs (id, short_url, accessed_at, referrer, fallback_reason, referrer_host, user_agent,
+            browser, os, device, is_bot, country, region, city)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
     `)).
-		WithArgs(logEntry.ID, logEntry.ShortURL, logEntry.AccessedAt, logEntry.Referrer).
+		WithArgs(logEntry.ID, logEntry.ShortURL, logEntry.AccessedAt, logEntry.Referrer, logEntry.FallbackReason,
+			logEntry.ReferrerHost, logEntry.UserAgent, "Other", "Other", "bot", true, "DE", "Bavaria", "Munich").
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	err = repo.SaveRedirectLog(context.TODO(), logEntry)
@@ -106,10 +468,46 @@ func TestSaveRedirectLog(t *testing.T) {
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSaveRedirectLogs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	referrer, host, reason := "https://referrer.com", "referrer.com", "expired"
+	logs := []models.RedirectLog{
+		{ID: "uuid1", ShortURL: "abc123", AccessedAt: time.Now(), Referrer: &referrer, ReferrerHost: &host},
+		{ID: "uuid2", ShortURL: "abc123", AccessedAt: time.Now(), FallbackReason: &reason},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`
+        INSERT INTO redirect_logs (id, short_url, accessed_at, referrer, fallback_reason, referrer_host, user_agent,
+            browser, os, device, is_bot, country, region, city)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14),
+            ($15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28)
+    `)).
+		WithArgs(logs[0].ID, logs[0].ShortURL, logs[0].AccessedAt, logs[0].Referrer, logs[0].FallbackReason,
+			logs[0].ReferrerHost, logs[0].UserAgent, "", "", "", false, "", "", "",
+			logs[1].ID, logs[1].ShortURL, logs[1].AccessedAt, logs[1].Referrer, logs[1].FallbackReason,
+			logs[1].ReferrerHost, logs[1].UserAgent, "", "", "", false, "", "", "").
+		WillReturnResult(sqlmock.NewResult(2, 2))
+
+	err = repo.SaveRedirectLogs(context.TODO(), logs)
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetStats(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer func() {
+		mock.ExpectClose()
 		if err = db.Close(); err != nil {
 			t.Errorf("error closing db: %v", err)
 		}
@@ -121,40 +519,185 @@ func TestGetStats(t *testing.T) {
 	createdAt := time.Now()
 	redirectCount := 5
 	lastAccessed := time.Now().Add(-time.Hour)
-	referrers := []string{"https://referrer1.com", "https://referrer2.com"}
+	expiresAt := time.Now().Add(24 * time.Hour)
 
-	// Mock for created_at
+	// Mock for short_url, created_at and expires_at
 	mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT created_at FROM urls WHERE short_url = $1 OR custom_alias = $1
+        SELECT short_url, created_at, expires_at, max_clicks, click_count
+        FROM urls WHERE short_url = $1 OR custom_alias = $1
     `)).
 		WithArgs(shortURL).
-		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).
-			AddRow(createdAt))
+		WillReturnRows(sqlmock.NewRows([]string{"short_url", "created_at", "expires_at", "max_clicks", "click_count"}).
+			AddRow(shortURL, createdAt, expiresAt, 3, 1))
 
 	// Mock for redirect logs
 	mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT COUNT(*), MAX(accessed_at) FROM redirect_logs WHERE short_url = $1
+        SELECT COUNT(*) FILTER (WHERE NOT is_bot), MAX(accessed_at) FILTER (WHERE NOT is_bot),
+            COUNT(*) FILTER (WHERE is_bot)
+        FROM redirect_logs WHERE short_url = $1 AND fallback_reason IS NULL
     `)).
 		WithArgs(shortURL).
-		WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).
-			AddRow(redirectCount, lastAccessed))
-
-	// Mock for referrers
-	rows := sqlmock.NewRows([]string{"referrer"})
-	for _, ref := range referrers {
-		rows.AddRow(ref)
-	}
-	mock.ExpectQuery(regexp.QuoteMeta(`
-        SELECT DISTINCT referrer FROM redirect_logs WHERE short_url = $1 AND referrer IS NOT NULL
-    `)).
-		WithArgs(shortURL).
-		WillReturnRows(rows)
+		WillReturnRows(sqlmock.NewRows([]string{"count", "max", "bots"}).
+			AddRow(redirectCount, lastAccessed, 2))
 
 	stats, err := repo.GetStats(context.TODO(), shortURL)
 	require.NoError(t, err)
 	assert.Equal(t, redirectCount, stats.RedirectCount)
+	assert.Equal(t, 2, stats.BotCount)
 	assert.Equal(t, createdAt, stats.CreatedAt)
+	assert.Equal(t, &expiresAt, stats.ExpiresAt)
 	assert.Equal(t, &lastAccessed, stats.LastAccessed)
-	assert.Equal(t, referrers, stats.Referrers)
+	require.NotNil(t, stats.RemainingClicks)
+	assert.Equal(t, 2, *stats.RemainingClicks)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetClickSeries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	from := time.Date(2024, time.May, 1, 0, 0, 0, 0, berlin)
+	to := from.AddDate(0, 0, 7)
+	bucket := time.Date(2024, time.May, 2, 0, 0, 0, 0, berlin)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        SELECT CASE WHEN $2 = 'hour'
+                THEN (accessed_at - (local - date_trunc('hour', local))) AT TIME ZONE 'UTC'
+                ELSE date_trunc($2, local) AT TIME ZONE $3
+            END AS bucket, COUNT(*)
+        FROM (
+            SELECT accessed_at, accessed_at AT TIME ZONE 'UTC' AT TIME ZONE $3 AS local
+            FROM redirect_logs
+            WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot AND accessed_at >= $4 AND accessed_at < $5
+        ) AS logs
+        GROUP BY bucket
+        ORDER BY bucket
+    `)).
+		WithArgs("abc123", "day", "Europe/Berlin", from.UTC(), to.UTC()).
+		WillReturnRows(sqlmock.NewRows([]string{"bucket", "count"}).AddRow(bucket.UTC(), 3))
+
+	series, err := repo.GetClickSeries(context.TODO(), "abc123", models.StatsQuery{
+		From: from, To: to, Granularity: timebucket.Day, Location: berlin,
+	})
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, bucket, series[0].Start)
+	assert.Equal(t, 3, series[0].Clicks)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetReferrers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        SELECT COUNT(DISTINCT COALESCE(referrer_host, referrer, 'direct')) FROM redirect_logs
+        WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot
+    `)).
+		WithArgs("abc123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        SELECT COALESCE(referrer_host, referrer, 'direct') AS referrer_key, COUNT(*) AS clicks
+        FROM redirect_logs
+        WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot
+        GROUP BY referrer_key
+        ORDER BY clicks DESC, referrer_key
+        LIMIT $2 OFFSET $3
+    `)).
+		WithArgs("abc123", 2, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"referrer", "clicks"}).
+			AddRow("news.example", 8).
+			AddRow("direct", 5))
+
+	page, err := repo.GetReferrers(context.TODO(), "abc123", models.ReferrerQuery{Group: "host", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, models.ReferrerPage{
+		Group: "host",
+		Items: []models.ReferrerCount{{Referrer: "news.example", Clicks: 8}, {Referrer: "direct", Clicks: 5}},
+		Total: 3,
+		Limit: 2,
+	}, page)
+
+	_, err = repo.GetReferrers(context.TODO(), "abc123", models.ReferrerQuery{Group: "path", Limit: 2})
+	require.ErrorIs(t, err, models.ErrInvalidRequest)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetBreakdown(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        SELECT COALESCE(NULLIF(device, ''), 'unknown') AS value, COUNT(*) AS clicks
+        FROM redirect_logs
+        WHERE short_url = $1 AND fallback_reason IS NULL AND NOT is_bot
+        GROUP BY value
+        ORDER BY clicks DESC, value
+        LIMIT $2
+    `)).
+		WithArgs("abc123", 10).
+		WillReturnRows(sqlmock.NewRows([]string{"value", "clicks"}).
+			AddRow("mobile", 6).
+			AddRow("desktop", 3))
+
+	counts, err := repo.GetBreakdown(context.TODO(), "abc123", models.DimensionDevice, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.DimensionCount{{Value: "mobile", Clicks: 6}, {Value: "desktop", Clicks: 3}}, counts)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = repo.GetBreakdown(context.TODO(), "abc123", "referrer; DROP TABLE urls", 10)
+	require.ErrorIs(t, err, models.ErrInvalidRequest)
+}
+
+func TestFindTakenCodes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		mock.ExpectClose()
+		if err = db.Close(); err != nil {
+			t.Errorf("error closing db: %v", err)
+		}
+	}()
+
+	repo := NewURLRepository(db)
+
+	codes := []string{"one", "two", "three"}
+	mock.ExpectQuery(regexp.QuoteMeta(`
+        SELECT short_url, custom_alias FROM urls WHERE short_url = ANY($1) OR custom_alias = ANY($1)
+    `)).
+		WithArgs(pq.Array(codes)).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url", "custom_alias"}).
+			AddRow("one", nil).
+			AddRow("abc1234", "three"))
+
+	taken, err := repo.FindTakenCodes(context.TODO(), codes)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"one", "three"}, taken)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
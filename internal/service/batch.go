@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// BatchResult is the outcome of a single item of CreateShortURLs, either the
+// created link or the reason it was not created.
+type BatchResult struct {
+	URL models.URL
+	Err error
+}
+
+// batchItem is a link of the batch that still has to be stored.
+type batchItem struct {
+	index     int
+	url       models.URL
+	generated bool
+}
+
+// CreateShortURLs creates a link for every request. In atomic mode either all
+// links are created or none, and the items that did not fail themselves are
+// reported with models.ErrBatchAborted. Otherwise every item succeeds or fails
+// on its own. Items are deduplicated like CreateShortURL, and items for the
+// same destination share the link created for the first of them. The returned
+// error is only set if the batch could not be processed at all.
+func (s *urlService) CreateShortURLs(
+	ctx context.Context, reqs []models.ShortenRequest, atomic bool,
+) ([]BatchResult, error) {
+	s.logger.Info("service.CreateShortURLs", zap.Int("items", len(reqs)), zap.Bool("atomic", atomic))
+
+	results := make([]BatchResult, len(reqs))
+	items, duplicates, err := s.prepareBatch(ctx, reqs, results)
+	if err != nil {
+		return nil, err
+	}
+
+	if atomic {
+		if failed(results) {
+			abort(results)
+			return results, nil
+		}
+		err = s.saveBatchAtomic(ctx, items, results)
+	} else {
+		err = s.saveBatchPartial(ctx, items, results)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for index, first := range duplicates {
+		results[index] = results[first]
+	}
+	return results, nil
+}
+
+// prepareBatch builds the links of the batch and assigns their short codes.
+// Items that cannot be created and items answered with an existing link are
+// recorded in results. duplicates maps the index of an item to the index of
+// the earlier item of the batch whose link it reuses.
+func (s *urlService) prepareBatch(
+	ctx context.Context, reqs []models.ShortenRequest, results []BatchResult,
+) (items []batchItem, duplicates map[int]int, err error) {
+	now := time.Now()
+	candidates := make([]batchItem, 0, len(reqs))
+	var aliases []string
+	duplicates = make(map[int]int)
+	firsts := make(map[string]int)
+	for i, req := range reqs {
+		url, err := s.newURL(ctx, req, now)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if s.shouldDeduplicate(req) {
+			existing, err := s.repo.FindByDestination(ctx, url.DestinationHash, url.OwnerID)
+			switch {
+			case err == nil:
+				results[i].URL = existing
+				continue
+			case !errors.Is(err, models.ErrNotFound):
+				s.logger.Error("service, failed to look up destination", zap.Error(err))
+				return nil, nil, fmt.Errorf("find by destination: %w", err)
+			}
+			key := url.DestinationHash
+			if url.OwnerID != nil {
+				key += " " + *url.OwnerID
+			}
+			if first, ok := firsts[key]; ok {
+				duplicates[i] = first
+				continue
+			}
+			firsts[key] = i
+		}
+
+		if !isValidAlias(req.CustomAlias) {
+			candidates = append(candidates, batchItem{index: i, url: url, generated: true})
+			continue
+		}
+		url.ShortURL = *req.CustomAlias
+		candidates = append(candidates, batchItem{index: i, url: url})
+		aliases = append(aliases, url.ShortURL)
+	}
+
+	taken, err := s.takenCodes(ctx, aliases)
+	if err != nil {
+		return nil, nil, err
+	}
+	items = candidates[:0]
+	for _, item := range candidates {
+		if !item.generated {
+			// Only the first item of an alias requested twice can be created.
+			if _, ok := taken[item.url.ShortURL]; ok {
+				results[item.index].Err = models.ErrAliasTaken
+				continue
+			}
+			taken[item.url.ShortURL] = struct{}{}
+		}
+		items = append(items, item)
+	}
+	items, err = s.assignCodes(ctx, items, results)
+	return items, duplicates, err
+}
+
+// assignCodes generates the short codes of the generated items with one
+// lookup per round. Like saveWithGeneratedCode it skips reserved codes and
+// codes that are the short URL or alias of a link, which ON CONFLICT cannot
+// tell apart, as well as codes of other items. Items without a free code
+// within the collision budget are recorded in results and left out.
+func (s *urlService) assignCodes(ctx context.Context, items []batchItem, results []BatchResult) ([]batchItem, error) {
+	claimed := make(map[string]struct{}, len(items))
+	var pending []int
+	for i, item := range items {
+		if item.generated {
+			pending = append(pending, i)
+		} else {
+			claimed[item.url.ShortURL] = struct{}{}
+		}
+	}
+
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > s.collisionRetries() {
+			for _, i := range pending {
+				s.metrics.CodeRetriesExhausted()
+				results[items[i].index].Err = models.ErrCodeGenerationFailed
+			}
+			break
+		}
+		codes := make([]string, len(pending))
+		for n, i := range pending {
+			code, err := s.generator.Generate(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("generate short url: %w", err)
+			}
+			items[i].url.ShortURL = code
+			codes[n] = code
+		}
+		taken, err := s.takenCodes(ctx, codes)
+		if err != nil {
+			return nil, err
+		}
+		var retry []int
+		for _, i := range pending {
+			code := items[i].url.ShortURL
+			_, isTaken := taken[code]
+			_, isClaimed := claimed[code]
+			if isTaken || isClaimed {
+				s.metrics.CodeCollision()
+				retry = append(retry, i)
+				continue
+			}
+			claimed[code] = struct{}{}
+		}
+		pending = retry
+	}
+
+	assigned := items[:0]
+	for _, item := range items {
+		if results[item.index].Err == nil {
+			assigned = append(assigned, item)
+		}
+	}
+	return assigned, nil
+}
+
+// saveBatchPartial stores items with conflicting rows skipped. Skipped
+// generated codes are replaced and retried until the collision budget is spent.
+func (s *urlService) saveBatchPartial(ctx context.Context, items []batchItem, results []BatchResult) error {
+	for attempt := 0; len(items) > 0; attempt++ {
+		saved, err := s.repo.SaveURLs(ctx, batchURLs(items), true)
+		if err != nil {
+			s.logger.Error("service, failed to save URL batch", zap.Error(err))
+			return fmt.Errorf("create short urls: %w", err)
+		}
+		stored := make(map[string]struct{}, len(saved))
+		for _, id := range saved {
+			stored[id] = struct{}{}
+		}
+
+		var retry []batchItem
+		for _, item := range items {
+			switch {
+			case hasID(stored, item.url.ID):
+				results[item.index].URL = item.url
+				s.metrics.LinkCreated()
+			case !item.generated:
+				results[item.index].Err = models.ErrAliasTaken
+			case attempt >= s.collisionRetries():
+				s.metrics.CodeRetriesExhausted()
+				results[item.index].Err = models.ErrCodeGenerationFailed
+			default:
+				s.metrics.CodeCollision()
+				retry = append(retry, item)
+			}
+		}
+		if items, err = s.assignCodes(ctx, retry, results); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveBatchAtomic stores all items in a single statement. A conflict fails the
+// statement, so the culprits are looked up and the batch is aborted, unless
+// only generated codes collided, in which case they are replaced and retried.
+func (s *urlService) saveBatchAtomic(ctx context.Context, items []batchItem, results []BatchResult) error {
+	for attempt := 0; ; attempt++ {
+		_, err := s.repo.SaveURLs(ctx, batchURLs(items), false)
+		if err == nil {
+			for _, item := range items {
+				results[item.index].URL = item.url
+				s.metrics.LinkCreated()
+			}
+			return nil
+		}
+		if !errors.Is(err, models.ErrAliasTaken) && !errors.Is(err, models.ErrShortURLTaken) {
+			s.logger.Error("service, failed to save URL batch", zap.Error(err))
+			return fmt.Errorf("create short urls: %w", err)
+		}
+
+		// An alias may have been claimed since prepareBatch checked it.
+		var aliases []string
+		for _, item := range items {
+			if !item.generated {
+				aliases = append(aliases, item.url.ShortURL)
+			}
+		}
+		taken, lookupErr := s.takenCodes(ctx, aliases)
+		if lookupErr != nil {
+			return lookupErr
+		}
+		for _, item := range items {
+			if _, ok := taken[item.url.ShortURL]; ok && !item.generated {
+				results[item.index].Err = models.ErrAliasTaken
+			}
+		}
+		if !failed(results) && attempt < s.collisionRetries() {
+			s.metrics.CodeCollision()
+			if items, err = s.assignCodes(ctx, items, results); err != nil {
+				return err
+			}
+			if !failed(results) {
+				continue
+			}
+		}
+
+		if !failed(results) {
+			s.metrics.CodeRetriesExhausted()
+			for _, item := range items {
+				if item.generated {
+					results[item.index].Err = models.ErrCodeGenerationFailed
+				}
+			}
+		}
+		abort(results)
+		return nil
+	}
+}
+
+// takenCodes returns the codes that are reserved or already resolve to a
+// link, looked up with a single query.
+func (s *urlService) takenCodes(ctx context.Context, codes []string) (map[string]struct{}, error) {
+	taken := make(map[string]struct{})
+	lookup := make([]string, 0, len(codes))
+	for _, code := range codes {
+		if isReservedCode(code) {
+			taken[code] = struct{}{}
+		} else {
+			lookup = append(lookup, code)
+		}
+	}
+	if len(lookup) == 0 {
+		return taken, nil
+	}
+	found, err := s.repo.FindTakenCodes(ctx, lookup)
+	if err != nil {
+		return nil, fmt.Errorf("check codes: %w", err)
+	}
+	for _, code := range found {
+		taken[code] = struct{}{}
+	}
+	return taken, nil
+}
+
+func batchURLs(items []batchItem) []models.URL {
+	urls := make([]models.URL, len(items))
+	for i, item := range items {
+		urls[i] = item.url
+	}
+	return urls
+}
+
+func hasID(ids map[string]struct{}, id string) bool {
+	_, ok := ids[id]
+	return ok
+}
+
+func failed(results []BatchResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// abort marks every item that did not fail itself as not created.
+func abort(results []BatchResult) {
+	for i := range results {
+		results[i].URL = models.URL{}
+		if results[i].Err == nil {
+			results[i].Err = models.ErrBatchAborted
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+)
+
+func aliasRequest(alias string) models.ShortenRequest {
+	return models.ShortenRequest{URL: "https://example.com/" + alias, CustomAlias: &alias}
+}
+
+func TestCreateShortURLs_PartialSuccess(t *testing.T) {
+	ctx := context.Background()
+	metrics := &countingMetrics{}
+	service := NewURLService(memory.NewURLRepository(), nil,
+		WithGenerator(&fixedGenerator{codes: []string{"gen1", "gen1", "gen2"}}),
+		WithMetrics(metrics),
+	)
+	_, err := service.CreateShortURL(ctx, aliasRequest("taken"))
+	require.NoError(t, err)
+
+	badTTL := "-1h"
+	results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{
+		{URL: "https://example.com/a"},
+		aliasRequest("taken"),
+		aliasRequest("mine"),
+		aliasRequest("mine"),
+		{URL: "https://example.com/b", TTL: &badTTL},
+		{URL: "https://example.com/c"},
+		aliasRequest("links"),
+	}, false)
+	require.NoError(t, err)
+	require.Len(t, results, 7)
+
+	assert.Equal(t, "gen1", results[0].URL.ShortURL)
+	require.ErrorIs(t, results[1].Err, models.ErrAliasTaken)
+	assert.Equal(t, "mine", results[2].URL.ShortURL)
+	require.ErrorIs(t, results[3].Err, models.ErrAliasTaken)
+	require.ErrorIs(t, results[4].Err, models.ErrInvalidExpiration)
+	// The second generated code collided within the batch and was replaced.
+	assert.Equal(t, "gen2", results[5].URL.ShortURL)
+	require.ErrorIs(t, results[6].Err, models.ErrAliasTaken)
+	assert.Equal(t, 1, metrics.collisions)
+	assert.Equal(t, 4, metrics.created)
+
+	for _, code := range []string{"gen1", "mine", "gen2"} {
+		_, err = service.ResolveURL(ctx, code)
+		require.NoError(t, err)
+	}
+}
+
+func TestCreateShortURLs_AtomicAbortsOnFailure(t *testing.T) {
+	ctx := context.Background()
+	service := NewURLService(memory.NewURLRepository(), nil)
+	_, err := service.CreateShortURL(ctx, aliasRequest("taken"))
+	require.NoError(t, err)
+
+	results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{
+		aliasRequest("fresh"),
+		aliasRequest("taken"),
+		{URL: "https://example.com"},
+	}, true)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, results[0].Err, models.ErrBatchAborted)
+	require.ErrorIs(t, results[1].Err, models.ErrAliasTaken)
+	require.ErrorIs(t, results[2].Err, models.ErrBatchAborted)
+	_, err = service.ResolveURL(ctx, "fresh")
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestCreateShortURLs_AtomicRetriesGeneratedCollisions(t *testing.T) {
+	ctx := context.Background()
+	metrics := &countingMetrics{}
+	service := NewURLService(memory.NewURLRepository(), nil,
+		WithGenerator(&fixedGenerator{codes: []string{"taken", "taken", "new2"}}),
+		WithMetrics(metrics),
+	)
+	_, err := service.CreateShortURL(ctx, aliasRequest("alias"))
+	require.NoError(t, err)
+	_, err = service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+
+	results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{
+		{URL: "https://example.com/a"},
+		aliasRequest("other"),
+	}, true)
+	require.NoError(t, err)
+
+	require.NoError(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	assert.Equal(t, "new2", results[0].URL.ShortURL)
+	assert.Equal(t, 1, metrics.collisions)
+}
+
+func TestCreateShortURLs_GeneratedCodesSkipAliasesAndRoutes(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewURLRepository()
+	alias := "clash"
+	require.NoError(t, repo.SaveURL(ctx, models.URL{ID: "uuid", ShortURL: "abc1234", CustomAlias: &alias}))
+
+	for _, atomic := range []bool{false, true} {
+		metrics := &countingMetrics{}
+		service := NewURLService(repo, nil,
+			WithGenerator(&fixedGenerator{codes: []string{"clash", "links", fmt.Sprint("fresh", atomic)}}),
+			WithMetrics(metrics),
+		)
+
+		results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{{URL: "https://example.com"}}, atomic)
+		require.NoError(t, err)
+		require.NoError(t, results[0].Err)
+		// The code of an existing alias and a reserved route are never handed out.
+		assert.Equal(t, fmt.Sprint("fresh", atomic), results[0].URL.ShortURL)
+		assert.Equal(t, 2, metrics.collisions)
+	}
+}
+
+func TestCreateShortURLs_Deduplicates(t *testing.T) {
+	ctx := auth.WithOwner(context.Background(), "alice")
+	service := NewURLService(memory.NewURLRepository(), nil, WithConfig(Config{Deduplicate: true}))
+	existing, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com/a"})
+	require.NoError(t, err)
+
+	no := false
+	results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/b"},
+		{URL: "https://example.com/b"},
+		{URL: "https://example.com/a", Deduplicate: &no},
+		aliasRequest("a"),
+	}, true)
+	require.NoError(t, err)
+	for _, result := range results {
+		require.NoError(t, result.Err)
+	}
+
+	// The same destination gets the same code as through CreateShortURL.
+	assert.Equal(t, existing.ShortURL, results[0].URL.ShortURL)
+	// Items for the same destination share the link created for the first.
+	assert.Equal(t, results[1].URL.ShortURL, results[2].URL.ShortURL)
+	assert.NotEqual(t, existing.ShortURL, results[3].URL.ShortURL)
+	assert.Equal(t, "a", results[4].URL.ShortURL)
+}
+
+// lookupCountingRepository counts the alias lookups of a batch.
+type lookupCountingRepository struct {
+	repository.URLRepository
+	getURL    int
+	findTaken [][]string
+}
+
+func (r *lookupCountingRepository) GetURL(ctx context.Context, shortURL string) (models.URL, error) {
+	r.getURL++
+	return r.URLRepository.GetURL(ctx, shortURL)
+}
+
+func (r *lookupCountingRepository) FindTakenCodes(ctx context.Context, codes []string) ([]string, error) {
+	r.findTaken = append(r.findTaken, codes)
+	return r.URLRepository.FindTakenCodes(ctx, codes)
+}
+
+func TestCreateShortURLs_ChecksAliasesInOneQuery(t *testing.T) {
+	ctx := context.Background()
+	repo := &lookupCountingRepository{URLRepository: memory.NewURLRepository()}
+	service := NewURLService(repo, nil)
+	_, err := service.CreateShortURL(ctx, aliasRequest("two"))
+	require.NoError(t, err)
+	repo.getURL, repo.findTaken = 0, nil
+
+	results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{
+		aliasRequest("one"), aliasRequest("two"), aliasRequest("links"), aliasRequest("three"),
+	}, false)
+	require.NoError(t, err)
+	require.NoError(t, results[0].Err)
+	require.ErrorIs(t, results[1].Err, models.ErrAliasTaken)
+	// Reserved codes are rejected without a lookup.
+	require.ErrorIs(t, results[2].Err, models.ErrAliasTaken)
+	require.NoError(t, results[3].Err)
+	assert.Equal(t, [][]string{{"one", "two", "three"}}, repo.findTaken)
+	assert.Zero(t, repo.getURL)
+}
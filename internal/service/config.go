@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	MaxTTL time.Duration `envconfig:"LINK_MAX_TTL" default:"8760h"`
+	// CollisionRetries is how many times a taken generated code is replaced
+	// before CreateShortURL gives up, at least 1.
+	CollisionRetries int `envconfig:"SHORTENER_COLLISION_RETRIES" default:"5"`
+	// Deduplicate answers a shorten request with the existing link of the
+	// caller to the same destination, unless the request opts out.
+	Deduplicate bool `envconfig:"LINK_DEDUPLICATE" default:"false"`
+	// StatsMaxBuckets limits the length of the click time series of the stats.
+	StatsMaxBuckets int `envconfig:"STATS_MAX_BUCKETS" default:"1000"`
+	// StatsTopReferrers is the number of referrers listed by the stats, longer
+	// lists are paged with GetReferrers.
+	StatsTopReferrers int `envconfig:"STATS_TOP_REFERRERS" default:"10"`
+	// StatsTopValues is the number of values listed per dimension of the
+	// browser, operating system, device and country breakdowns.
+	StatsTopValues int `envconfig:"STATS_TOP_VALUES" default:"10"`
+	// PasswordMaxFailures limits the wrong passwords for a link from all
+	// clients within PasswordFailureWindow, further attempts are rejected.
+	PasswordMaxFailures   int           `envconfig:"PASSWORD_MAX_FAILURES" default:"20"`
+	PasswordFailureWindow time.Duration `envconfig:"PASSWORD_FAILURE_WINDOW" default:"15m"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.MaxTTL, validation.Min(time.Duration(0))),
+		// Min skips zero values, Required rejects them.
+		validation.Field(&c.CollisionRetries, validation.Required, validation.Min(1)),
+		validation.Field(&c.StatsMaxBuckets, validation.Required, validation.Min(1)),
+		validation.Field(&c.StatsTopReferrers, validation.Required, validation.Min(1),
+			validation.Max(maxReferrerPageSize)),
+		validation.Field(&c.StatsTopValues, validation.Required, validation.Min(1)),
+		validation.Field(&c.PasswordMaxFailures, validation.Required, validation.Min(1)),
+		validation.Field(&c.PasswordFailureWindow, validation.Required, validation.Min(time.Second)),
+	)
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_RejectsZeroLimits(t *testing.T) {
+	valid := Config{
+		CollisionRetries: 5, StatsMaxBuckets: 1000, StatsTopReferrers: 10, StatsTopValues: 10,
+		PasswordMaxFailures: 20, PasswordFailureWindow: time.Minute,
+	}
+	assert.NoError(t, valid.ValidateWithContext(context.Background()))
+
+	for name, mutate := range map[string]func(*Config){
+		"collision retries":   func(c *Config) { c.CollisionRetries = 0 },
+		"stats max buckets":   func(c *Config) { c.StatsMaxBuckets = 0 },
+		"stats top referrers": func(c *Config) { c.StatsTopReferrers = 0 },
+		"stats top values":    func(c *Config) { c.StatsTopValues = -1 },
+		"password failures":   func(c *Config) { c.PasswordMaxFailures = 0 },
+		"password window":     func(c *Config) { c.PasswordFailureWindow = 0 },
+	} {
+		cfg := valid
+		mutate(&cfg)
+		assert.Error(t, cfg.ValidateWithContext(context.Background()), name)
+	}
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// destinationHash identifies a normalized destination URL.
+func destinationHash(destination string) string {
+	sum := sha256.Sum256([]byte(destination))
+	return hex.EncodeToString(sum[:])
+}
+
+// shouldDeduplicate reports whether req may be answered with an existing
+// link. The request flag overrides the server default, but requests asking
+// for an alias, an expiration, an activation time, a redirect type, a click
+// limit, a fallback URL or a password always get a new link, and only links
+// without such settings are reused.
+func (s *urlService) shouldDeduplicate(req models.ShortenRequest) bool {
+	if isValidAlias(req.CustomAlias) || req.ExpiresAt != nil || req.TTL != nil || req.RedirectType != 0 ||
+		req.ActivatesAt != nil || req.MaxClicks != nil || req.FallbackURL != nil || req.Password != nil {
+		return false
+	}
+	if req.Deduplicate != nil {
+		return *req.Deduplicate
+	}
+	return s.config.Deduplicate
+}
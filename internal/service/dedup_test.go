@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+)
+
+func TestCreateShortURL_Deduplicate(t *testing.T) {
+	service := NewURLService(memory.NewURLRepository(), nil, WithConfig(Config{Deduplicate: true}))
+	alice := auth.WithOwner(context.Background(), "alice")
+	bob := auth.WithOwner(context.Background(), "bob")
+
+	first, err := service.CreateShortURL(alice, models.ShortenRequest{URL: "https://example.com/path"})
+	require.NoError(t, err)
+
+	again, err := service.CreateShortURL(alice, models.ShortenRequest{URL: "HTTPS://Example.COM/path"})
+	require.NoError(t, err)
+	assert.Equal(t, first.ShortURL, again.ShortURL, "same destination of the same owner is reused")
+
+	other, err := service.CreateShortURL(bob, models.ShortenRequest{URL: "https://example.com/path"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ShortURL, other.ShortURL, "links of other owners are never reused")
+
+	optOut := false
+	fresh, err := service.CreateShortURL(alice,
+		models.ShortenRequest{URL: "https://example.com/path", Deduplicate: &optOut})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ShortURL, fresh.ShortURL)
+
+	ttl := "1h"
+	expiring, err := service.CreateShortURL(alice, models.ShortenRequest{URL: "https://example.com/path", TTL: &ttl})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ShortURL, expiring.ShortURL, "requests with settings get their own link")
+
+	// Disabled links are not handed out again.
+	_, err = service.SetDisabled(alice, fresh.ShortURL, true)
+	require.NoError(t, err)
+	_, err = service.SetDisabled(alice, first.ShortURL, true)
+	require.NoError(t, err)
+	next, err := service.CreateShortURL(alice, models.ShortenRequest{URL: "https://example.com/path"})
+	require.NoError(t, err)
+	assert.NotContains(t, []string{first.ShortURL, fresh.ShortURL, expiring.ShortURL}, next.ShortURL)
+}
+
+func TestCreateShortURL_DeduplicateOptIn(t *testing.T) {
+	service := NewURLService(memory.NewURLRepository(), nil)
+	ctx := context.Background()
+
+	optIn := true
+	first, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+	again, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com", Deduplicate: &optIn})
+	require.NoError(t, err)
+	assert.Equal(t, first.ShortURL, again.ShortURL)
+
+	plain, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ShortURL, plain.ShortURL, "deduplication is off by default")
+}
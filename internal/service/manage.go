@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"go.uber.org/zap"
+)
+
+// GetURL returns the full record of a link, whether or not it can currently
+// be followed. Only the owner of the link may read it.
+func (s *urlService) GetURL(ctx context.Context, shortURL string) (models.URL, error) {
+	s.logger.Info("service.GetURL", zap.String("short_url", shortURL))
+	url, err := s.repo.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.URL{}, fmt.Errorf("get url: %w", err)
+	}
+	if err = authorize(ctx, url); err != nil {
+		s.logger.Warn("service, link accessed by another owner", zap.String("short_url", shortURL))
+		return models.URL{}, err
+	}
+	return url, nil
+}
+
+// authorize checks that the authenticated caller owns url. Without an
+// authenticated owner, i.e. with authentication disabled, every link is
+// accessible. Links created before authentication was enabled have no owner
+// and are accessible to nobody.
+func authorize(ctx context.Context, url models.URL) error {
+	owner, ok := auth.OwnerFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	if url.OwnerID == nil || *url.OwnerID != owner {
+		return models.ErrForbidden
+	}
+	return nil
+}
+
+func (s *urlService) UpdateURL(ctx context.Context, shortURL string, req models.UpdateURLRequest) (models.URL, error) {
+	s.logger.Info("service.UpdateURL", zap.String("short_url", shortURL))
+	url, err := s.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.URL{}, err
+	}
+
+	now := time.Now()
+	if req.URL != nil {
+		if url.OriginalURL, err = s.checkDestination(ctx, *req.URL); err != nil {
+			return models.URL{}, err
+		}
+	}
+	if req.RedirectType != nil {
+		url.RedirectType = *req.RedirectType
+	}
+	if req.FallbackURL != nil {
+		url.FallbackURL = ""
+		if *req.FallbackURL != "" {
+			if url.FallbackURL, err = s.checkDestination(ctx, *req.FallbackURL); err != nil {
+				return models.URL{}, err
+			}
+		}
+	}
+	if req.Password != nil {
+		if url.PasswordHash, err = hashPassword(*req.Password); err != nil {
+			return models.URL{}, err
+		}
+	}
+	if req.NoExpiration {
+		url.ExpiredAt = nil
+	} else if req.ExpiresAt != nil || req.TTL != nil {
+		if url.ExpiredAt, err = s.resolveExpiration(req.ExpiresAt, req.TTL, now); err != nil {
+			return models.URL{}, err
+		}
+	}
+	if req.ActivateNow {
+		url.ActivatesAt = nil
+	} else if req.ActivatesAt != nil {
+		url.ActivatesAt = req.ActivatesAt
+	}
+	if err = checkActivation(url.ActivatesAt, url.ExpiredAt); err != nil {
+		return models.URL{}, err
+	}
+	if isValidAlias(req.CustomAlias) && (url.CustomAlias == nil || *url.CustomAlias != *req.CustomAlias) {
+		if err = s.ensureAliasAvailable(ctx, *req.CustomAlias, url.ShortURL); err != nil {
+			return models.URL{}, err
+		}
+		url.CustomAlias = req.CustomAlias
+	}
+
+	return s.saveChanges(ctx, url, now)
+}
+
+func (s *urlService) SetDisabled(ctx context.Context, shortURL string, disabled bool) (models.URL, error) {
+	s.logger.Info("service.SetDisabled", zap.String("short_url", shortURL), zap.Bool("disabled", disabled))
+	url, err := s.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.URL{}, err
+	}
+	if url.Disabled == disabled {
+		return url, nil
+	}
+	url.Disabled = disabled
+	return s.saveChanges(ctx, url, time.Now())
+}
+
+// SetBlocked marks a link as abusive so redirects show a warning page, or
+// lifts the block. It is an operator action, the owner cannot change it.
+func (s *urlService) SetBlocked(ctx context.Context, shortURL string, blocked bool) (models.URL, error) {
+	s.logger.Info("service.SetBlocked", zap.String("short_url", shortURL), zap.Bool("blocked", blocked))
+	url, err := s.repo.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.URL{}, fmt.Errorf("get url: %w", err)
+	}
+	if err = s.repo.SetBlocked(ctx, url.ShortURL, blocked); err != nil {
+		s.logger.Error("service, failed to block URL", zap.Error(err))
+		return models.URL{}, fmt.Errorf("block url: %w", err)
+	}
+	url.Blocked = blocked
+	return url, nil
+}
+
+func (s *urlService) DeleteURL(ctx context.Context, shortURL string) error {
+	s.logger.Info("service.DeleteURL", zap.String("short_url", shortURL))
+	url, err := s.GetURL(ctx, shortURL)
+	if err != nil {
+		return err
+	}
+	if err = s.repo.DeleteURL(ctx, url.ShortURL); err != nil {
+		s.logger.Error("service, failed to delete URL", zap.Error(err))
+		return fmt.Errorf("delete url: %w", err)
+	}
+	return nil
+}
+
+// ensureAliasAvailable checks that alias resolves to nothing but the link
+// with the given short URL.
+func (s *urlService) ensureAliasAvailable(ctx context.Context, alias, shortURL string) error {
+	if isReservedCode(alias) {
+		return models.ErrAliasTaken
+	}
+	existing, err := s.repo.GetURL(ctx, alias)
+	switch {
+	case err == nil && existing.ShortURL != shortURL:
+		return models.ErrAliasTaken
+	case err == nil, errors.Is(err, models.ErrNotFound):
+		return nil
+	default:
+		return fmt.Errorf("check alias: %w", err)
+	}
+}
+
+func (s *urlService) saveChanges(ctx context.Context, url models.URL, now time.Time) (models.URL, error) {
+	url.UpdatedAt = &now
+	url.DestinationHash = destinationHash(url.OriginalURL)
+	if err := s.repo.UpdateURL(ctx, url); err != nil {
+		s.logger.Error("service, failed to update URL", zap.Error(err))
+		return models.URL{}, fmt.Errorf("update url: %w", err)
+	}
+	return url, nil
+}
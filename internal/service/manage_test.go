@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
+)
+
+func newMemoryService(t *testing.T) (URLService, models.URL) {
+	t.Helper()
+	service := NewURLService(memory.NewURLRepository(), nil)
+	url, err := service.CreateShortURL(context.Background(), models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+	return service, url
+}
+
+func TestUpdateURL(t *testing.T) {
+	service, created := newMemoryService(t)
+	ctx := context.Background()
+
+	destination := "https://example.org/"
+	alias := "newalias"
+	ttl := "1h"
+	updated, err := service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{
+		URL:         &destination,
+		CustomAlias: &alias,
+		TTL:         &ttl,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, created.ShortURL, updated.ShortURL)
+	assert.Equal(t, destination, updated.OriginalURL)
+	require.NotNil(t, updated.ExpiredAt)
+	require.NotNil(t, updated.UpdatedAt)
+
+	// Both the short URL and the new alias resolve to the new destination.
+	for _, code := range []string{created.ShortURL, alias} {
+		url, err := service.ResolveURL(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, destination, url.OriginalURL)
+	}
+
+	updated, err = service.UpdateURL(ctx, alias, models.UpdateURLRequest{NoExpiration: true})
+	require.NoError(t, err)
+	assert.Nil(t, updated.ExpiredAt)
+}
+
+func TestUpdateURL_AliasTaken(t *testing.T) {
+	service, created := newMemoryService(t)
+	ctx := context.Background()
+
+	other, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.org"})
+	require.NoError(t, err)
+
+	_, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{CustomAlias: &other.ShortURL})
+	require.ErrorIs(t, err, models.ErrAliasTaken)
+
+	reserved := "links"
+	_, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{CustomAlias: &reserved})
+	require.ErrorIs(t, err, models.ErrAliasTaken)
+}
+
+func TestUpdateURL_InvalidExpiration(t *testing.T) {
+	service, created := newMemoryService(t)
+
+	past := time.Now().Add(-time.Hour)
+	_, err := service.UpdateURL(context.Background(), created.ShortURL, models.UpdateURLRequest{ExpiresAt: &past})
+	require.ErrorIs(t, err, models.ErrInvalidExpiration)
+}
+
+func TestSetDisabled(t *testing.T) {
+	service, created := newMemoryService(t)
+	ctx := context.Background()
+
+	url, err := service.SetDisabled(ctx, created.ShortURL, true)
+	require.NoError(t, err)
+	assert.True(t, url.Disabled)
+
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrDisabled)
+
+	// The full record stays available to the owner.
+	url, err = service.GetURL(ctx, created.ShortURL)
+	require.NoError(t, err)
+	assert.True(t, url.Disabled)
+
+	_, err = service.SetDisabled(ctx, created.ShortURL, false)
+	require.NoError(t, err)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.NoError(t, err)
+}
+
+func TestDeleteURL(t *testing.T) {
+	service, created := newMemoryService(t)
+	ctx := context.Background()
+
+	require.NoError(t, service.LogRedirect(ctx, created.ShortURL, Visit{}))
+	require.NoError(t, service.DeleteURL(ctx, created.ShortURL))
+
+	_, err := service.GetURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrNotFound)
+	require.ErrorIs(t, service.DeleteURL(ctx, created.ShortURL), models.ErrNotFound)
+}
+
+func TestResolveURL_ClickLimit(t *testing.T) {
+	service := NewURLService(memory.NewURLRepository(), nil)
+	ctx := context.Background()
+
+	limit := 2
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com", MaxClicks: &limit})
+	require.NoError(t, err)
+
+	for range limit {
+		_, err = service.ResolveURL(ctx, created.ShortURL)
+		require.NoError(t, err)
+	}
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrClickLimitReached)
+
+	stats, err := service.GetStats(ctx, created.ShortURL, models.StatsQuery{})
+	require.NoError(t, err)
+	assert.Equal(t, &limit, stats.MaxClicks)
+	require.NotNil(t, stats.RemainingClicks)
+	assert.Equal(t, 0, *stats.RemainingClicks)
+}
+
+func TestResolveURL_ActivationWindow(t *testing.T) {
+	metrics := &countingMetrics{}
+	service := NewURLService(memory.NewURLRepository(), nil, WithMetrics(metrics))
+	ctx := context.Background()
+
+	launch := time.Now().Add(time.Hour)
+	end := launch.Add(time.Hour)
+	_, err := service.CreateShortURL(ctx, models.ShortenRequest{
+		URL: "https://example.com", ActivatesAt: &end, ExpiresAt: &launch,
+	})
+	require.ErrorIs(t, err, models.ErrInvalidExpiration)
+
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{
+		URL: "https://example.com", ActivatesAt: &launch, ExpiresAt: &end,
+	})
+	require.NoError(t, err)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrNotYetActive)
+	assert.Equal(t, 1, metrics.redirects[RedirectInactive])
+
+	_, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{ActivatesAt: &end})
+	require.ErrorIs(t, err, models.ErrInvalidExpiration)
+
+	url, err := service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{ActivateNow: true})
+	require.NoError(t, err)
+	assert.Nil(t, url.ActivatesAt)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.NoError(t, err)
+}
+
+func TestGetStats_ClickSeries(t *testing.T) {
+	repo := memory.NewURLRepository()
+	service := NewURLService(repo, nil, WithConfig(Config{StatsMaxBuckets: 48}))
+	ctx := context.Background()
+
+	created, err := service.CreateShortURL(ctx, aliasRequest("campaign"))
+	require.NoError(t, err)
+	day := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+	for i, at := range []time.Time{day.Add(time.Hour), day.Add(90 * time.Minute), day.Add(26 * time.Hour)} {
+		log := models.RedirectLog{ID: strconv.Itoa(i), ShortURL: created.ShortURL, AccessedAt: at}
+		require.NoError(t, repo.SaveRedirectLog(ctx, log))
+	}
+
+	// Aliases work and days without clicks are reported as zero.
+	stats, err := service.GetStats(ctx, "campaign", models.StatsQuery{From: day, To: day.AddDate(0, 0, 3)})
+	require.NoError(t, err)
+	assert.Equal(t, "day", stats.Granularity)
+	assert.Equal(t, "UTC", stats.TimeZone)
+	assert.Equal(t, []models.ClickBucket{
+		{Start: day, Clicks: 2},
+		{Start: day.AddDate(0, 0, 1), Clicks: 1},
+		{Start: day.AddDate(0, 0, 2), Clicks: 0},
+	}, stats.Series)
+
+	_, err = service.GetStats(ctx, created.ShortURL, models.StatsQuery{
+		From: day, To: day.AddDate(0, 0, 3), Granularity: timebucket.Hour,
+	})
+	require.ErrorIs(t, err, models.ErrInvalidRequest)
+	_, err = service.GetStats(ctx, created.ShortURL, models.StatsQuery{From: day, To: day})
+	require.ErrorIs(t, err, models.ErrInvalidRequest)
+}
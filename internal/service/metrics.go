@@ -0,0 +1,35 @@
+package service
+
+// Redirect outcomes reported to Metrics.Redirect.
+const (
+	RedirectHit     = "hit"
+	RedirectMiss    = "miss"
+	RedirectExpired = "expired"
+	// RedirectInactive means the link is scheduled to activate later.
+	RedirectInactive = "inactive"
+	RedirectDisabled = "disabled"
+	RedirectBlocked  = "blocked"
+	// RedirectLocked means a password was missing or wrong.
+	RedirectLocked = "locked"
+	// RedirectExhausted means the link has reached its click limit.
+	RedirectExhausted = "exhausted"
+)
+
+// Metrics receives events worth counting from the service.
+type Metrics interface {
+	// LinkCreated is called for every stored link.
+	LinkCreated()
+	// Redirect is called for every resolved short URL with one of the Redirect* outcomes.
+	Redirect(outcome string)
+	// CodeCollision is called whenever a generated short code was already taken.
+	CodeCollision()
+	// CodeRetriesExhausted is called when CreateShortURL gave up after too many collisions.
+	CodeRetriesExhausted()
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) LinkCreated()          {}
+func (nopMetrics) Redirect(string)       {}
+func (nopMetrics) CodeCollision()        {}
+func (nopMetrics) CodeRetriesExhausted() {}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+// hashPassword returns the bcrypt hash of password, or an empty hash for an
+// empty password, which means the link is not protected.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return "", fmt.Errorf("%w: password is too long", models.ErrInvalidRequest)
+		}
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// unlock verifies password against the password of url within the failure
+// budget of the link. The budget is shared by all clients, so guesses spread
+// over many addresses are limited as well. Concurrent attempts may overshoot
+// it by the attempts in flight, which the per-client limit keeps small.
+func (s *urlService) unlock(ctx context.Context, url models.URL, password *string) error {
+	if url.PasswordHash == "" || password == nil {
+		return checkPassword(url, password)
+	}
+	window := s.passwordFailureWindow()
+	failures, err := s.repo.GetPasswordFailures(ctx, url.ShortURL, window)
+	if err != nil {
+		return fmt.Errorf("get password failures: %w", err)
+	}
+	if failures >= s.passwordMaxFailures() {
+		return models.ErrTooManyAttempts
+	}
+	err = checkPassword(url, password)
+	if errors.Is(err, models.ErrInvalidPassword) {
+		if _, countErr := s.repo.CountPasswordFailure(ctx, url.ShortURL, window); countErr != nil {
+			s.logger.Error("service, failed to count password failure", zap.Error(countErr))
+		}
+	}
+	return err
+}
+
+// checkPassword verifies password against the password of url. Unprotected
+// links accept any password.
+func checkPassword(url models.URL, password *string) error {
+	switch {
+	case url.PasswordHash == "":
+		return nil
+	case password == nil:
+		return models.ErrPasswordRequired
+	case bcrypt.CompareHashAndPassword([]byte(url.PasswordHash), []byte(*password)) != nil:
+		return models.ErrInvalidPassword
+	default:
+		return nil
+	}
+}
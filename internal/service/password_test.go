@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/auth"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+)
+
+func TestUnlockURL(t *testing.T) {
+	metrics := &countingMetrics{}
+	service := NewURLService(memory.NewURLRepository(), nil, WithMetrics(metrics))
+	ctx := auth.WithOwner(context.Background(), "alice")
+
+	password, limit := "secret", 1
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{
+		URL: "https://example.com", Password: &password, MaxClicks: &limit,
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, password, created.PasswordHash)
+
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrPasswordRequired)
+	_, err = service.UnlockURL(ctx, created.ShortURL, "wrong")
+	require.ErrorIs(t, err, models.ErrInvalidPassword)
+	assert.Equal(t, 2, metrics.redirects[RedirectLocked])
+
+	// Failed attempts do not use up the click limit.
+	url, err := service.UnlockURL(ctx, created.ShortURL, password)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/", url.OriginalURL)
+	_, err = service.UnlockURL(ctx, created.ShortURL, password)
+	require.ErrorIs(t, err, models.ErrClickLimitReached)
+}
+
+func TestUpdateURL_Password(t *testing.T) {
+	service := NewURLService(memory.NewURLRepository(), nil)
+	ctx := context.Background()
+
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+
+	password := "secret"
+	_, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{Password: &password})
+	require.NoError(t, err)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrPasswordRequired)
+
+	// Statistics of protected links are only shown to their owner.
+	_, err = service.GetStats(ctx, created.ShortURL, models.StatsQuery{})
+	require.ErrorIs(t, err, models.ErrForbidden)
+
+	none := ""
+	_, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{Password: &none})
+	require.NoError(t, err)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.NoError(t, err)
+	_, err = service.GetStats(ctx, created.ShortURL, models.StatsQuery{})
+	require.NoError(t, err)
+}
+
+func TestUnlockURL_FailureBudget(t *testing.T) {
+	service := NewURLService(memory.NewURLRepository(), nil,
+		WithConfig(Config{PasswordMaxFailures: 2, PasswordFailureWindow: time.Hour}))
+	ctx := context.Background()
+
+	password := "secret"
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com", Password: &password})
+	require.NoError(t, err)
+	other, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.org", Password: &password})
+	require.NoError(t, err)
+
+	for range 2 {
+		_, err = service.UnlockURL(ctx, created.ShortURL, "wrong")
+		require.ErrorIs(t, err, models.ErrInvalidPassword)
+	}
+	// The budget is used up for every client, even with the right password.
+	_, err = service.UnlockURL(ctx, created.ShortURL, password)
+	require.ErrorIs(t, err, models.ErrTooManyAttempts)
+
+	// Other links have their own budget.
+	_, err = service.UnlockURL(ctx, other.ShortURL, password)
+	require.NoError(t, err)
+}
@@ -0,0 +1,17 @@
+package service
+
+import "context"
+
+// Policy decides which destinations may be shortened and followed, see
+// policy.Policy. Rejections wrap models.ErrBlocked.
+type Policy interface {
+	// CheckDestination is consulted for every new or changed destination.
+	CheckDestination(ctx context.Context, destination string) error
+	// CheckRedirect is consulted for every redirect and must be cheap.
+	CheckRedirect(destination string) error
+}
+
+type nopPolicy struct{}
+
+func (nopPolicy) CheckDestination(context.Context, string) error { return nil }
+func (nopPolicy) CheckRedirect(string) error                     { return nil }
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/internal/repository/memory"
+)
+
+// hostPolicy blocks every destination containing one of its substrings.
+type hostPolicy []string
+
+func (p *hostPolicy) CheckDestination(_ context.Context, destination string) error {
+	return p.CheckRedirect(destination)
+}
+
+func (p *hostPolicy) CheckRedirect(destination string) error {
+	for _, blocked := range *p {
+		if strings.Contains(destination, blocked) {
+			return fmt.Errorf("%w: %s", models.ErrBlocked, blocked)
+		}
+	}
+	return nil
+}
+
+func TestPolicy_RejectsDestinations(t *testing.T) {
+	policy := &hostPolicy{"evil.example"}
+	service := NewURLService(memory.NewURLRepository(), nil, WithPolicy(policy))
+	ctx := context.Background()
+
+	// The policy sees the normalized destination.
+	_, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://EVIL.example/login"})
+	require.ErrorIs(t, err, models.ErrBlocked)
+
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+	evil := "https://evil.example"
+	_, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{URL: &evil})
+	require.ErrorIs(t, err, models.ErrBlocked)
+
+	results, err := service.CreateShortURLs(ctx, []models.ShortenRequest{{URL: evil}, {URL: "https://example.org"}}, false)
+	require.NoError(t, err)
+	require.ErrorIs(t, results[0].Err, models.ErrBlocked)
+	require.NoError(t, results[1].Err)
+}
+
+func TestPolicy_BlocksRedirects(t *testing.T) {
+	policy := &hostPolicy{}
+	metrics := &countingMetrics{}
+	service := NewURLService(memory.NewURLRepository(), nil, WithPolicy(policy), WithMetrics(metrics))
+	ctx := context.Background()
+
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com"})
+	require.NoError(t, err)
+
+	// Destinations listed after the link was created are blocked as well.
+	*policy = hostPolicy{"example.com"}
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrBlocked)
+	*policy = nil
+
+	url, err := service.SetBlocked(ctx, created.ShortURL, true)
+	require.NoError(t, err)
+	assert.True(t, url.Blocked)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrBlocked)
+
+	// Editing the link keeps the block.
+	destination := "https://example.org"
+	url, err = service.UpdateURL(ctx, created.ShortURL, models.UpdateURLRequest{URL: &destination})
+	require.NoError(t, err)
+	assert.True(t, url.Blocked)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrBlocked)
+
+	_, err = service.SetBlocked(ctx, created.ShortURL, false)
+	require.NoError(t, err)
+	_, err = service.ResolveURL(ctx, created.ShortURL)
+	require.NoError(t, err)
+	assert.Equal(t, 3, metrics.redirects[RedirectBlocked])
+	assert.Equal(t, 1, metrics.redirects[RedirectHit])
+}
+
+func TestPolicy_ChecksFallbackURLs(t *testing.T) {
+	policy := &hostPolicy{"evil.example"}
+	service := NewURLService(memory.NewURLRepository(), nil, WithPolicy(policy))
+	ctx := context.Background()
+
+	evil := "https://evil.example"
+	_, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com", FallbackURL: &evil})
+	require.ErrorIs(t, err, models.ErrBlocked)
+
+	fallback := "HTTPS://Example.org"
+	created, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "https://example.com", FallbackURL: &fallback})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.org/", created.FallbackURL)
+	_, err = service.SetDisabled(ctx, created.ShortURL, true)
+	require.NoError(t, err)
+
+	url, err := service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrDisabled)
+	assert.Equal(t, "https://example.org/", url.FallbackURL)
+
+	// Fallbacks listed after the link was created are not used.
+	*policy = hostPolicy{"example.org"}
+	url, err = service.ResolveURL(ctx, created.ShortURL)
+	require.ErrorIs(t, err, models.ErrDisabled)
+	assert.Empty(t, url.FallbackURL)
+}
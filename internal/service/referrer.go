@@ -0,0 +1,44 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/vladislavprovich/url-shortener/internal/models"
+)
+
+const (
+	defaultReferrerPageSize = 50
+	maxReferrerPageSize     = 500
+)
+
+// referrerHost returns the lowercased host of a Referer header, or nil if it
+// is not an absolute URL.
+func referrerHost(referrer string) *string {
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	return &host
+}
+
+// referrerQuery applies the defaults of GetReferrers to query and validates it.
+func referrerQuery(query models.ReferrerQuery) (models.ReferrerQuery, error) {
+	if query.Group == "" {
+		query.Group = models.ReferrerGroupHost
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultReferrerPageSize
+	}
+	switch {
+	case query.Group != models.ReferrerGroupHost && query.Group != models.ReferrerGroupURL:
+		return query, fmt.Errorf("%w: group must be host or url", models.ErrInvalidRequest)
+	case query.Limit < 1 || query.Limit > maxReferrerPageSize:
+		return query, fmt.Errorf("%w: limit must be between 1 and %d", models.ErrInvalidRequest, maxReferrerPageSize)
+	case query.Offset < 0:
+		return query, fmt.Errorf("%w: offset must not be negative", models.ErrInvalidRequest)
+	}
+	return query, nil
+}
@@ -4,137 +4,665 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/google/uuid"
+	"github.com/vladislavprovich/url-shortener/internal/auth"
 	"github.com/vladislavprovich/url-shortener/internal/models"
 	"github.com/vladislavprovich/url-shortener/internal/repository"
+	"github.com/vladislavprovich/url-shortener/pkg/normalizer"
 	"github.com/vladislavprovich/url-shortener/pkg/shortener"
+	"github.com/vladislavprovich/url-shortener/pkg/timebucket"
+)
+
+const (
+	defaultCodeLength        = 7
+	defaultCollisionRetries  = 5
+	defaultStatsMaxBuckets   = 1000
+	defaultStatsTopReferrers = 10
+	defaultStatsTopValues    = 10
+
+	defaultPasswordMaxFailures   = 20
+	defaultPasswordFailureWindow = 15 * time.Minute
 )
 
 type URLService interface {
-	CreateShortURL(ctx context.Context, req models.ShortenRequest) (string, error)
+	CreateShortURL(ctx context.Context, req models.ShortenRequest) (models.URL, error)
+	CreateShortURLs(ctx context.Context, reqs []models.ShortenRequest, atomic bool) ([]BatchResult, error)
 	GetOriginalURL(ctx context.Context, shortURL string) (string, error)
-	LogRedirect(ctx context.Context, shortURL, referrer string) error
-	GetStats(ctx context.Context, shortURL string) (models.StatsResponse, error)
+	ResolveURL(ctx context.Context, shortURL string) (models.URL, error)
+	UnlockURL(ctx context.Context, shortURL, password string) (models.URL, error)
+	GetURL(ctx context.Context, shortURL string) (models.URL, error)
+	UpdateURL(ctx context.Context, shortURL string, req models.UpdateURLRequest) (models.URL, error)
+	SetDisabled(ctx context.Context, shortURL string, disabled bool) (models.URL, error)
+	SetBlocked(ctx context.Context, shortURL string, blocked bool) (models.URL, error)
+	DeleteURL(ctx context.Context, shortURL string) error
+	LogRedirect(ctx context.Context, shortURL string, visit Visit) error
+	LogFallback(ctx context.Context, shortURL string, visit Visit, reason string) error
+	GetStats(ctx context.Context, shortURL string, query models.StatsQuery) (models.StatsResponse, error)
+	GetReferrers(ctx context.Context, shortURL string, query models.ReferrerQuery) (models.ReferrerPage, error)
+}
+
+// ClickRecorder receives the redirect log of every successful redirect.
+type ClickRecorder interface {
+	Record(ctx context.Context, log models.RedirectLog) error
+}
+
+// repositoryRecorder writes redirect logs synchronously, it is used when no
+// other ClickRecorder is configured.
+type repositoryRecorder struct {
+	repo repository.URLRepository
+}
+
+func (r repositoryRecorder) Record(ctx context.Context, log models.RedirectLog) error {
+	return r.repo.SaveRedirectLog(ctx, log)
 }
 
 type urlService struct {
-	repo   repository.URLRepository
-	logger *zap.Logger
+	repo       repository.URLRepository
+	logger     *zap.Logger
+	config     Config
+	clicks     ClickRecorder
+	generator  shortener.Generator
+	normalizer *normalizer.Normalizer
+	policy     Policy
+	metrics    Metrics
+	geo        GeoLocator
+}
+
+// Option customizes the service created by NewURLService.
+type Option func(*urlService)
+
+// WithClickRecorder replaces the synchronous redirect logging, e.g. with a clicklog.Pipeline.
+func WithClickRecorder(recorder ClickRecorder) Option {
+	return func(s *urlService) {
+		s.clicks = recorder
+	}
+}
+
+// WithGenerator sets the short code generator, random base62 codes by default.
+func WithGenerator(generator shortener.Generator) Option {
+	return func(s *urlService) {
+		s.generator = generator
+	}
+}
+
+// WithNormalizer sets the destination URL normalizer, by default only http and
+// https URLs are accepted and the query is left untouched.
+func WithNormalizer(n *normalizer.Normalizer) Option {
+	return func(s *urlService) {
+		s.normalizer = n
+	}
+}
+
+// WithPolicy sets the destination policy, by default every destination is accepted.
+func WithPolicy(policy Policy) Option {
+	return func(s *urlService) {
+		s.policy = policy
+	}
 }
 
-func NewURLService(repo repository.URLRepository, logger *zap.Logger) URLService {
-	return &urlService{
-		repo:   repo,
-		logger: logger,
+// WithMetrics sets the receiver of service metrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(s *urlService) {
+		s.metrics = metrics
 	}
 }
 
+// WithGeoLocator locates the clients of redirects, by default they are not located.
+func WithGeoLocator(geo GeoLocator) Option {
+	return func(s *urlService) {
+		s.geo = geo
+	}
+}
+
+// WithConfig sets the service configuration.
+func WithConfig(cfg Config) Option {
+	return func(s *urlService) {
+		s.config = cfg
+	}
+}
+
+func NewURLService(repo repository.URLRepository, logger *zap.Logger, opts ...Option) URLService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	s := &urlService{
+		repo:       repo,
+		logger:     logger,
+		clicks:     repositoryRecorder{repo: repo},
+		generator:  shortener.NewRandomGenerator(defaultCodeLength),
+		normalizer: normalizer.New(normalizer.Config{}),
+		policy:     nopPolicy{},
+		metrics:    nopMetrics{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
 func isValidAlias(alias *string) bool {
 	return alias != nil && *alias != ""
 }
 
-func (s *urlService) CreateShortURL(ctx context.Context, req models.ShortenRequest) (string, error) {
+// isReservedCode reports whether code collides with a fixed route and would
+// therefore never reach the redirect handler.
+func isReservedCode(code string) bool {
+	switch code {
+	case "shorten", "links", "metrics", "healthz", "readyz":
+		return true
+	default:
+		return false
+	}
+}
+
+// checkActivation rejects activation times that are not before the expiration,
+// the link would never work.
+func checkActivation(activatesAt, expiresAt *time.Time) error {
+	if activatesAt != nil && expiresAt != nil && !activatesAt.Before(*expiresAt) {
+		return fmt.Errorf("%w: activation must be before the expiration", models.ErrInvalidExpiration)
+	}
+	return nil
+}
+
+// isActive reports whether now is past the activation time of url.
+func isActive(url models.URL, now time.Time) bool {
+	return url.ActivatesAt == nil || !now.Before(*url.ActivatesAt)
+}
+
+// resolveExpiration turns an absolute or relative expiration into an absolute
+// time, enforcing that it lies in the future and within MaxTTL.
+func (s *urlService) resolveExpiration(absolute *time.Time, relative *string, now time.Time) (*time.Time, error) {
+	var expiresAt time.Time
+	switch {
+	case absolute != nil && relative != nil:
+		return nil, fmt.Errorf("%w: expires_at and ttl are mutually exclusive", models.ErrInvalidExpiration)
+	case absolute != nil:
+		expiresAt = *absolute
+	case relative != nil:
+		ttl, err := time.ParseDuration(*relative)
+		if err != nil {
+			return nil, fmt.Errorf("%w: ttl: %w", models.ErrInvalidExpiration, err)
+		}
+		if ttl <= 0 {
+			return nil, fmt.Errorf("%w: ttl must be positive", models.ErrInvalidExpiration)
+		}
+		expiresAt = now.Add(ttl)
+	default:
+		return nil, nil //nolint:nilnil // no expiration requested
+	}
+
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expiration is in the past", models.ErrInvalidExpiration)
+	}
+	if s.config.MaxTTL > 0 && expiresAt.Sub(now) > s.config.MaxTTL {
+		return nil, fmt.Errorf("%w: expiration exceeds maximum of %s", models.ErrInvalidExpiration, s.config.MaxTTL)
+	}
+	return &expiresAt, nil
+}
+
+func (s *urlService) CreateShortURL(ctx context.Context, req models.ShortenRequest) (models.URL, error) {
 	s.logger.Info("service.CreateShortURL", zap.String("original_url", req.URL))
 
-	var shortURL string
-	if isValidAlias(req.CustomAlias) {
-		s.logger.Info("service, custom alias provided", zap.String("custom_alias", *req.CustomAlias))
-		_, err := s.repo.GetURL(ctx, *req.CustomAlias)
-		if err == nil {
-			s.logger.Warn("service, custom alias already in use", zap.String("custom_alias", *req.CustomAlias))
-			return "", errors.New("custom alias already in use")
+	url, err := s.newURL(ctx, req, time.Now())
+	if err != nil {
+		return models.URL{}, err
+	}
+
+	if s.shouldDeduplicate(req) {
+		existing, err := s.repo.FindByDestination(ctx, url.DestinationHash, url.OwnerID)
+		switch {
+		case err == nil:
+			s.logger.Info("service, returning existing short URL for destination",
+				zap.String("short_url", existing.ShortURL))
+			return existing, nil
+		case !errors.Is(err, models.ErrNotFound):
+			s.logger.Error("service, failed to look up destination", zap.Error(err))
+			return models.URL{}, fmt.Errorf("find by destination: %w", err)
 		}
+	}
 
-		shortURL = *req.CustomAlias
-	} else {
+	if !isValidAlias(req.CustomAlias) {
 		s.logger.Info("service, generating unique short URL")
-		for {
-			shortURL = shortener.GeneratorShortURL()
-			_, err := s.repo.GetURL(ctx, shortURL)
-			if err != nil {
-				if strings.Contains(err.Error(), "URL not found") {
-					s.logger.Info("service, unique short URL generated", zap.String("short_url", shortURL))
-					break
-				}
-				s.logger.Error("service, error checking short URL uniqueness", zap.Error(err))
-				return "", err
-			}
+		return s.saveWithGeneratedCode(ctx, url)
+	}
+
+	s.logger.Info("service, custom alias provided", zap.String("custom_alias", *req.CustomAlias))
+	_, err = s.repo.GetURL(ctx, *req.CustomAlias)
+	if err == nil || isReservedCode(*req.CustomAlias) {
+		s.logger.Warn("service, custom alias already in use", zap.String("custom_alias", *req.CustomAlias))
+		return models.URL{}, models.ErrAliasTaken
+	}
+	url.ShortURL = *req.CustomAlias
+
+	err = s.repo.SaveURL(ctx, url)
+	if err != nil {
+		s.logger.Error("service, failed to save URL", zap.Error(err))
+		if errors.Is(err, models.ErrShortURLTaken) {
+			// The alias doubles as the short URL, so either constraint means the alias is taken.
+			return models.URL{}, models.ErrAliasTaken
+		}
+		return models.URL{}, fmt.Errorf("create short url, get url err: %w", err)
+	}
+
+	s.metrics.LinkCreated()
+	s.logger.Info("service, short URL created successfully", zap.String("short_url", url.ShortURL))
+	return url, nil
+}
+
+// newURL builds the link described by req, without a short code yet.
+func (s *urlService) newURL(ctx context.Context, req models.ShortenRequest, now time.Time) (models.URL, error) {
+	destination, err := s.checkDestination(ctx, req.URL)
+	if err != nil {
+		return models.URL{}, err
+	}
+	expiresAt, err := s.resolveExpiration(req.ExpiresAt, req.TTL, now)
+	if err != nil {
+		s.logger.Warn("service, invalid expiration", zap.Error(err))
+		return models.URL{}, err
+	}
+	if err = checkActivation(req.ActivatesAt, expiresAt); err != nil {
+		return models.URL{}, err
+	}
+
+	var fallbackURL string
+	if req.FallbackURL != nil {
+		if fallbackURL, err = s.checkDestination(ctx, *req.FallbackURL); err != nil {
+			return models.URL{}, err
+		}
+	}
+
+	var passwordHash string
+	if req.Password != nil {
+		if passwordHash, err = hashPassword(*req.Password); err != nil {
+			return models.URL{}, err
 		}
 	}
 
 	url := models.URL{
-		ID:          uuid.New().String(),
-		OriginalURL: req.URL,
-		ShortURL:    shortURL,
-		CustomAlias: req.CustomAlias,
-		CreatedAt:   time.Now(),
+		ID:              uuid.New().String(),
+		OriginalURL:     destination,
+		CustomAlias:     req.CustomAlias,
+		CreatedAt:       now,
+		ExpiredAt:       expiresAt,
+		ActivatesAt:     req.ActivatesAt,
+		FallbackURL:     fallbackURL,
+		RedirectType:    req.RedirectType,
+		MaxClicks:       req.MaxClicks,
+		PasswordHash:    passwordHash,
+		DestinationHash: destinationHash(destination),
+	}
+	if owner, ok := auth.OwnerFromContext(ctx); ok {
+		url.OwnerID = &owner
 	}
+	return url, nil
+}
 
-	err := s.repo.SaveURL(ctx, url)
+// checkDestination returns the canonical form of a destination URL if the
+// policy accepts it.
+func (s *urlService) checkDestination(ctx context.Context, destination string) (string, error) {
+	normalized, err := s.normalizer.Normalize(destination)
 	if err != nil {
-		s.logger.Error("service, failed to save URL", zap.Error(err))
-		return "", fmt.Errorf("create short url, get url err: %w", err)
+		s.logger.Warn("service, invalid destination URL", zap.String("url", destination), zap.Error(err))
+		return "", fmt.Errorf("%w: %w", models.ErrInvalidURL, err)
+	}
+	if err = s.policy.CheckDestination(ctx, normalized); err != nil {
+		s.logger.Warn("service, destination rejected by policy", zap.String("url", normalized), zap.Error(err))
+		return "", err
+	}
+	return normalized, nil
+}
+
+// saveWithGeneratedCode stores url under a freshly generated short code. A
+// code that is already taken, found either by the lookup or by the unique
+// constraint on insert, is retried until the collision budget is spent.
+func (s *urlService) saveWithGeneratedCode(ctx context.Context, url models.URL) (models.URL, error) {
+	for attempt := 0; attempt <= s.collisionRetries(); attempt++ {
+		code, err := s.generator.Generate(ctx)
+		if err != nil {
+			s.logger.Error("service, failed to generate short URL", zap.Error(err))
+			return models.URL{}, fmt.Errorf("generate short url: %w", err)
+		}
+
+		_, err = s.repo.GetURL(ctx, code)
+		switch {
+		case err == nil || isReservedCode(code):
+			s.logger.Info("service, generated short URL already in use", zap.String("short_url", code))
+		case errors.Is(err, models.ErrNotFound):
+			url.ShortURL = code
+			err = s.repo.SaveURL(ctx, url)
+			if err == nil {
+				s.metrics.LinkCreated()
+				s.logger.Info("service, short URL created successfully", zap.String("short_url", code))
+				return url, nil
+			}
+			s.logger.Error("service, failed to save URL", zap.Error(err))
+			if !errors.Is(err, models.ErrShortURLTaken) {
+				return models.URL{}, fmt.Errorf("create short url, get url err: %w", err)
+			}
+		default:
+			s.logger.Error("service, error checking short URL uniqueness", zap.Error(err))
+			return models.URL{}, err
+		}
+		s.metrics.CodeCollision()
+	}
+
+	s.metrics.CodeRetriesExhausted()
+	s.logger.Error("service, short URL collision retry budget exhausted", zap.Int("retries", s.collisionRetries()))
+	return models.URL{}, models.ErrCodeGenerationFailed
+}
+
+// statsTopReferrers, statsTopValues, statsMaxBuckets, collisionRetries and the
+// password failure budget fall back to their defaults for a zero Config, e.g.
+// of a service created without WithConfig. Loaded configurations are
+// validated to be positive.
+func (s *urlService) statsTopReferrers() int {
+	if s.config.StatsTopReferrers > 0 {
+		return s.config.StatsTopReferrers
+	}
+	return defaultStatsTopReferrers
+}
+
+func (s *urlService) statsTopValues() int {
+	if s.config.StatsTopValues > 0 {
+		return s.config.StatsTopValues
+	}
+	return defaultStatsTopValues
+}
+
+func (s *urlService) statsMaxBuckets() int {
+	if s.config.StatsMaxBuckets > 0 {
+		return s.config.StatsMaxBuckets
+	}
+	return defaultStatsMaxBuckets
+}
+
+func (s *urlService) collisionRetries() int {
+	if s.config.CollisionRetries > 0 {
+		return s.config.CollisionRetries
+	}
+	return defaultCollisionRetries
+}
+
+func (s *urlService) passwordMaxFailures() int {
+	if s.config.PasswordMaxFailures > 0 {
+		return s.config.PasswordMaxFailures
 	}
+	return defaultPasswordMaxFailures
+}
 
-	s.logger.Info("service, short URL created successfully", zap.String("short_url", shortURL))
-	return url.ShortURL, nil
+func (s *urlService) passwordFailureWindow() time.Duration {
+	if s.config.PasswordFailureWindow > 0 {
+		return s.config.PasswordFailureWindow
+	}
+	return defaultPasswordFailureWindow
 }
 
 func (s *urlService) GetOriginalURL(ctx context.Context, shortURL string) (string, error) {
-	s.logger.Info("service.GetOriginalURL", zap.String("short_url", shortURL))
-	originalURL, err := s.repo.GetURL(ctx, shortURL)
+	url, err := s.ResolveURL(ctx, shortURL)
 	if err != nil {
+		return "", err
+	}
+	return url.OriginalURL, nil
+}
+
+// ResolveURL returns the link behind shortURL if it may currently be followed.
+// Password protected links fail with models.ErrPasswordRequired, they are
+// followed with UnlockURL. Expired, exhausted, disabled and not yet active
+// links are returned together with the error, for their fallback URL.
+func (s *urlService) ResolveURL(ctx context.Context, shortURL string) (models.URL, error) {
+	s.logger.Info("service.ResolveURL", zap.String("short_url", shortURL))
+	return s.resolve(ctx, shortURL, nil)
+}
+
+// UnlockURL is ResolveURL for password protected links.
+func (s *urlService) UnlockURL(ctx context.Context, shortURL, password string) (models.URL, error) {
+	s.logger.Info("service.UnlockURL", zap.String("short_url", shortURL))
+	return s.resolve(ctx, shortURL, &password)
+}
+
+func (s *urlService) resolve(ctx context.Context, shortURL string, password *string) (models.URL, error) {
+	url, err := s.repo.GetURL(ctx, shortURL)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			s.metrics.Redirect(RedirectMiss)
+		}
 		s.logger.Info("service, failed to get original URL", zap.String("short_url", shortURL))
-		return "", fmt.Errorf("get short url, get url err:, %w", err)
+		return models.URL{}, fmt.Errorf("get short url, get url err:, %w", err)
 	}
 
-	if originalURL.ExpiredAt != nil && time.Now().After(*originalURL.ExpiredAt) {
+	now := time.Now()
+	if url.ExpiredAt != nil && now.After(*url.ExpiredAt) {
+		s.metrics.Redirect(RedirectExpired)
 		s.logger.Info("service, storage time has expired, URL has expired", zap.String("short_url", shortURL))
-		return "", errors.New("URL has expired")
-	}
-	s.logger.Info("service, origin URL retrieved successfully", zap.String("original_url", originalURL.OriginalURL))
-	return originalURL.OriginalURL, nil
-}
-
-func (s *urlService) LogRedirect(ctx context.Context, shortURL, referrer string) error {
-	s.logger.Info("service.LogRedirect", zap.String("short_url", shortURL), zap.String("referrer", referrer))
-	var referrerPtr *string
-	if referrer != "" {
-		referrerPtr = &referrer
-		s.logger.Info("referrer is nil, ", zap.String("referrerPtr", *referrerPtr))
-	} else {
-		s.logger.Info("Referrer is empty, not assigning to referrerPtr")
-	}
-	s.logger.Info("Saving RedirectLog to repository",
-		zap.String("short_url", shortURL),
-		zap.Time("accessed_at", time.Now()))
-	log := models.RedirectLog{
-		ID:         uuid.New().String(),
-		ShortURL:   shortURL,
-		AccessedAt: time.Now(),
-		Referrer:   referrerPtr,
-	}
-	err := s.repo.SaveRedirectLog(ctx, log)
-	if err != nil {
+		return s.unavailable(url, models.ErrExpired)
+	}
+	if !isActive(url, now) {
+		s.metrics.Redirect(RedirectInactive)
+		s.logger.Info("service, URL is not active yet", zap.String("short_url", shortURL))
+		return s.unavailable(url, models.ErrNotYetActive)
+	}
+	if url.Disabled {
+		s.metrics.Redirect(RedirectDisabled)
+		s.logger.Info("service, URL is disabled", zap.String("short_url", shortURL))
+		return s.unavailable(url, models.ErrDisabled)
+	}
+	if url.Blocked {
+		s.metrics.Redirect(RedirectBlocked)
+		s.logger.Warn("service, URL is blocked", zap.String("short_url", shortURL))
+		return models.URL{}, models.ErrBlocked
+	}
+	if err = s.policy.CheckRedirect(url.OriginalURL); err != nil {
+		s.metrics.Redirect(RedirectBlocked)
+		s.logger.Warn("service, destination rejected by policy", zap.String("short_url", shortURL), zap.Error(err))
+		return models.URL{}, err
+	}
+	if err = s.unlock(ctx, url, password); err != nil {
+		s.metrics.Redirect(RedirectLocked)
+		s.logger.Info("service, URL is password protected", zap.String("short_url", shortURL), zap.Error(err))
+		return models.URL{}, err
+	}
+	if url.MaxClicks != nil {
+		if err = s.repo.ConsumeClick(ctx, url.ShortURL); err != nil {
+			if errors.Is(err, models.ErrClickLimitReached) {
+				s.metrics.Redirect(RedirectExhausted)
+				s.logger.Info("service, URL has reached its click limit", zap.String("short_url", shortURL))
+				return s.unavailable(url, err)
+			}
+			s.logger.Error("service, failed to count click", zap.Error(err))
+			return models.URL{}, fmt.Errorf("consume click: %w", err)
+		}
+		url.ClickCount++
+	}
+	s.metrics.Redirect(RedirectHit)
+	s.logger.Info("service, origin URL retrieved successfully", zap.String("original_url", url.OriginalURL))
+	return url, nil
+}
+
+// unavailable returns url together with err, so that callers can send the
+// visitor to its fallback URL. A fallback rejected by the policy is dropped.
+func (s *urlService) unavailable(url models.URL, err error) (models.URL, error) {
+	if url.FallbackURL != "" && s.policy.CheckRedirect(url.FallbackURL) != nil {
+		s.logger.Warn("service, fallback URL rejected by policy", zap.String("short_url", url.ShortURL))
+		url.FallbackURL = ""
+	}
+	return url, err
+}
+
+// LogRedirect records a redirect of visit to shortURL.
+func (s *urlService) LogRedirect(ctx context.Context, shortURL string, visit Visit) error {
+	s.logger.Info("service.LogRedirect", zap.String("short_url", shortURL), zap.String("referrer", visit.Referrer))
+	log := s.redirectLog(shortURL, visit)
+	if err := s.clicks.Record(ctx, log); err != nil {
 		s.logger.Error("Error saving RedirectLog", zap.String("log_id", log.ID), zap.Error(err))
 		return err
 	}
-
 	return nil
 }
 
-func (s *urlService) GetStats(ctx context.Context, shortURL string) (models.StatsResponse, error) {
+// GetStats returns the statistics of shortURL. A click time series is added
+// when query sets a granularity or a time range, by default it covers the
+// lifetime of the link in days.
+func (s *urlService) GetStats(
+	ctx context.Context, shortURL string, query models.StatsQuery,
+) (models.StatsResponse, error) {
 	s.logger.Info("service GetStatus", zap.String("shortURL", shortURL))
+	url, err := s.statsURL(ctx, shortURL)
+	if err != nil {
+		return models.StatsResponse{}, err
+	}
 
 	status, err := s.repo.GetStats(ctx, shortURL)
 	if err != nil {
 		s.logger.Info("Error getting stats", zap.Error(err))
 		return models.StatsResponse{}, err
 	}
+	if status.ReferrerHosts, err = s.topReferrers(ctx, url.ShortURL, models.ReferrerGroupHost); err != nil {
+		return models.StatsResponse{}, err
+	}
+	if status.ReferrerURLs, err = s.topReferrers(ctx, url.ShortURL, models.ReferrerGroupURL); err != nil {
+		return models.StatsResponse{}, err
+	}
+	if err = s.addBreakdowns(ctx, &status, url.ShortURL); err != nil {
+		return models.StatsResponse{}, err
+	}
+	if query.Granularity == "" && query.From.IsZero() && query.To.IsZero() {
+		return status, nil
+	}
+	if err = s.addClickSeries(ctx, &status, url, query); err != nil {
+		return models.StatsResponse{}, err
+	}
 	return status, nil
 }
+
+// GetReferrers returns a page of the referrers of shortURL, by default the
+// first page of referring hosts.
+func (s *urlService) GetReferrers(
+	ctx context.Context, shortURL string, query models.ReferrerQuery,
+) (models.ReferrerPage, error) {
+	s.logger.Info("service.GetReferrers", zap.String("short_url", shortURL), zap.String("group", query.Group))
+	query, err := referrerQuery(query)
+	if err != nil {
+		return models.ReferrerPage{}, err
+	}
+	url, err := s.statsURL(ctx, shortURL)
+	if err != nil {
+		return models.ReferrerPage{}, err
+	}
+	page, err := s.repo.GetReferrers(ctx, url.ShortURL, query)
+	if err != nil {
+		s.logger.Error("service, failed to get referrers", zap.Error(err))
+		return models.ReferrerPage{}, fmt.Errorf("get referrers: %w", err)
+	}
+	return page, nil
+}
+
+// topReferrers returns the referrers of shortURL with the most clicks.
+func (s *urlService) topReferrers(ctx context.Context, shortURL, group string) ([]models.ReferrerCount, error) {
+	page, err := s.repo.GetReferrers(ctx, shortURL, models.ReferrerQuery{Group: group, Limit: s.statsTopReferrers()})
+	if err != nil {
+		s.logger.Error("service, failed to get referrers", zap.Error(err))
+		return nil, fmt.Errorf("get referrers: %w", err)
+	}
+	return page.Items, nil
+}
+
+// addBreakdowns adds the top values of every client dimension to stats.
+func (s *urlService) addBreakdowns(ctx context.Context, stats *models.StatsResponse, shortURL string) error {
+	breakdowns := []struct {
+		dimension string
+		counts    *[]models.DimensionCount
+	}{
+		{models.DimensionBrowser, &stats.Browsers},
+		{models.DimensionOS, &stats.OperatingSystems},
+		{models.DimensionDevice, &stats.Devices},
+		{models.DimensionCountry, &stats.Countries},
+	}
+	for _, b := range breakdowns {
+		counts, err := s.repo.GetBreakdown(ctx, shortURL, b.dimension, s.statsTopValues())
+		if err != nil {
+			s.logger.Error("service, failed to get breakdown", zap.String("dimension", b.dimension), zap.Error(err))
+			return fmt.Errorf("get %s breakdown: %w", b.dimension, err)
+		}
+		*b.counts = counts
+	}
+	return nil
+}
+
+// statsURL returns the link whose statistics the caller asks for.
+func (s *urlService) statsURL(ctx context.Context, shortURL string) (models.URL, error) {
+	url, err := s.GetURL(ctx, shortURL)
+	if err != nil {
+		return models.URL{}, err
+	}
+	// Without authentication the owner of a protected link is unknown.
+	if _, ok := auth.OwnerFromContext(ctx); !ok && url.PasswordHash != "" {
+		return models.URL{}, models.ErrForbidden
+	}
+	return url, nil
+}
+
+// addClickSeries fills in the click time series of url selected by query,
+// with empty buckets for periods without clicks.
+func (s *urlService) addClickSeries(
+	ctx context.Context, stats *models.StatsResponse, url models.URL, query models.StatsQuery,
+) error {
+	if query.Granularity == "" {
+		query.Granularity = timebucket.Day
+	}
+	if query.Location == nil {
+		query.Location = time.UTC
+	}
+	if query.From.IsZero() {
+		query.From = url.CreatedAt
+	}
+	if query.To.IsZero() {
+		query.To = time.Now()
+	}
+	if !query.From.Before(query.To) {
+		return fmt.Errorf("%w: from must be before to", models.ErrInvalidRequest)
+	}
+	var starts []time.Time
+	first := query.Granularity.Truncate(query.From, query.Location)
+	for start := first; start.Before(query.To); start = query.Granularity.Next(start) {
+		if len(starts) == s.statsMaxBuckets() {
+			return fmt.Errorf("%w: more than %d buckets, use a coarser granularity or a shorter range",
+				models.ErrInvalidRequest, s.statsMaxBuckets())
+		}
+		starts = append(starts, start)
+	}
+
+	buckets, err := s.repo.GetClickSeries(ctx, url.ShortURL, query)
+	if err != nil {
+		s.logger.Error("service, failed to get click series", zap.Error(err))
+		return fmt.Errorf("get click series: %w", err)
+	}
+	clicks := make(map[int64]int, len(buckets))
+	for _, bucket := range buckets {
+		clicks[bucket.Start.Unix()] = bucket.Clicks
+	}
+	series := make([]models.ClickBucket, 0, len(starts))
+	for _, start := range starts {
+		series = append(series, models.ClickBucket{Start: start, Clicks: clicks[start.Unix()]})
+	}
+	stats.Granularity = string(query.Granularity)
+	stats.TimeZone = query.Location.String()
+	stats.Series = series
+	return nil
+}
+
+// LogFallback records a visit that was sent to the fallback URL because the
+// link could not be followed for reason.
+func (s *urlService) LogFallback(ctx context.Context, shortURL string, visit Visit, reason string) error {
+	s.logger.Info("service.LogFallback", zap.String("short_url", shortURL), zap.String("reason", reason))
+	log := s.redirectLog(shortURL, visit)
+	log.FallbackReason = &reason
+	if err := s.clicks.Record(ctx, log); err != nil {
+		s.logger.Error("Error saving RedirectLog", zap.String("log_id", log.ID), zap.Error(err))
+		return err
+	}
+	return nil
+}
@@ -39,7 +39,7 @@ func TestSaveURL_Table(t *testing.T) {
 			name:          "Custom alias not found and SaveURL succeeds",
 			customAlias:   &castom,
 			reqURL:        "https://example.com",
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			existingURL:   models.URL{},
 			saveURLError:  nil,
 			expectError:   false,
@@ -49,7 +49,7 @@ func TestSaveURL_Table(t *testing.T) {
 			name:          "No custom alias and SaveURL succeeds",
 			customAlias:   nil,
 			reqURL:        "https://example.com",
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			existingURL:   models.URL{},
 			saveURLError:  nil,
 			expectError:   false,
@@ -102,12 +102,14 @@ func TestCreateShortURL_Table(t *testing.T) {
 		saveURLError  error
 		expectError   bool
 		expectedError string
+		// rejected requests never reach the repository.
+		rejected bool
 	}{
 		{
 			name:          "CreateShortURL_ValidURL_NoCustomAlias",
 			customAlias:   nil,
 			reqURL:        "https://example.com",
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			existingURL:   models.URL{},
 			saveURLError:  nil,
 			expectError:   false,
@@ -117,7 +119,7 @@ func TestCreateShortURL_Table(t *testing.T) {
 			name:          "CreateShortURL_ValidURL_WithUniqueCustomAlias",
 			customAlias:   &castom,
 			reqURL:        "https://example.com",
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			existingURL:   models.URL{},
 			saveURLError:  nil,
 			expectError:   false,
@@ -138,10 +140,11 @@ func TestCreateShortURL_Table(t *testing.T) {
 			customAlias:   nil,
 			reqURL:        "invalid-url",
 			existingURL:   models.URL{},
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			saveURLError:  nil,
-			expectError:   false,
-			expectedError: "",
+			expectError:   true,
+			expectedError: "invalid URL",
+			rejected:      true,
 		},
 		{
 			name:          "CreateShortURL_RepositoryErrorOnCheck",
@@ -168,7 +171,7 @@ func TestCreateShortURL_Table(t *testing.T) {
 			customAlias:   nil,
 			reqURL:        "https://example.com",
 			existingURL:   models.URL{},
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			saveURLError:  errors.New("save error"),
 			expectError:   true,
 			expectedError: "save error",
@@ -184,14 +187,15 @@ func TestCreateShortURL_Table(t *testing.T) {
 				CustomAlias: tt.customAlias,
 			}
 
-			if tt.customAlias != nil {
-				mockRepo.On("GetURL", *tt.customAlias).Return(tt.existingURL, tt.getURLError).Once()
-			} else {
-				mockRepo.On("GetURL", mock.Anything).Return(tt.existingURL, tt.getURLError).Once()
+			if !tt.rejected {
+				if tt.customAlias != nil {
+					mockRepo.On("GetURL", *tt.customAlias).Return(tt.existingURL, tt.getURLError).Once()
+				} else {
+					mockRepo.On("GetURL", mock.Anything).Return(tt.existingURL, tt.getURLError).Once()
+				}
+				mockRepo.On("SaveURL", mock.Anything).Return(tt.saveURLError).Once()
 			}
 
-			mockRepo.On("SaveURL", mock.Anything).Return(tt.saveURLError).Once()
-
 			url, err := service.CreateShortURL(context.TODO(), req)
 
 			if tt.expectError {
@@ -231,7 +235,7 @@ func TestGetOriginalURL_Table(t *testing.T) {
 			name:          "GetOriginalURL_NonExistingShortURL",
 			shortURL:      short,
 			existingURL:   models.URL{},
-			getURLError:   errors.New("URL not found"),
+			getURLError:   models.ErrNotFound,
 			expectError:   true,
 			expectedError: "URL not found",
 		},
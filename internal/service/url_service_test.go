@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,10 +30,79 @@ func (m *MockURLRepository) GetURL(_ context.Context, shortURL string) (models.U
 	args := m.Called(shortURL)
 	return args.Get(0).(models.URL), args.Error(1)
 }
+func (m *MockURLRepository) UpdateURL(_ context.Context, url models.URL) error {
+	args := m.Called(url)
+	return args.Error(0)
+}
+func (m *MockURLRepository) DeleteURL(_ context.Context, shortURL string) error {
+	args := m.Called(shortURL)
+	return args.Error(0)
+}
 func (m *MockURLRepository) SaveRedirectLog(_ context.Context, log models.RedirectLog) error {
 	args := m.Called(log)
 	return args.Error(0)
 }
+func (m *MockURLRepository) SaveURLs(_ context.Context, urls []models.URL, skipConflicts bool) ([]string, error) {
+	args := m.Called(urls, skipConflicts)
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *MockURLRepository) GetClickSeries(
+	_ context.Context, shortURL string, query models.StatsQuery,
+) ([]models.ClickBucket, error) {
+	args := m.Called(shortURL, query)
+	return args.Get(0).([]models.ClickBucket), args.Error(1)
+}
+func (m *MockURLRepository) GetReferrers(
+	_ context.Context, shortURL string, query models.ReferrerQuery,
+) (models.ReferrerPage, error) {
+	args := m.Called(shortURL, query)
+	return args.Get(0).(models.ReferrerPage), args.Error(1)
+}
+func (m *MockURLRepository) GetBreakdown(
+	_ context.Context, shortURL, dimension string, limit int,
+) ([]models.DimensionCount, error) {
+	args := m.Called(shortURL, dimension, limit)
+	return args.Get(0).([]models.DimensionCount), args.Error(1)
+}
+func (m *MockURLRepository) ConsumeClick(_ context.Context, shortURL string) error {
+	args := m.Called(shortURL)
+	return args.Error(0)
+}
+
+func (m *MockURLRepository) SetBlocked(_ context.Context, shortURL string, blocked bool) error {
+	args := m.Called(shortURL, blocked)
+	return args.Error(0)
+}
+
+func (m *MockURLRepository) FindChanges(_ context.Context, window time.Duration) ([]string, error) {
+	args := m.Called(window)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockURLRepository) CountPasswordFailure(
+	_ context.Context, shortURL string, window time.Duration,
+) (int, error) {
+	args := m.Called(shortURL, window)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockURLRepository) GetPasswordFailures(_ context.Context, shortURL string, window time.Duration) (int, error) {
+	args := m.Called(shortURL, window)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockURLRepository) FindTakenCodes(_ context.Context, codes []string) ([]string, error) {
+	args := m.Called(codes)
+	return args.Get(0).([]string), args.Error(1)
+}
+func (m *MockURLRepository) FindByDestination(_ context.Context, hash string, owner *string) (models.URL, error) {
+	args := m.Called(hash, owner)
+	return args.Get(0).(models.URL), args.Error(1)
+}
+func (m *MockURLRepository) SaveRedirectLogs(_ context.Context, logs []models.RedirectLog) error {
+	args := m.Called(logs)
+	return args.Error(0)
+}
 func (m *MockURLRepository) GetStats(_ context.Context, shortURL string) (models.StatsResponse, error) {
 	args := m.Called(shortURL)
 	return args.Get(0).(models.StatsResponse), args.Error(1)
@@ -62,9 +132,9 @@ func TestSaveURL_ValidURL_CustomAlies_Found(t *testing.T) {
 		OriginalURL: "https://example.com",
 	}
 
-	mockRepo.On("GetURL", ctx, customAlias).Return(oldurl, errors.New("URL is found")).Once()
+	mockRepo.On("GetURL", customAlias).Return(oldurl, errors.New("URL is found")).Once()
 
-	mockRepo.On("SaveURL", ctx, mock.AnythingOfType("models.URL")).Return(errors.New("save error")).Once()
+	mockRepo.On("SaveURL", mock.AnythingOfType("models.URL")).Return(errors.New("save error")).Once()
 	url, err := service.CreateShortURL(ctx, req)
 
 	require.Error(t, err)
@@ -87,7 +157,7 @@ func TestSaveURL_ValidURL_CustomAlies(t *testing.T) {
 		CustomAlias: &customAlias,
 	}
 
-	mockRepo.On("GetURL", customAlias).Return(models.URL{}, errors.New("URL not found")).Once()
+	mockRepo.On("GetURL", customAlias).Return(models.URL{}, models.ErrNotFound).Once()
 
 	mockRepo.On("SaveURL", mock.AnythingOfType("models.URL")).Return(nil).Once()
 	url, err := service.CreateShortURL(ctx, req)
@@ -113,7 +183,7 @@ func TestSaveURL_ValidURL_NoCustomAlies(t *testing.T) {
 		URL: "https://example.com",
 	}
 
-	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, errors.New("URL not found"))
+	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, models.ErrNotFound)
 
 	mockRepo.On("SaveURL", mock.Anything).Return(nil).Once()
 
@@ -161,7 +231,7 @@ func TestCreateShortURL_ValidURL_NoCustomAlias(t *testing.T) {
 	}
 
 	// Simulate that the generated short URL does not exist in the repository.
-	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, errors.New("URL not found")).Once()
+	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, models.ErrNotFound).Once()
 	// Simulate successful save.
 	mockRepo.On("SaveURL", mock.Anything).Return(nil).Once()
 
@@ -191,14 +261,14 @@ func TestCreateShortURL_ValidURL_WithUniqueCustomAlias(t *testing.T) {
 	}
 
 	// Simulate that the custom alias does not exist in the repository.
-	mockRepo.On("GetURL", customAlias).Return(models.URL{}, errors.New("URL not found")).Once()
+	mockRepo.On("GetURL", customAlias).Return(models.URL{}, models.ErrNotFound).Once()
 	// Simulate successful save.
 	mockRepo.On("SaveURL", mock.Anything).Return(nil).Once()
 
-	shortURL, err := service.CreateShortURL(ctx, req)
+	url, err := service.CreateShortURL(ctx, req)
 
 	require.NoError(t, err)
-	assert.Equal(t, customAlias, shortURL)
+	assert.Equal(t, customAlias, url.ShortURL)
 	mockRepo.AssertExpectations(t)
 }
 
@@ -222,38 +292,215 @@ func TestCreateShortURL_ValidURL_WithExistingCustomAlias(t *testing.T) {
 
 	shortURL, err := service.CreateShortURL(ctx, req)
 
-	require.Error(t, err)
-	require.EqualError(t, err, "custom alias already in use")
+	require.ErrorIs(t, err, models.ErrAliasTaken)
 	assert.Empty(t, shortURL)
 	mockRepo.AssertExpectations(t)
 }
 
-func TestCreateShortURL_InvalidURLFormat(t *testing.T) {
-	// Since URL validation is handled by the validator, and the service expects valid input.
-	// this test would normally be in the handler or validator tests.
-	// However, we can simulate the service handling an invalid URL if validation was missed.
+func TestCreateShortURL_WithTTL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	service := NewURLService(mockRepo, nil, WithConfig(Config{MaxTTL: 48 * time.Hour}))
+	ctx := context.Background()
+
+	ttl := "24h"
+	req := models.ShortenRequest{
+		URL: "https://example.com",
+		TTL: &ttl,
+	}
+
+	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, models.ErrNotFound).Once()
+	mockRepo.On("SaveURL", mock.MatchedBy(func(url models.URL) bool {
+		return url.ExpiredAt != nil && url.ExpiredAt.Sub(url.CreatedAt) == 24*time.Hour
+	})).Return(nil).Once()
+
+	url, err := service.CreateShortURL(ctx, req)
+
+	require.NoError(t, err)
+	require.NotNil(t, url.ExpiredAt)
+	assert.Equal(t, url.CreatedAt.Add(24*time.Hour), *url.ExpiredAt)
+	mockRepo.AssertExpectations(t)
+}
 
+func TestCreateShortURL_InvalidExpiration(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	farFuture := time.Now().Add(72 * time.Hour)
+	badTTL := "soon"
+	negativeTTL := "-1h"
+	tooLongTTL := "100h"
+
+	tests := []struct {
+		name string
+		req  models.ShortenRequest
+	}{
+		{name: "expires_at in the past", req: models.ShortenRequest{ExpiresAt: &past}},
+		{name: "expires_at beyond max ttl", req: models.ShortenRequest{ExpiresAt: &farFuture}},
+		{name: "unparsable ttl", req: models.ShortenRequest{TTL: &badTTL}},
+		{name: "negative ttl", req: models.ShortenRequest{TTL: &negativeTTL}},
+		{name: "ttl beyond max ttl", req: models.ShortenRequest{TTL: &tooLongTTL}},
+		{name: "both expires_at and ttl", req: models.ShortenRequest{ExpiresAt: &farFuture, TTL: &badTTL}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockURLRepository)
+			service := NewURLService(mockRepo, nil, WithConfig(Config{MaxTTL: 48 * time.Hour}))
+
+			tt.req.URL = "https://example.com"
+			url, err := service.CreateShortURL(context.Background(), tt.req)
+
+			require.ErrorIs(t, err, models.ErrInvalidExpiration)
+			assert.Empty(t, url)
+			mockRepo.AssertNotCalled(t, "SaveURL", mock.Anything)
+		})
+	}
+}
+
+func TestCreateShortURL_AliasTakenOnSave(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	service := NewURLService(mockRepo, nil)
 	ctx := context.Background()
 
+	customAlias := "racealias"
 	req := models.ShortenRequest{
-		URL: "invalid-url",
+		URL:         "https://example.com",
+		CustomAlias: &customAlias,
 	}
 
-	// The service does not validate the URL format; it's expected to be valid.
-	// So we simulate the normal flow, but perhaps the repository returns an error.
+	// Simulate another request claiming the alias between the check and the insert.
+	mockRepo.On("GetURL", customAlias).Return(models.URL{}, models.ErrNotFound).Once()
+	mockRepo.On("SaveURL", mock.Anything).Return(models.ErrShortURLTaken).Once()
 
-	// Simulate that the generated short URL does not exist in the repository.
-	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, errors.New("URL not found")).Once()
-	// Simulate successful save.
-	mockRepo.On("SaveURL", mock.Anything).Return(nil).Once()
+	url, err := service.CreateShortURL(ctx, req)
 
-	shortURL, err := service.CreateShortURL(ctx, req)
+	require.ErrorIs(t, err, models.ErrAliasTaken)
+	assert.Empty(t, url)
+	mockRepo.AssertExpectations(t)
+}
+
+type countingMetrics struct {
+	created    int
+	redirects  map[string]int
+	collisions int
+	exhausted  int
+}
+
+func (m *countingMetrics) LinkCreated() { m.created++ }
+func (m *countingMetrics) Redirect(outcome string) {
+	if m.redirects == nil {
+		m.redirects = make(map[string]int)
+	}
+	m.redirects[outcome]++
+}
+func (m *countingMetrics) CodeCollision()        { m.collisions++ }
+func (m *countingMetrics) CodeRetriesExhausted() { m.exhausted++ }
+
+type fixedGenerator struct {
+	codes []string
+}
+
+func (g *fixedGenerator) Generate(_ context.Context) (string, error) {
+	code := g.codes[0]
+	g.codes = g.codes[1:]
+	return code, nil
+}
+
+func TestCreateShortURL_RetriesCollisions(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	metrics := &countingMetrics{}
+	service := NewURLService(mockRepo, nil,
+		WithGenerator(&fixedGenerator{codes: []string{"taken", "raced", "free"}}),
+		WithMetrics(metrics),
+	)
+
+	// "taken" is found by the lookup, "raced" is claimed concurrently before the insert.
+	mockRepo.On("GetURL", "taken").Return(models.URL{ShortURL: "taken"}, nil).Once()
+	mockRepo.On("GetURL", "raced").Return(models.URL{}, models.ErrNotFound).Once()
+	mockRepo.On("SaveURL", mock.MatchedBy(func(url models.URL) bool { return url.ShortURL == "raced" })).
+		Return(models.ErrShortURLTaken).Once()
+	mockRepo.On("GetURL", "free").Return(models.URL{}, models.ErrNotFound).Once()
+	mockRepo.On("SaveURL", mock.MatchedBy(func(url models.URL) bool { return url.ShortURL == "free" })).
+		Return(nil).Once()
+
+	url, err := service.CreateShortURL(context.Background(), models.ShortenRequest{URL: "https://example.com"})
 
-	// Since the service does not validate the URL, it will proceed as normal.
 	require.NoError(t, err)
-	assert.NotEmpty(t, shortURL)
+	assert.Equal(t, "free", url.ShortURL)
+	assert.Equal(t, 1, metrics.created)
+	assert.Equal(t, 2, metrics.collisions)
+	assert.Equal(t, 0, metrics.exhausted)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateShortURL_RetryBudgetExhausted(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	metrics := &countingMetrics{}
+	service := NewURLService(mockRepo, nil,
+		WithConfig(Config{CollisionRetries: 2}),
+		WithGenerator(&fixedGenerator{codes: []string{"a", "b", "c"}}),
+		WithMetrics(metrics),
+	)
+
+	mockRepo.On("GetURL", mock.Anything).Return(models.URL{ShortURL: "taken"}, nil).Times(3)
+
+	url, err := service.CreateShortURL(context.Background(), models.ShortenRequest{URL: "https://example.com"})
+
+	require.ErrorIs(t, err, models.ErrCodeGenerationFailed)
+	assert.Empty(t, url)
+	assert.Equal(t, 3, metrics.collisions)
+	assert.Equal(t, 1, metrics.exhausted)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "SaveURL", mock.Anything)
+}
+
+func TestResolveURL_CountsOutcomes(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	metrics := &countingMetrics{}
+	service := NewURLService(mockRepo, nil, WithMetrics(metrics))
+
+	past := time.Now().Add(-time.Hour)
+	mockRepo.On("GetURL", "hit").Return(models.URL{ShortURL: "hit"}, nil)
+	mockRepo.On("GetURL", "expired").Return(models.URL{ShortURL: "expired", ExpiredAt: &past}, nil)
+	mockRepo.On("GetURL", "disabled").Return(models.URL{ShortURL: "disabled", Disabled: true}, nil)
+	mockRepo.On("GetURL", "missing").Return(models.URL{}, models.ErrNotFound)
+
+	for _, code := range []string{"hit", "hit", "expired", "disabled", "missing"} {
+		_, _ = service.ResolveURL(context.Background(), code)
+	}
+
+	assert.Equal(t, map[string]int{
+		RedirectHit:      2,
+		RedirectExpired:  1,
+		RedirectDisabled: 1,
+		RedirectMiss:     1,
+	}, metrics.redirects)
+}
+
+func TestCreateShortURL_InvalidURLFormat(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	service := NewURLService(mockRepo, nil)
+	ctx := context.Background()
+
+	// Destinations are normalized before anything is stored, so URLs that
+	// slipped past request validation never reach the repository.
+	for _, destination := range []string{"invalid-url", "javascript:alert(1)", "ftp://example.com/file"} {
+		_, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: destination})
+		require.ErrorIs(t, err, models.ErrInvalidURL, destination)
+	}
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCreateShortURL_NormalizesDestination(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	service := NewURLService(mockRepo, nil)
+	ctx := context.Background()
+
+	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, models.ErrNotFound).Once()
+	mockRepo.On("SaveURL", mock.MatchedBy(func(url models.URL) bool {
+		return url.OriginalURL == "http://example.com/b" && url.DestinationHash == destinationHash("http://example.com/b")
+	})).Return(nil).Once()
+
+	url, err := service.CreateShortURL(ctx, models.ShortenRequest{URL: "HTTP://Example.com:80/a/../b?"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/b", url.OriginalURL)
 	mockRepo.AssertExpectations(t)
 }
 
@@ -287,7 +534,7 @@ func TestCreateShortURL_RepositoryErrorOnSave(t *testing.T) {
 	}
 
 	// Simulate that the generated short URL does not exist.
-	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, errors.New("URL not found")).Once()
+	mockRepo.On("GetURL", mock.Anything).Return(models.URL{}, models.ErrNotFound).Once()
 	// Simulate an error when saving the URL.
 	mockRepo.On("SaveURL", mock.Anything).Return(errors.New("save error")).Once()
 
@@ -332,7 +579,7 @@ func TestGetOriginalURL_NonExistingShortURL(t *testing.T) {
 	shortURL := "nonexistent"
 
 	// Simulate that the short URL does not exist.
-	mockRepo.On("GetURL", shortURL).Return(models.URL{}, errors.New("URL not found")).Once()
+	mockRepo.On("GetURL", shortURL).Return(models.URL{}, models.ErrNotFound).Once()
 
 	url, err := service.GetOriginalURL(ctx, shortURL)
 
@@ -362,7 +609,7 @@ func TestGetOriginalURL_ExpiredURL(t *testing.T) {
 
 	url, err := service.GetOriginalURL(ctx, shortURL)
 
-	require.Error(t, err)
+	require.ErrorIs(t, err, models.ErrExpired)
 	require.EqualError(t, err, "URL has expired")
 	assert.Empty(t, url)
 	mockRepo.AssertExpectations(t)
@@ -395,10 +642,53 @@ func TestLogRedirect(t *testing.T) {
 	ctx := context.Background()
 
 	shortURL := "abc123"
-	referrer := "https://referrer.com"
-	mockRepo.On("SaveRedirectLog", mock.Anything).Return(nil)
-	err := service.LogRedirect(ctx, shortURL, referrer)
+	visit := Visit{
+		Referrer: "https://Referrer.com/page",
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 " +
+			"(KHTML, like Gecko) Version/17.4 Mobile/15E148 Safari/604.1",
+	}
+	mockRepo.On("SaveRedirectLog", mock.MatchedBy(func(log models.RedirectLog) bool {
+		return log.ShortURL == shortURL && *log.Referrer == visit.Referrer && *log.ReferrerHost == "referrer.com" &&
+			*log.UserAgent == visit.UserAgent && log.Browser == "Safari" && log.OS == "iOS" &&
+			log.Device == "mobile" && !log.Bot
+	})).Return(nil)
+	err := service.LogRedirect(ctx, shortURL, visit)
 	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestLogRedirect_Bot(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	service := NewURLService(mockRepo, nil)
+
+	userAgent := "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)" + strings.Repeat("x", 600)
+	mockRepo.On("SaveRedirectLog", mock.MatchedBy(func(log models.RedirectLog) bool {
+		return log.Referrer == nil && len(*log.UserAgent) == maxUserAgentLength && log.Device == "bot" && log.Bot
+	})).Return(nil)
+	require.NoError(t, service.LogRedirect(context.Background(), "abc123", Visit{UserAgent: userAgent}))
+	mockRepo.AssertExpectations(t)
+}
+
+type stubLocator map[string]models.GeoLocation
+
+func (l stubLocator) Locate(ip string) models.GeoLocation {
+	return l[ip]
+}
+
+func TestLogRedirect_GeoLocation(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	locator := stubLocator{"203.0.113.7": {Country: "DE", Region: "Bavaria", City: "Munich"}}
+	service := NewURLService(mockRepo, nil, WithGeoLocator(locator))
+
+	mockRepo.On("SaveRedirectLog", mock.MatchedBy(func(log models.RedirectLog) bool {
+		return log.Country == "DE" && log.Region == "Bavaria" && log.City == "Munich"
+	})).Return(nil).Once()
+	mockRepo.On("SaveRedirectLog", mock.MatchedBy(func(log models.RedirectLog) bool {
+		return log.Country == "" && log.Region == "" && log.City == ""
+	})).Return(nil).Once()
+	require.NoError(t, service.LogRedirect(context.Background(), "abc123", Visit{ClientIP: "203.0.113.7"}))
+	require.NoError(t, service.LogFallback(context.Background(), "abc123", Visit{ClientIP: "198.51.100.1"}, "expired"))
+	mockRepo.AssertExpectations(t)
 }
 
 func TestGetStats(t *testing.T) {
@@ -411,10 +701,27 @@ func TestGetStats(t *testing.T) {
 		RedirectCount: 10,
 		CreatedAt:     time.Now(),
 		LastAccessed:  nil,
-		Referrers:     []string{"https://referrer.com"},
 	}
+	hosts := []models.ReferrerCount{{Referrer: "referrer.com", Clicks: 7}, {Referrer: "direct", Clicks: 3}}
+	urls := []models.ReferrerCount{{Referrer: "https://referrer.com/a", Clicks: 7}, {Referrer: "direct", Clicks: 3}}
+	mockRepo.On("GetURL", shortURL).Return(models.URL{ShortURL: shortURL}, nil)
 	mockRepo.On("GetStats", shortURL).Return(stats, nil)
-	result, err := service.GetStats(ctx, shortURL)
+	mockRepo.On("GetReferrers", shortURL, models.ReferrerQuery{Group: "host", Limit: 10}).
+		Return(models.ReferrerPage{Items: hosts}, nil)
+	mockRepo.On("GetReferrers", shortURL, models.ReferrerQuery{Group: "url", Limit: 10}).
+		Return(models.ReferrerPage{Items: urls}, nil)
+	browsers := []models.DimensionCount{{Value: "Chrome", Clicks: 6}, {Value: "Firefox", Clicks: 4}}
+	systems := []models.DimensionCount{{Value: "Windows", Clicks: 10}}
+	devices := []models.DimensionCount{{Value: "desktop", Clicks: 10}}
+	mockRepo.On("GetBreakdown", shortURL, "browser", 10).Return(browsers, nil)
+	mockRepo.On("GetBreakdown", shortURL, "os", 10).Return(systems, nil)
+	mockRepo.On("GetBreakdown", shortURL, "device", 10).Return(devices, nil)
+	countries := []models.DimensionCount{{Value: "DE", Clicks: 7}, {Value: "unknown", Clicks: 3}}
+	mockRepo.On("GetBreakdown", shortURL, "country", 10).Return(countries, nil)
+	result, err := service.GetStats(ctx, shortURL, models.StatsQuery{})
 	require.NoError(t, err)
+	stats.ReferrerHosts, stats.ReferrerURLs = hosts, urls
+	stats.Browsers, stats.OperatingSystems, stats.Devices = browsers, systems, devices
+	stats.Countries = countries
 	assert.Equal(t, stats, result)
 }
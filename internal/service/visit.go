@@ -0,0 +1,65 @@
+package service
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/vladislavprovich/url-shortener/internal/models"
+	"github.com/vladislavprovich/url-shortener/pkg/useragent"
+)
+
+// maxUserAgentLength bounds the stored User-Agent header, longer headers are
+// cut.
+const maxUserAgentLength = 512
+
+// Visit describes the client following a link, as reported by its request.
+type Visit struct {
+	Referrer  string
+	UserAgent string
+	// ClientIP is only used to locate the client, it is not stored.
+	ClientIP string
+}
+
+// GeoLocator locates client addresses, usually a geoip.Locator.
+type GeoLocator interface {
+	Locate(ip string) models.GeoLocation
+}
+
+// redirectLog returns the redirect log of visit to shortURL, with the user
+// agent classified and the client located.
+func (s *urlService) redirectLog(shortURL string, visit Visit) models.RedirectLog {
+	agent := useragent.Parse(visit.UserAgent)
+	log := models.RedirectLog{
+		ID:         uuid.New().String(),
+		ShortURL:   shortURL,
+		AccessedAt: time.Now().UTC(),
+		Browser:    agent.Browser,
+		OS:         agent.OS,
+		Device:     agent.Device,
+		Bot:        agent.Bot,
+	}
+	if visit.Referrer != "" {
+		log.Referrer, log.ReferrerHost = &visit.Referrer, referrerHost(visit.Referrer)
+	}
+	if visit.UserAgent != "" {
+		userAgent := truncate(visit.UserAgent, maxUserAgentLength)
+		log.UserAgent = &userAgent
+	}
+	if s.geo != nil && visit.ClientIP != "" {
+		location := s.geo.Locate(visit.ClientIP)
+		log.Country, log.Region, log.City = location.Country, location.Region, location.City
+	}
+	return log
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,24 @@
+package normalizer
+
+import (
+	"context"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type Config struct {
+	// AllowedSchemes are the accepted URL schemes, compared case-insensitively.
+	AllowedSchemes []string `envconfig:"URL_ALLOWED_SCHEMES" default:"http,https"`
+	// SortQuery orders query parameters by name.
+	SortQuery bool `envconfig:"URL_SORT_QUERY" default:"false"`
+	// StripTracking removes the query parameters listed in TrackingParams.
+	StripTracking bool `envconfig:"URL_STRIP_TRACKING" default:"false"`
+	// TrackingParams are parameter names, a trailing "*" matches any suffix.
+	TrackingParams []string `envconfig:"URL_TRACKING_PARAMS" default:"utm_*,gclid,fbclid,msclkid,mc_cid,mc_eid"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.AllowedSchemes, validation.Required),
+	)
+}
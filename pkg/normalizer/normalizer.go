@@ -0,0 +1,202 @@
+// Package normalizer canonicalizes destination URLs so that spellings of the
+// same address compare equal.
+package normalizer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid URL")
+	ErrSchemeNotAllowed  = errors.New("scheme not allowed")
+	defaultSchemes       = []string{"http", "https"}
+	defaultPorts         = map[string]string{"http": "80", "https": "443"}
+	errMissingHost       = fmt.Errorf("%w: missing host", ErrInvalidURL)
+	errRelativeReference = fmt.Errorf("%w: not an absolute URL", ErrInvalidURL)
+)
+
+// Normalizer rewrites URLs into their canonical form.
+type Normalizer struct {
+	schemes        map[string]struct{}
+	sortQuery      bool
+	trackingNames  map[string]struct{}
+	trackingPrefix []string
+}
+
+// New returns a Normalizer for cfg. Without allowed schemes only http and
+// https are accepted.
+func New(cfg Config) *Normalizer {
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = defaultSchemes
+	}
+	n := &Normalizer{
+		schemes:       make(map[string]struct{}, len(schemes)),
+		sortQuery:     cfg.SortQuery,
+		trackingNames: make(map[string]struct{}),
+	}
+	for _, scheme := range schemes {
+		n.schemes[strings.ToLower(strings.TrimSpace(scheme))] = struct{}{}
+	}
+	if cfg.StripTracking {
+		for _, name := range cfg.TrackingParams {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if prefix, ok := strings.CutSuffix(name, "*"); ok {
+				n.trackingPrefix = append(n.trackingPrefix, prefix)
+			} else if name != "" {
+				n.trackingNames[name] = struct{}{}
+			}
+		}
+	}
+	return n
+}
+
+// Normalize returns the canonical form of raw: scheme and host lowercased,
+// internationalized hosts in punycode, default ports removed, dot segments
+// resolved, an empty path replaced by "/" and an empty query dropped. Query
+// parameters are filtered and sorted as configured. Errors wrap ErrInvalidURL
+// or ErrSchemeNotAllowed.
+func (n *Normalizer) Normalize(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	if u.Scheme == "" {
+		return "", errRelativeReference
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := n.schemes[u.Scheme]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+	}
+	if u.Opaque != "" {
+		// Non-hierarchical URLs such as mailto: have no host or path to normalize.
+		return u.String(), nil
+	}
+
+	if u.Host, err = normalizeHost(u); err != nil {
+		return "", err
+	}
+	if err = normalizePath(u); err != nil {
+		return "", err
+	}
+	u.RawQuery = n.normalizeQuery(u.RawQuery)
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+func normalizeHost(u *url.URL) (string, error) {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", errMissingHost
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			host = "[" + host + "]"
+		}
+	} else {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("%w: host %q: %w", ErrInvalidURL, host, err)
+		}
+		host = ascii
+	}
+
+	port := u.Port()
+	if port == "" || port == defaultPorts[u.Scheme] {
+		return host, nil
+	}
+	return host + ":" + port, nil
+}
+
+func normalizePath(u *url.URL) error {
+	escaped := removeDotSegments(u.EscapedPath())
+	if escaped == "" {
+		escaped = "/"
+	}
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	u.Path, u.RawPath = unescaped, escaped
+	return nil
+}
+
+// removeDotSegments resolves "." and ".." segments of an absolute path as
+// described in RFC 3986, section 5.2.4.
+func removeDotSegments(path string) string {
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+		case "..":
+			// The first element is the empty segment before the leading slash.
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, segment)
+			continue
+		}
+		if last {
+			out = append(out, "")
+		}
+	}
+	return strings.Join(out, "/")
+}
+
+// normalizeQuery drops tracking parameters and sorts the rest by name if
+// configured. Parameters are kept in their original encoding.
+func (n *Normalizer) normalizeQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	type param struct {
+		name string
+		raw  string
+	}
+	var params []param
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(raw, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if n.isTracking(name) {
+			continue
+		}
+		params = append(params, param{name: name, raw: raw})
+	}
+	if n.sortQuery {
+		sort.SliceStable(params, func(i, j int) bool { return params[i].name < params[j].name })
+	}
+
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.raw
+	}
+	return strings.Join(parts, "&")
+}
+
+func (n *Normalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+	if _, ok := n.trackingNames[name]; ok {
+		return true
+	}
+	for _, prefix := range n.trackingPrefix {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package normalizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		raw      string
+		expected string
+	}{
+		{name: "case and default port", raw: "HTTP://Example.COM:80/a/../b?", expected: "http://example.com/b"},
+		{name: "https default port", raw: "https://example.com:443/", expected: "https://example.com/"},
+		{name: "other port kept", raw: "https://example.com:8443/x", expected: "https://example.com:8443/x"},
+		{name: "empty path", raw: "https://example.com", expected: "https://example.com/"},
+		{name: "dot segments", raw: "https://example.com/a/./b/../c/..", expected: "https://example.com/a/"},
+		{name: "dot segments above root", raw: "https://example.com/../../a", expected: "https://example.com/a"},
+		{name: "path case kept", raw: "https://example.com/Path?Q=V#Frag", expected: "https://example.com/Path?Q=V#Frag"},
+		{name: "escaped path kept", raw: "https://example.com/a%2Fb/c%20d", expected: "https://example.com/a%2Fb/c%20d"},
+		{name: "trailing dot", raw: "https://example.com./", expected: "https://example.com/"},
+		{name: "idn", raw: "https://Bücher.example/", expected: "https://xn--bcher-kva.example/"},
+		{name: "punycode kept", raw: "https://xn--bcher-kva.example/", expected: "https://xn--bcher-kva.example/"},
+		{name: "ipv6", raw: "http://[::1]:80/", expected: "http://[::1]/"},
+		{name: "query order kept", raw: "https://example.com/?b=2&a=1", expected: "https://example.com/?b=2&a=1"},
+		{
+			name: "query sorted", cfg: Config{SortQuery: true},
+			raw: "https://example.com/?b=2&a=1&b=1", expected: "https://example.com/?a=1&b=2&b=1",
+		},
+		{
+			name: "tracking kept by default", cfg: Config{TrackingParams: []string{"utm_*"}},
+			raw: "https://example.com/?utm_source=x", expected: "https://example.com/?utm_source=x",
+		},
+		{
+			name: "tracking stripped", cfg: Config{StripTracking: true, TrackingParams: []string{"utm_*", "fbclid"}},
+			raw:      "https://example.com/?id=1&UTM_Source=x&utm_medium=y&fbclid=z&fbclid2=w",
+			expected: "https://example.com/?id=1&fbclid2=w",
+		},
+		{
+			name: "only tracking", cfg: Config{StripTracking: true, TrackingParams: []string{"gclid"}},
+			raw: "https://example.com/p?gclid=1", expected: "https://example.com/p",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := New(tt.cfg).Normalize(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, normalized)
+		})
+	}
+}
+
+func TestNormalize_Rejected(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		raw      string
+		expected error
+	}{
+		{name: "javascript", raw: "javascript:alert(1)", expected: ErrSchemeNotAllowed},
+		{name: "ftp by default", raw: "ftp://example.com/file", expected: ErrSchemeNotAllowed},
+		{name: "data", raw: "data:text/html,<script>", expected: ErrSchemeNotAllowed},
+		{
+			name: "https not allowed", cfg: Config{AllowedSchemes: []string{"http"}},
+			raw: "https://example.com", expected: ErrSchemeNotAllowed,
+		},
+		{name: "relative", raw: "/path", expected: ErrInvalidURL},
+		{name: "missing host", raw: "https:///path", expected: ErrInvalidURL},
+		{name: "malformed", raw: "https://exa mple.com/%zz", expected: ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg).Normalize(tt.raw)
+			require.ErrorIs(t, err, tt.expected)
+		})
+	}
+}
+
+func TestNormalize_AllowedScheme(t *testing.T) {
+	n := New(Config{AllowedSchemes: []string{"HTTPS", "mailto"}})
+
+	normalized, err := n.Normalize("MAILTO:someone@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "mailto:someone@example.com", normalized)
+
+	_, err = n.Normalize("http://example.com")
+	require.ErrorIs(t, err, ErrSchemeNotAllowed)
+}
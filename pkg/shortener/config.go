@@ -0,0 +1,53 @@
+package shortener
+
+import (
+	"context"
+	"fmt"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	StrategyRandom     = "random"
+	StrategySequence   = "sequence"
+	StrategyObfuscated = "obfuscated"
+
+	// maxLength matches the size of the urls.short_url column.
+	maxLength = 10
+)
+
+type Config struct {
+	Strategy string `envconfig:"SHORTENER_STRATEGY" default:"random"`
+	// Length is the exact length of random codes and the minimum length of
+	// sequence based codes.
+	Length int    `envconfig:"SHORTENER_LENGTH" default:"7"`
+	Salt   string `envconfig:"SHORTENER_SALT"`
+}
+
+func (c Config) ValidateWithContext(ctx context.Context) error {
+	return validation.ValidateStructWithContext(ctx, &c,
+		validation.Field(&c.Strategy, validation.Required,
+			validation.In(StrategyRandom, StrategySequence, StrategyObfuscated)),
+		validation.Field(&c.Length, validation.Required, validation.Min(4), validation.Max(maxLength)),
+		validation.Field(&c.Salt, validation.When(c.Strategy == StrategyObfuscated, validation.Required)),
+	)
+}
+
+// New builds the Generator selected by cfg. Sequence based strategies draw
+// their numbers from sequence.
+func New(cfg Config, sequence Sequence) (Generator, error) {
+	switch cfg.Strategy {
+	case StrategyRandom:
+		return NewRandomGenerator(cfg.Length), nil
+	case StrategySequence, StrategyObfuscated:
+		if sequence == nil {
+			return nil, fmt.Errorf("short code strategy %q needs a sequence", cfg.Strategy)
+		}
+		if cfg.Strategy == StrategySequence {
+			return NewSequenceGenerator(sequence, cfg.Length), nil
+		}
+		return NewObfuscatedGenerator(sequence, cfg.Length, cfg.Salt), nil
+	default:
+		return nil, fmt.Errorf("unknown short code strategy %q", cfg.Strategy)
+	}
+}
@@ -0,0 +1,109 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync/atomic"
+)
+
+const (
+	// obfuscationBits bounds obfuscated IDs to 2^48 values, at most 9 base62 characters.
+	obfuscationBits = 48
+	obfuscationMask = 1<<obfuscationBits - 1
+	// obfuscationMultiplier is odd, which makes multiplication modulo 2^48 a bijection.
+	obfuscationMultiplier = 0x5DEECE66D
+)
+
+var ErrSequenceExhausted = errors.New("sequence exhausted")
+
+// Sequence hands out unique, increasing numbers, e.g. from a database sequence.
+type Sequence interface {
+	Next(ctx context.Context) (uint64, error)
+}
+
+type counter struct {
+	value atomic.Uint64
+}
+
+// NewCounter returns an in-process Sequence starting after start. It does not
+// survive restarts and is only suitable for a single instance.
+func NewCounter(start uint64) Sequence {
+	c := &counter{}
+	c.value.Store(start)
+	return c
+}
+
+func (c *counter) Next(_ context.Context) (uint64, error) {
+	return c.value.Add(1), nil
+}
+
+type sequenceGenerator struct {
+	sequence  Sequence
+	minLength int
+}
+
+// NewSequenceGenerator returns a Generator encoding the numbers of sequence in
+// base62. Codes are short and collision free but predictable.
+func NewSequenceGenerator(sequence Sequence, minLength int) Generator {
+	return &sequenceGenerator{sequence: sequence, minLength: minLength}
+}
+
+func (g *sequenceGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.sequence.Next(ctx)
+	if err != nil {
+		return "", fmt.Errorf("next sequence value: %w", err)
+	}
+	return encode(n, Alphabet, g.minLength), nil
+}
+
+type obfuscatedGenerator struct {
+	sequence  Sequence
+	minLength int
+	alphabet  string
+	offset    uint64
+}
+
+// NewObfuscatedGenerator returns a Generator that, like sqids or hashids,
+// turns sequence numbers into codes that do not reveal their order. The
+// numbers are permuted with a salt derived bijection and encoded with a salt
+// shuffled alphabet, so codes stay collision free as long as the salt is kept.
+func NewObfuscatedGenerator(sequence Sequence, minLength int, salt string) Generator {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(salt))
+	seed := h.Sum64()
+
+	return &obfuscatedGenerator{
+		sequence:  sequence,
+		minLength: minLength,
+		alphabet:  shuffle(Alphabet, seed),
+		offset:    seed & obfuscationMask,
+	}
+}
+
+func (g *obfuscatedGenerator) Generate(ctx context.Context) (string, error) {
+	n, err := g.sequence.Next(ctx)
+	if err != nil {
+		return "", fmt.Errorf("next sequence value: %w", err)
+	}
+	if n > obfuscationMask {
+		return "", ErrSequenceExhausted
+	}
+	return encode((n*obfuscationMultiplier+g.offset)&obfuscationMask, g.alphabet, g.minLength), nil
+}
+
+// shuffle deterministically permutes alphabet with a Fisher-Yates shuffle
+// driven by a xorshift generator seeded with seed.
+func shuffle(alphabet string, seed uint64) string {
+	chars := []byte(alphabet)
+	state := seed | 1
+	for i := len(chars) - 1; i > 0; i-- {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		j := state % uint64(i+1)
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
@@ -1,15 +1,61 @@
 package shortener
 
 import (
+	"context"
 	"crypto/rand"
-	"encoding/base64"
+	"fmt"
+	"math/big"
 )
 
-func GeneratorShortURL() string {
-	cap_len := 6
-	b := make([]byte, cap_len)
-	if _, err := rand.Read(b); err != nil {
-		panic(err)
+// Alphabet is the base62 alphabet used by all generators.
+const Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Generator produces candidate short codes. Codes are not guaranteed to be
+// unused, callers must check for collisions.
+type Generator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+type randomGenerator struct {
+	length int
+}
+
+// NewRandomGenerator returns a Generator of uniformly random base62 codes of
+// the given length.
+func NewRandomGenerator(length int) Generator {
+	return &randomGenerator{length: length}
+}
+
+func (g *randomGenerator) Generate(_ context.Context) (string, error) {
+	limit := big.NewInt(int64(len(Alphabet)))
+	code := make([]byte, g.length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", fmt.Errorf("read random: %w", err)
+		}
+		code[i] = Alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// encode writes n in the base of alphabet, left padded with alphabet[0] to at
+// least minLength characters.
+func encode(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+	var buf [64]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = alphabet[n%base]
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for len(buf)-i < minLength {
+		i--
+		buf[i] = alphabet[0]
 	}
-	return base64.URLEncoding.EncodeToString(b)
+	return string(buf[i:])
 }
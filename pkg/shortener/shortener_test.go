@@ -0,0 +1,110 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingSequence struct{}
+
+func (failingSequence) Next(_ context.Context) (uint64, error) {
+	return 0, errors.New("database down")
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g := NewRandomGenerator(8)
+	seen := make(map[string]struct{})
+	for range 1000 {
+		code, err := g.Generate(context.TODO())
+		require.NoError(t, err)
+		require.Len(t, code, 8)
+		for _, c := range code {
+			require.True(t, strings.ContainsRune(Alphabet, c), "unexpected character %q", c)
+		}
+		seen[code] = struct{}{}
+	}
+	assert.Len(t, seen, 1000)
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, "0", encode(0, Alphabet, 0))
+	assert.Equal(t, "z", encode(61, Alphabet, 0))
+	assert.Equal(t, "10", encode(62, Alphabet, 0))
+	assert.Equal(t, "000010", encode(62, Alphabet, 6))
+}
+
+func TestSequenceGenerator(t *testing.T) {
+	g := NewSequenceGenerator(NewCounter(61), 4)
+
+	code, err := g.Generate(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "0010", code)
+
+	code, err = g.Generate(context.TODO())
+	require.NoError(t, err)
+	assert.Equal(t, "0011", code)
+}
+
+func TestObfuscatedGenerator(t *testing.T) {
+	g := NewObfuscatedGenerator(NewCounter(0), 6, "pepper")
+	same := NewObfuscatedGenerator(NewCounter(0), 6, "pepper")
+	other := NewObfuscatedGenerator(NewCounter(0), 6, "salt")
+
+	seen := make(map[string]struct{})
+	var previous string
+	for range 1000 {
+		code, err := g.Generate(context.TODO())
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(code), 6)
+		require.LessOrEqual(t, len(code), 9)
+
+		sameCode, err := same.Generate(context.TODO())
+		require.NoError(t, err)
+		assert.Equal(t, code, sameCode, "the same salt must produce the same codes")
+
+		otherCode, err := other.Generate(context.TODO())
+		require.NoError(t, err)
+		assert.NotEqual(t, code, otherCode)
+
+		assert.NotEqual(t, previous, code)
+		previous = code
+		seen[code] = struct{}{}
+	}
+	assert.Len(t, seen, 1000)
+}
+
+func TestObfuscatedGenerator_Exhausted(t *testing.T) {
+	g := NewObfuscatedGenerator(NewCounter(obfuscationMask), 6, "pepper")
+	_, err := g.Generate(context.TODO())
+	require.ErrorIs(t, err, ErrSequenceExhausted)
+}
+
+func TestGenerators_SequenceError(t *testing.T) {
+	for _, g := range []Generator{
+		NewSequenceGenerator(failingSequence{}, 6),
+		NewObfuscatedGenerator(failingSequence{}, 6, "pepper"),
+	} {
+		_, err := g.Generate(context.TODO())
+		require.Error(t, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, strategy := range []string{StrategyRandom, StrategySequence, StrategyObfuscated} {
+		g, err := New(Config{Strategy: strategy, Length: 6, Salt: "pepper"}, NewCounter(0))
+		require.NoError(t, err)
+		code, err := g.Generate(context.TODO())
+		require.NoError(t, err)
+		assert.NotEmpty(t, code)
+	}
+
+	_, err := New(Config{Strategy: StrategySequence, Length: 6}, nil)
+	require.Error(t, err)
+	_, err = New(Config{Strategy: "unknown", Length: 6}, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,67 @@
+// Package timebucket groups points in time into calendar buckets, matching
+// the date_trunc function of Postgres.
+package timebucket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Granularity is the size of a bucket, named like the date_trunc fields.
+type Granularity string
+
+const (
+	Hour  Granularity = "hour"
+	Day   Granularity = "day"
+	Week  Granularity = "week"
+	Month Granularity = "month"
+)
+
+var ErrInvalidGranularity = errors.New("invalid granularity")
+
+// Parse returns the granularity named s.
+func Parse(s string) (Granularity, error) {
+	switch g := Granularity(s); g {
+	case Hour, Day, Week, Month:
+		return g, nil
+	default:
+		return "", fmt.Errorf("%w: %q, expected hour, day, week or month", ErrInvalidGranularity, s)
+	}
+}
+
+// Truncate returns the start of the bucket containing t, in the calendar of
+// loc. Weeks start on Monday. Hours are separate instants, so the hour that
+// repeats when clocks go back yields two buckets like Next does.
+func (g Granularity) Truncate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	year, month, day := t.Date()
+	switch g {
+	case Hour:
+		// Rebuilding the wall time would be ambiguous in the repeated hour.
+		sinceHour := time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second +
+			time.Duration(t.Nanosecond())
+		return t.Add(-sinceHour)
+	case Week:
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(year, month, day-sinceMonday, 0, 0, 0, 0, loc)
+	case Month:
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	default:
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+}
+
+// Next returns the start of the bucket following the one starting at start.
+func (g Granularity) Next(start time.Time) time.Time {
+	switch g {
+	case Hour:
+		return start.Add(time.Hour)
+	case Week:
+		return start.AddDate(0, 0, 7)
+	case Month:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
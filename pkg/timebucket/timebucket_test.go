@@ -0,0 +1,65 @@
+package timebucket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTruncate(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// Sunday 23:30 UTC is already Monday in Berlin.
+	at := time.Date(2024, time.March, 31, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		granularity Granularity
+		loc         *time.Location
+		expected    time.Time
+	}{
+		{Hour, time.UTC, time.Date(2024, time.March, 31, 23, 0, 0, 0, time.UTC)},
+		{Day, time.UTC, time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{Day, berlin, time.Date(2024, time.April, 1, 0, 0, 0, 0, berlin)},
+		{Week, time.UTC, time.Date(2024, time.March, 25, 0, 0, 0, 0, time.UTC)},
+		{Week, berlin, time.Date(2024, time.April, 1, 0, 0, 0, 0, berlin)},
+		{Month, time.UTC, time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{Month, berlin, time.Date(2024, time.April, 1, 0, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.granularity)+" "+tt.loc.String(), func(t *testing.T) {
+			assert.True(t, tt.expected.Equal(tt.granularity.Truncate(at, tt.loc)), tt.granularity.Truncate(at, tt.loc))
+		})
+	}
+}
+
+func TestNext_AcrossDaylightSaving(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	// The day clocks go forward has 23 hours.
+	start := time.Date(2024, time.March, 31, 0, 0, 0, 0, berlin)
+	next := Day.Next(start)
+	assert.Equal(t, time.Date(2024, time.April, 1, 0, 0, 0, 0, berlin), next)
+	assert.Equal(t, 23*time.Hour, next.Sub(start))
+
+	// The hour from 2:00 to 3:00 repeats when clocks go back, first in CEST,
+	// then in CET. Each is a bucket of its own.
+	cest := time.Date(2024, time.October, 27, 0, 30, 0, 0, time.UTC)
+	cet := cest.Add(time.Hour)
+	require.Equal(t, cest.In(berlin).Hour(), cet.In(berlin).Hour())
+	first, second := Hour.Truncate(cest, berlin), Hour.Truncate(cet, berlin)
+	assert.True(t, first.Equal(time.Date(2024, time.October, 27, 0, 0, 0, 0, time.UTC)), first)
+	assert.True(t, second.Equal(Hour.Next(first)), second)
+	assert.True(t, Hour.Truncate(cet.Add(time.Hour), berlin).Equal(Hour.Next(second)))
+}
+
+func TestParse(t *testing.T) {
+	g, err := Parse("week")
+	require.NoError(t, err)
+	assert.Equal(t, Week, g)
+
+	_, err = Parse("minute")
+	require.ErrorIs(t, err, ErrInvalidGranularity)
+}
@@ -0,0 +1,141 @@
+// Package useragent classifies User-Agent headers into browser, operating
+// system and device class and recognizes bots. The rules are embedded in the
+// binary, no external service or database is needed.
+package useragent
+
+import (
+	_ "embed"
+	"strings"
+)
+
+// Device classes. Unknown is also the browser and operating system of an
+// empty header.
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	Bot     = "bot"
+	Unknown = "unknown"
+)
+
+// Other is reported for browsers and operating systems without a rule.
+const Other = "Other"
+
+// Agent is a parsed User-Agent header.
+type Agent struct {
+	Browser string
+	OS      string
+	Device  string
+	Bot     bool
+}
+
+type rule struct {
+	// token is matched case-insensitively anywhere in the user agent.
+	token string
+	name  string
+}
+
+// browserRules are checked in order. Most browsers mention the engines of
+// others, so the more specific tokens come first.
+var browserRules = []rule{
+	{"edg/", "Edge"},
+	{"edga/", "Edge"},
+	{"edgios/", "Edge"},
+	{"edge/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"yabrowser/", "Yandex Browser"},
+	{"ucbrowser/", "UC Browser"},
+	{"vivaldi/", "Vivaldi"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chromium"},
+	{"chrome/", "Chrome"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"safari/", "Safari"},
+}
+
+var osRules = []rule{
+	{"windows phone", "Windows Phone"},
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iPadOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	// "(X11; CrOS x86_64 ...)", a bare "cros" also matches "microsoft".
+	{"; cros ", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+	{"freebsd", "FreeBSD"},
+}
+
+//go:embed bots.txt
+var botList string
+
+var botTokens = loadBotTokens(botList)
+
+func loadBotTokens(list string) []string {
+	var tokens []string
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	return tokens
+}
+
+// Parse classifies the User-Agent header ua. An empty header is Unknown in
+// every dimension.
+func Parse(ua string) Agent {
+	if strings.TrimSpace(ua) == "" {
+		return Agent{Browser: Unknown, OS: Unknown, Device: Unknown}
+	}
+	lower := strings.ToLower(ua)
+	agent := Agent{
+		Browser: match(lower, browserRules),
+		OS:      match(lower, osRules),
+		Bot:     isBot(lower),
+	}
+	agent.Device = device(lower, agent)
+	return agent
+}
+
+func match(ua string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(ua, r.token) {
+			return r.name
+		}
+	}
+	return Other
+}
+
+func isBot(ua string) bool {
+	for _, token := range botTokens {
+		if strings.Contains(ua, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func device(ua string, agent Agent) string {
+	switch {
+	case agent.Bot:
+		return Bot
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		agent.OS == "Android" && !strings.Contains(ua, "mobile"):
+		return Tablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone") || strings.Contains(ua, "ipod") ||
+		agent.OS == "Windows Phone":
+		return Mobile
+	case agent.OS == Other && agent.Browser == Other:
+		return Unknown
+	default:
+		return Desktop
+	}
+}
@@ -0,0 +1,119 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		ua       string
+		expected Agent
+	}{
+		{
+			name: "chrome on windows",
+			ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/124.0.0.0 Safari/537.36",
+			expected: Agent{Browser: "Chrome", OS: "Windows", Device: Desktop},
+		},
+		{
+			name: "edge on windows",
+			ua: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 " +
+				"Safari/537.36 Edg/124.0.2478.51",
+			expected: Agent{Browser: "Edge", OS: "Windows", Device: Desktop},
+		},
+		{
+			name: "safari on iphone",
+			ua: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) " +
+				"Version/17.4 Mobile/15E148 Safari/604.1",
+			expected: Agent{Browser: "Safari", OS: "iOS", Device: Mobile},
+		},
+		{
+			name: "chrome on ipad",
+			ua: "Mozilla/5.0 (iPad; CPU OS 17_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) " +
+				"CriOS/124.0.6367.88 Mobile/15E148 Safari/604.1",
+			expected: Agent{Browser: "Chrome", OS: "iPadOS", Device: Tablet},
+		},
+		{
+			name: "samsung internet on android phone",
+			ua: "Mozilla/5.0 (Linux; Android 14; SM-S918B) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"SamsungBrowser/24.0 Chrome/117.0.0.0 Mobile Safari/537.36",
+			expected: Agent{Browser: "Samsung Internet", OS: "Android", Device: Mobile},
+		},
+		{
+			name:     "firefox on android tablet",
+			ua:       "Mozilla/5.0 (Android 14; Tablet; rv:125.0) Gecko/125.0 Firefox/125.0",
+			expected: Agent{Browser: "Firefox", OS: "Android", Device: Tablet},
+		},
+		{
+			name:     "firefox on linux",
+			ua:       "Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+			expected: Agent{Browser: "Firefox", OS: "Linux", Device: Desktop},
+		},
+		{
+			name: "chrome on chromeos",
+			ua: "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/124.0.0.0 Safari/537.36",
+			expected: Agent{Browser: "Chrome", OS: "ChromeOS", Device: Desktop},
+		},
+		{
+			name:     "outlook on macos",
+			ua:       "Microsoft Office/16.0 (Macintosh; Mac OS X 10_15_7; Microsoft Outlook 16.84.24041420; Pro)",
+			expected: Agent{Browser: Other, OS: "macOS", Device: Desktop},
+		},
+		{
+			name: "chrome on cubot phone",
+			ua: "Mozilla/5.0 (Linux; Android 11; CUBOT_X30) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/124.0.0.0 Mobile Safari/537.36",
+			expected: Agent{Browser: "Chrome", OS: "Android", Device: Mobile},
+		},
+		{
+			name: "android device named monitor",
+			ua: "Mozilla/5.0 (Linux; Android 13; Monitor X1) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/124.0.0.0 Mobile Safari/537.36",
+			expected: Agent{Browser: "Chrome", OS: "Android", Device: Mobile},
+		},
+		{
+			name:     "slackbot",
+			ua:       "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			expected: Agent{Browser: Other, OS: Other, Device: Bot, Bot: true},
+		},
+		{
+			name:     "uptime robot",
+			ua:       "Mozilla/5.0+(compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)",
+			expected: Agent{Browser: Other, OS: Other, Device: Bot, Bot: true},
+		},
+		{
+			name:     "googlebot",
+			ua:       "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected: Agent{Browser: Other, OS: Other, Device: Bot, Bot: true},
+		},
+		{
+			name:     "link preview",
+			ua:       "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			expected: Agent{Browser: Other, OS: Other, Device: Bot, Bot: true},
+		},
+		{
+			name:     "curl",
+			ua:       "curl/8.5.0",
+			expected: Agent{Browser: Other, OS: Other, Device: Bot, Bot: true},
+		},
+		{
+			name:     "unknown",
+			ua:       "SomeClient",
+			expected: Agent{Browser: Other, OS: Other, Device: Unknown},
+		},
+		{
+			name:     "empty",
+			ua:       "",
+			expected: Agent{Browser: Unknown, OS: Unknown, Device: Unknown},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Parse(tt.ua))
+		})
+	}
+}